@@ -0,0 +1,71 @@
+package retryabletransport
+
+import (
+	"math/rand/v2"
+	"net/http"
+)
+
+// BackendSelection determines how the backend of each attempt is picked among the configured backends.
+type BackendSelection int
+
+const (
+	// BackendSpread rotates through the backends on every attempt, so retries fail over to another backend.
+	BackendSpread BackendSelection = iota
+	// BackendSticky keeps every attempt of a request on the same backend, preserving session affinity.
+	BackendSticky
+)
+
+// WithBackends sends the attempts of each request to one of backends, given as host or host:port, replacing the
+// host of the request URL. The first attempt of a request goes to a randomly picked backend, and selection picks
+// the backends of its retries.
+func WithBackends(backends []string, selection BackendSelection) Option {
+	return func(p *RoundTripper) {
+		p.backends = backends
+		p.backendSelection = selection
+	}
+}
+
+// BackendFunc picks the host, given as host or host:port, that the retry numbered attempt of req is sent to, based on
+// the last response, whose body is already closed, and the last error, e.g. to avoid the backend that just failed.
+// Returning an empty string keeps the host of the previous attempt.
+type BackendFunc func(req *http.Request, lastResp *http.Response, lastErr error, attempt uint64) string
+
+// WithBackendFunc picks the host of every retry with backendFunc, replacing the host of the request URL on the
+// request sent for the attempt. Combined with WithBackends, it overrides the selection for the retries it returns a
+// host for, and the first attempt still goes to a randomly picked backend.
+func WithBackendFunc(backendFunc BackendFunc) Option {
+	return func(p *RoundTripper) {
+		p.backendFunc = backendFunc
+	}
+}
+
+// attemptHost returns the host the next attempt of the request is sent to, or an empty string to keep the
+// host of the request URL.
+func (p *RoundTripper) attemptHost(state *retryState) string {
+	if p.backendFunc != nil && state.attempts > 0 {
+		if host := p.backendFunc(state.req, state.resp, state.err, state.attempts); host != "" {
+			state.host = host
+		}
+		return state.host
+	}
+	if len(p.backends) > 0 {
+		state.host = p.backendFor(state)
+	}
+	return state.host
+}
+
+// backendFor returns the backend the next attempt of the request is sent to.
+func (p *RoundTripper) backendFor(state *retryState) string {
+	if state.attempts == 0 {
+		state.backend = rand.IntN(len(p.backends))
+	} else if p.backendSelection == BackendSpread {
+		state.backend = (state.backend + 1) % len(p.backends)
+	}
+	return p.backends[state.backend]
+}
+
+// setHost points req at host.
+func setHost(req *http.Request, host string) {
+	req.URL.Host = host
+	req.Host = host
+}
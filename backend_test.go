@@ -0,0 +1,119 @@
+package retryabletransport_test
+
+import (
+	"net/http"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/linzhengen/retryabletransport"
+	"github.com/linzhengen/retryabletransport/retrytest"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_WithBackends(t *testing.T) {
+	backends := []string{"a.example.com", "b.example.com", "c.example.com"}
+	type test struct {
+		name      string
+		selection retryabletransport.BackendSelection
+		wantHosts int
+	}
+	tests := []test{
+		{
+			name:      "spread rotates backends across attempts",
+			selection: retryabletransport.BackendSpread,
+			wantHosts: 3,
+		},
+		{
+			name:      "sticky keeps the same backend across attempts",
+			selection: retryabletransport.BackendSticky,
+			wantHosts: 1,
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			recorder := retrytest.NewRecordingRoundTripper(roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+				return nil, syscall.ECONNREFUSED
+			}))
+			rt := retryabletransport.New(
+				recorder,
+				nil,
+				nil,
+				&retryabletransport.BackOffPolicy{MaxRetries: 2},
+				retryabletransport.WithBackends(backends, tc.selection),
+			)
+			req, err := http.NewRequest(http.MethodGet, "http://service.example.com/path", nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			_, err = rt.RoundTrip(req)
+			assert.ErrorIs(t, err, syscall.ECONNREFUSED)
+			hosts := map[string]bool{}
+			for _, r := range recorder.Requests() {
+				assert.Contains(t, backends, r.URL.Host)
+				assert.Equal(t, r.URL.Host, r.Host)
+				assert.Equal(t, "/path", r.URL.Path)
+				hosts[r.URL.Host] = true
+			}
+			assert.Len(t, hosts, tc.wantHosts)
+			assert.Equal(t, "service.example.com", req.URL.Host)
+		})
+	}
+}
+
+func Test_WithBackendFunc(t *testing.T) {
+	statusCodes := map[string]int{
+		"service.example.com": http.StatusServiceUnavailable,
+		"a.example.com":       http.StatusTooManyRequests,
+		"b.example.com":       http.StatusOK,
+	}
+	recorder := retrytest.NewRecordingRoundTripper(roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		return &http.Response{StatusCode: statusCodes[req.URL.Host], Body: http.NoBody}, nil
+	}))
+	type call struct {
+		status  int
+		attempt uint64
+	}
+	var calls []call
+	rt := retryabletransport.New(
+		recorder,
+		nil,
+		nil,
+		&retryabletransport.BackOffPolicy{MaxRetries: 3, InitialInterval: time.Millisecond},
+		retryabletransport.WithBackendFunc(func(req *http.Request, lastResp *http.Response, lastErr error, attempt uint64) string {
+			calls = append(calls, call{status: lastResp.StatusCode, attempt: attempt})
+			switch lastResp.StatusCode {
+			case http.StatusServiceUnavailable:
+				return "a.example.com"
+			case http.StatusTooManyRequests:
+				if attempt == 2 {
+					// Keep the current host once.
+					return ""
+				}
+				return "b.example.com"
+			}
+			return ""
+		}),
+	)
+	req, err := http.NewRequest(http.MethodGet, "http://service.example.com/path", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := rt.RoundTrip(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	var hosts []string
+	for _, r := range recorder.Requests() {
+		assert.Equal(t, r.URL.Host, r.Host)
+		hosts = append(hosts, r.URL.Host)
+	}
+	assert.Equal(t, []string{"service.example.com", "a.example.com", "a.example.com", "b.example.com"}, hosts)
+	assert.Equal(t, []call{
+		{status: http.StatusServiceUnavailable, attempt: 1},
+		{status: http.StatusTooManyRequests, attempt: 2},
+		{status: http.StatusTooManyRequests, attempt: 3},
+	}, calls)
+	assert.Equal(t, "service.example.com", req.URL.Host)
+}
@@ -0,0 +1,319 @@
+package retryabletransport
+
+import (
+	"math"
+	"strconv"
+	"time"
+
+	"github.com/cenkalti/backoff/v4"
+)
+
+// resolve returns a copy of the policy with its defaults applied.
+func (p BackOffPolicy) resolve() BackOffPolicy {
+	r := p
+	if r.InitialInterval == 0 {
+		r.InitialInterval = backoff.DefaultInitialInterval
+	}
+	if r.MaxInterval == 0 {
+		r.MaxInterval = backoff.DefaultMaxInterval
+	}
+	if r.Multiplier == 0 {
+		r.Multiplier = backoff.DefaultMultiplier
+	}
+	if r.RandomizationFactor == 0 {
+		r.RandomizationFactor = backoff.DefaultRandomizationFactor
+	} else if r.RandomizationFactor < 0 {
+		r.RandomizationFactor = 0
+	}
+	if r.MaxElapsedTime == 0 {
+		r.MaxElapsedTime = backoff.DefaultMaxElapsedTime
+	}
+	return r
+}
+
+// newExponentialBackOff creates the exponential backoff described by a resolved policy.
+func (p BackOffPolicy) newExponentialBackOff() *backoff.ExponentialBackOff {
+	b := backoff.NewExponentialBackOff()
+	b.InitialInterval = p.InitialInterval
+	b.MaxInterval = p.MaxInterval
+	b.Multiplier = p.Multiplier
+	b.RandomizationFactor = p.RandomizationFactor
+	b.MaxElapsedTime = p.MaxElapsedTime
+	b.Reset()
+	return b
+}
+
+// newBackOff creates the backoff described by a resolved policy.
+func (p BackOffPolicy) newBackOff() backoff.BackOff {
+	var b backoff.BackOff = p.newExponentialBackOff()
+	if p.CeilingInterval > 0 {
+		b = &ceilingBackOff{BackOff: b, policy: p, interval: p.InitialInterval}
+	}
+	if p.FirstRetryImmediate {
+		b = &immediateFirstBackOff{BackOff: b}
+	}
+	return b
+}
+
+// immediateFirstBackOff returns no delay for the first retry and defers to the wrapped backoff afterwards.
+type immediateFirstBackOff struct {
+	backoff.BackOff
+	done bool
+}
+
+// NextBackOff returns 0 the first time and the wrapped backoff delay afterwards.
+func (b *immediateFirstBackOff) NextBackOff() time.Duration {
+	if !b.done {
+		b.done = true
+		return 0
+	}
+	return b.BackOff.NextBackOff()
+}
+
+// Reset makes the next retry immediate again.
+func (b *immediateFirstBackOff) Reset() {
+	b.BackOff.Reset()
+	b.done = false
+}
+
+// ceilingBackOff switches to a constant backoff at the ceiling of the policy once the interval reaches it.
+type ceilingBackOff struct {
+	backoff.BackOff
+	policy   BackOffPolicy
+	interval time.Duration
+}
+
+// NextBackOff returns the wrapped backoff delay capped at the ceiling, or the ceiling itself once reached.
+func (b *ceilingBackOff) NextBackOff() time.Duration {
+	next := b.BackOff.NextBackOff()
+	if next == backoff.Stop {
+		return next
+	}
+	ceiling := b.ceiling()
+	if b.interval >= ceiling {
+		return ceiling
+	}
+	b.interval = time.Duration(float64(b.interval) * b.policy.Multiplier)
+	return min(next, ceiling)
+}
+
+// ceiling returns the constant delay of the policy, CeilingInterval capped at MaxInterval.
+func (b *ceilingBackOff) ceiling() time.Duration {
+	return min(b.policy.CeilingInterval, b.policy.MaxInterval)
+}
+
+// Reset restarts the interval growth.
+func (b *ceilingBackOff) Reset() {
+	b.BackOff.Reset()
+	b.interval = b.policy.InitialInterval
+}
+
+// clamp wraps b to apply MinInterval and AbsoluteMaxSleep of a resolved policy to every delay, if set.
+func (p BackOffPolicy) clamp(b backoff.BackOff) backoff.BackOff {
+	if p.MinInterval <= 0 && p.AbsoluteMaxSleep <= 0 {
+		return b
+	}
+	return &clampBackOff{BackOff: b, minInterval: p.MinInterval, maxSleep: p.AbsoluteMaxSleep}
+}
+
+// clampBackOff raises every delay of the wrapped backoff to MinInterval and caps it at AbsoluteMaxSleep.
+type clampBackOff struct {
+	backoff.BackOff
+	minInterval time.Duration
+	maxSleep    time.Duration
+}
+
+// NextBackOff returns the wrapped backoff delay, raised to minInterval and then capped at maxSleep if set.
+func (b *clampBackOff) NextBackOff() time.Duration {
+	next := b.BackOff.NextBackOff()
+	if next == backoff.Stop {
+		return next
+	}
+	next = max(next, b.minInterval)
+	if b.maxSleep > 0 {
+		next = min(next, b.maxSleep)
+	}
+	return next
+}
+
+// StopConditionFunc decides whether to stop retrying a request, given the number of attempts made so far and the
+// time elapsed since the request started.
+type StopConditionFunc func(attempt int, elapsed time.Duration) bool
+
+// WithStopCondition makes the RoundTripper consult stopCondition before each wait for a retry and stop retrying once
+// it returns true, e.g. once a dependent signal fires. It adds to BackOffPolicy.MaxRetries and MaxElapsedTime, so
+// retrying stops as soon as any of them says so; the result of the last attempt is returned as if retries ran out.
+func WithStopCondition(stopCondition StopConditionFunc) Option {
+	return func(p *RoundTripper) {
+		p.stopCondition = stopCondition
+	}
+}
+
+// stopConditionBackOff stops retrying once the stop condition is met.
+type stopConditionBackOff struct {
+	backoff.BackOff
+	stopCondition StopConditionFunc
+	state         *retryState
+}
+
+// NextBackOff returns the wrapped backoff delay, or backoff.Stop if the stop condition is met.
+func (b *stopConditionBackOff) NextBackOff() time.Duration {
+	next := b.BackOff.NextBackOff()
+	if next == backoff.Stop || !b.stopCondition(int(b.state.attempts), time.Since(b.state.start)) {
+		return next
+	}
+	return backoff.Stop
+}
+
+// WithImmediateRetry retries failures that immediate reports true for without any delay, for failures that resolve
+// instantly, such as a refused connection while a rolling restart moves on to the next instance. Other failures
+// back off as usual. At most maxImmediate retries of a request are made immediately, so that a persistent failure
+// does not turn into a tight loop; later ones back off. Immediate retries count against BackOffPolicy.MaxRetries,
+// and a delay requested by Retry-After or raised to BackOffPolicy.MinInterval takes precedence.
+func WithImmediateRetry(immediate ShouldRetryFunc, maxImmediate int) Option {
+	return func(p *RoundTripper) {
+		p.immediateRetryFunc = immediate
+		p.maxImmediateRetries = maxImmediate
+	}
+}
+
+// immediateRetryBackOff retries failures classified as immediate without delay, up to a limit.
+type immediateRetryBackOff struct {
+	backoff.BackOff
+	immediate    ShouldRetryFunc
+	maxImmediate int
+	state        *retryState
+	immediates   int
+}
+
+// NextBackOff returns 0 for immediate failures while the limit allows, and the wrapped backoff delay otherwise.
+// Immediate retries leave the wrapped backoff untouched, so the delays of later failures start at InitialInterval.
+func (b *immediateRetryBackOff) NextBackOff() time.Duration {
+	if b.immediates >= b.maxImmediate || !b.immediate(b.state.req, b.state.resp, b.state.err) {
+		return b.BackOff.NextBackOff()
+	}
+	b.immediates++
+	return 0
+}
+
+// LoadMultiplierFunc maps the load reported by a server to the factor its backoff delay is multiplied with.
+type LoadMultiplierFunc func(load float64) float64
+
+// WithLoadScaledBackOff scales the backoff delay by the load reported by the server in the numeric response
+// header, e.g. X-Server-Load: 0.9, so clients back off further from busy servers. The delay is multiplied by
+// multiplierFunc(load), clamped to [minMultiplier, maxMultiplier]. If multiplierFunc is nil, 1+load is used.
+// Responses without a parseable header, and loads or multipliers that are NaN or infinite, keep the computed delay.
+func WithLoadScaledBackOff(header string, multiplierFunc LoadMultiplierFunc, minMultiplier, maxMultiplier float64) Option {
+	if multiplierFunc == nil {
+		multiplierFunc = func(load float64) float64 {
+			return 1 + load
+		}
+	}
+	return func(p *RoundTripper) {
+		p.loadScale = &loadScale{
+			header:         header,
+			multiplierFunc: multiplierFunc,
+			minMultiplier:  minMultiplier,
+			maxMultiplier:  maxMultiplier,
+		}
+	}
+}
+
+// loadScale holds the configuration of WithLoadScaledBackOff.
+type loadScale struct {
+	header         string
+	multiplierFunc LoadMultiplierFunc
+	minMultiplier  float64
+	maxMultiplier  float64
+}
+
+// loadBackOff scales the wrapped backoff delay by the load reported in the latest response.
+type loadBackOff struct {
+	backoff.BackOff
+	scale *loadScale
+	state *retryState
+}
+
+// NextBackOff returns the wrapped backoff delay multiplied by the clamped load multiplier.
+func (b *loadBackOff) NextBackOff() time.Duration {
+	next := b.BackOff.NextBackOff()
+	if next == backoff.Stop || b.state.resp == nil {
+		return next
+	}
+	load, err := strconv.ParseFloat(b.state.resp.Header.Get(b.scale.header), 64)
+	if err != nil || !isFinite(load) {
+		return next
+	}
+	multiplier := b.scale.multiplierFunc(load)
+	if !isFinite(multiplier) {
+		return next
+	}
+	multiplier = min(max(multiplier, b.scale.minMultiplier), b.scale.maxMultiplier)
+	if scaled := float64(next) * multiplier; scaled < math.MaxInt64 {
+		return time.Duration(scaled)
+	}
+	return math.MaxInt64
+}
+
+// isFinite reports whether f is neither NaN nor infinite.
+func isFinite(f float64) bool {
+	return !math.IsNaN(f) && !math.IsInf(f, 0)
+}
+
+// AfterFunc waits for the duration to elapse and then sends the current time on the returned channel, like
+// time.After.
+type AfterFunc func(d time.Duration) <-chan time.Time
+
+// WithAfter waits between attempts with after instead of time.After, for custom time sources such as
+// simulations, deterministic schedulers, or fake clocks in tests such as retrytest.FakeClock. It covers every
+// wait between attempts, including those requested by Retry-After; MaxElapsedTime is still measured with the
+// system clock.
+func WithAfter(after AfterFunc) Option {
+	return func(p *RoundTripper) {
+		p.after = after
+	}
+}
+
+// timer returns the timer used for the waits between attempts, or nil for the default one.
+func (p *RoundTripper) timer() backoff.Timer {
+	if p.after == nil {
+		return nil
+	}
+	return &afterTimer{after: p.after}
+}
+
+// afterTimer implements backoff.Timer with an AfterFunc.
+type afterTimer struct {
+	after AfterFunc
+	c     <-chan time.Time
+}
+
+func (t *afterTimer) Start(d time.Duration) {
+	t.c = t.after(d)
+}
+
+// Stop does nothing, since the channel of an AfterFunc cannot be stopped; it is left to be collected.
+func (t *afterTimer) Stop() {}
+
+func (t *afterTimer) C() <-chan time.Time {
+	return t.c
+}
+
+// SuggestMaxRetries returns the smallest BackOffPolicy.MaxRetries with which a request succeeds with at least the
+// probability targetSuccess, given the probability failureRate that a single attempt fails, e.g. 2 for a failure
+// rate of 0.1 and a target of 0.999. It assumes that attempts fail independently of each other with the same
+// probability, which correlated failures such as an outage violate, so the result is a lower bound. It returns 0
+// if a single attempt meets the target, and math.MaxUint64 if no number of retries does, i.e. if failureRate or
+// targetSuccess is 1 or more.
+func SuggestMaxRetries(failureRate, targetSuccess float64) uint64 {
+	if failureRate <= 0 || targetSuccess <= 1-failureRate {
+		return 0
+	}
+	if failureRate >= 1 || targetSuccess >= 1 {
+		return math.MaxUint64
+	}
+	// All of n attempts fail with the probability failureRate^n, which must not exceed 1-targetSuccess.
+	// The small tolerance keeps rounding errors from asking for an extra attempt when the target is met exactly.
+	attempts := math.Ceil(math.Log(1-targetSuccess)/math.Log(failureRate) - 1e-9)
+	return uint64(attempts) - 1
+}
@@ -0,0 +1,538 @@
+package retryabletransport_test
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"net/http"
+	"slices"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/linzhengen/retryabletransport"
+	"github.com/stretchr/testify/assert"
+)
+
+// firstRetryDelay returns the delay the RoundTripper built from opts picks before retrying resp the first time.
+// The request is canceled from the notification, so no time is spent waiting.
+func firstRetryDelay(t *testing.T, resp *http.Response, opts ...retryabletransport.Option) time.Duration {
+	t.Helper()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	var delay time.Duration
+	rt := retryabletransport.New(
+		roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+			return resp, nil
+		}),
+		nil,
+		func(ctx context.Context, err error, duration time.Duration) {
+			delay = duration
+			cancel()
+		},
+		&retryabletransport.BackOffPolicy{MaxRetries: 1},
+		opts...,
+	)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, "http://example.com", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, _ = rt.RoundTrip(req)
+	return delay
+}
+
+func Test_WithLoadScaledBackOff(t *testing.T) {
+	type test struct {
+		name     string
+		load     string
+		opt      retryabletransport.Option
+		minDelay time.Duration
+		maxDelay time.Duration
+	}
+	tests := []test{
+		{
+			name:     "missing header keeps the delay",
+			minDelay: 250 * time.Millisecond,
+			maxDelay: 750 * time.Millisecond,
+		},
+		{
+			name:     "load scales the delay",
+			load:     "0.5",
+			minDelay: 375 * time.Millisecond,
+			maxDelay: 1125 * time.Millisecond,
+		},
+		{
+			name:     "multiplier is clamped",
+			load:     "9",
+			minDelay: 500 * time.Millisecond,
+			maxDelay: 1500 * time.Millisecond,
+		},
+		{
+			name:     "NaN load keeps the delay",
+			load:     "NaN",
+			minDelay: 250 * time.Millisecond,
+			maxDelay: 750 * time.Millisecond,
+		},
+		{
+			name:     "infinite load keeps the delay",
+			load:     "-Inf",
+			minDelay: 250 * time.Millisecond,
+			maxDelay: 750 * time.Millisecond,
+		},
+		{
+			name: "NaN multiplier keeps the delay",
+			load: "0.5",
+			opt: retryabletransport.WithLoadScaledBackOff("X-Server-Load", func(load float64) float64 {
+				return math.NaN()
+			}, 1, 2),
+			minDelay: 250 * time.Millisecond,
+			maxDelay: 750 * time.Millisecond,
+		},
+		{
+			name:     "overflowing delay is capped at the maximum duration",
+			load:     "1",
+			opt:      retryabletransport.WithLoadScaledBackOff("X-Server-Load", nil, math.MaxFloat64, math.MaxFloat64),
+			minDelay: math.MaxInt64,
+			maxDelay: math.MaxInt64,
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			resp := &http.Response{StatusCode: http.StatusServiceUnavailable, Header: http.Header{}}
+			if tc.load != "" {
+				resp.Header.Set("X-Server-Load", tc.load)
+			}
+			opt := tc.opt
+			if opt == nil {
+				opt = retryabletransport.WithLoadScaledBackOff("X-Server-Load", nil, 1, 2)
+			}
+			delay := firstRetryDelay(t, resp, opt)
+			assert.GreaterOrEqual(t, delay, tc.minDelay)
+			assert.LessOrEqual(t, delay, tc.maxDelay)
+		})
+	}
+}
+
+func Test_BackOffPolicy_CeilingInterval(t *testing.T) {
+	var delays []time.Duration
+	rt := retryabletransport.New(
+		roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+			return &http.Response{StatusCode: http.StatusServiceUnavailable}, nil
+		}),
+		nil,
+		func(ctx context.Context, err error, duration time.Duration) {
+			delays = append(delays, duration)
+		},
+		&retryabletransport.BackOffPolicy{
+			MaxRetries:      5,
+			InitialInterval: 10 * time.Millisecond,
+			Multiplier:      2,
+			CeilingInterval: 40 * time.Millisecond,
+		},
+	)
+	req, err := http.NewRequest(http.MethodGet, "http://example.com", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, _ = rt.RoundTrip(req)
+	if assert.Len(t, delays, 5) {
+		for _, d := range delays[:2] {
+			assert.LessOrEqual(t, d, 40*time.Millisecond)
+		}
+		for _, d := range delays[2:] {
+			assert.Equal(t, 40*time.Millisecond, d, "delays are constant once the ceiling is reached")
+		}
+	}
+}
+
+func Test_BackOffPolicy_CeilingInterval_AboveMaxInterval(t *testing.T) {
+	var delays []time.Duration
+	rt := retryabletransport.New(
+		roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+			return &http.Response{StatusCode: http.StatusServiceUnavailable}, nil
+		}),
+		nil,
+		func(ctx context.Context, err error, duration time.Duration) {
+			delays = append(delays, duration)
+		},
+		&retryabletransport.BackOffPolicy{
+			MaxRetries:          6,
+			InitialInterval:     100 * time.Millisecond,
+			MaxInterval:         200 * time.Millisecond,
+			Multiplier:          2,
+			RandomizationFactor: -1,
+			CeilingInterval:     time.Second,
+		},
+		retryabletransport.WithAfter(func(d time.Duration) <-chan time.Time {
+			c := make(chan time.Time, 1)
+			c <- time.Now()
+			return c
+		}),
+	)
+	req, err := http.NewRequest(http.MethodGet, "http://example.com", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, _ = rt.RoundTrip(req)
+	assert.Equal(t, []time.Duration{
+		100 * time.Millisecond,
+		200 * time.Millisecond,
+		200 * time.Millisecond,
+		200 * time.Millisecond,
+		200 * time.Millisecond,
+		200 * time.Millisecond,
+	}, delays)
+}
+
+func Test_BackOffPolicy_AbsoluteMaxSleep(t *testing.T) {
+	var delays []time.Duration
+	rt := retryabletransport.New(
+		roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+			resp := &http.Response{StatusCode: http.StatusServiceUnavailable, Header: http.Header{}}
+			resp.Header.Set("X-Server-Load", "1")
+			return resp, nil
+		}),
+		nil,
+		func(ctx context.Context, err error, duration time.Duration) {
+			delays = append(delays, duration)
+		},
+		&retryabletransport.BackOffPolicy{
+			MaxRetries:          50,
+			InitialInterval:     time.Second,
+			MaxInterval:         time.Second,
+			RandomizationFactor: 0.99,
+			AbsoluteMaxSleep:    time.Second,
+		},
+		// Both jitter and load scaling push delays above MaxInterval.
+		retryabletransport.WithLoadScaledBackOff("X-Server-Load", nil, 1, 4),
+		retryabletransport.WithAfter(func(d time.Duration) <-chan time.Time {
+			c := make(chan time.Time, 1)
+			c <- time.Now()
+			return c
+		}),
+	)
+	req, err := http.NewRequest(http.MethodGet, "http://example.com", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, _ = rt.RoundTrip(req)
+	if assert.Len(t, delays, 50) {
+		for _, d := range delays {
+			assert.LessOrEqual(t, d, time.Second)
+		}
+		assert.Contains(t, delays, time.Second, "capped delays must be clamped to the bound")
+	}
+}
+
+func Test_BackOffPolicy_AbsoluteMaxSleep_RetryAfter(t *testing.T) {
+	var delays []time.Duration
+	rt := retryabletransport.New(
+		roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+			resp := &http.Response{StatusCode: http.StatusTooManyRequests, Header: http.Header{}, Body: http.NoBody}
+			resp.Header.Set("Retry-After", "60")
+			return resp, nil
+		}),
+		nil,
+		func(ctx context.Context, err error, duration time.Duration) {
+			delays = append(delays, duration)
+		},
+		&retryabletransport.BackOffPolicy{MaxRetries: 2, AbsoluteMaxSleep: 10 * time.Millisecond},
+		retryabletransport.WithRetryAfter(),
+		retryabletransport.WithRetryAfterJitter(0.5),
+	)
+	req, err := http.NewRequest(http.MethodGet, "http://example.com", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, _ = rt.RoundTrip(req)
+	assert.Equal(t, []time.Duration{10 * time.Millisecond, 10 * time.Millisecond}, delays,
+		"delays requested by Retry-After must be capped too")
+}
+
+func Test_BackOffPolicy_MaxElapsedTime(t *testing.T) {
+	calledCount := 0
+	rt := retryabletransport.New(
+		roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+			calledCount++
+			time.Sleep(50 * time.Millisecond)
+			return &http.Response{StatusCode: http.StatusServiceUnavailable, Body: http.NoBody}, nil
+		}),
+		nil,
+		nil,
+		&retryabletransport.BackOffPolicy{
+			MaxRetries:      10,
+			InitialInterval: time.Millisecond,
+			MaxElapsedTime:  75 * time.Millisecond,
+		},
+	)
+	req, err := http.NewRequest(http.MethodGet, "http://example.com", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := rt.RoundTrip(req)
+	if assert.NoError(t, err) {
+		assert.Equal(t, http.StatusServiceUnavailable, resp.StatusCode)
+	}
+	// The first attempt counts against MaxElapsedTime, so the second one ends past it.
+	assert.Equal(t, 2, calledCount)
+}
+
+func Test_BackOffPolicy_MinInterval(t *testing.T) {
+	var delays []time.Duration
+	rt := retryabletransport.New(
+		roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+			return &http.Response{StatusCode: http.StatusServiceUnavailable, Body: http.NoBody}, nil
+		}),
+		nil,
+		func(ctx context.Context, err error, duration time.Duration) {
+			delays = append(delays, duration)
+		},
+		&retryabletransport.BackOffPolicy{
+			MaxRetries:          50,
+			InitialInterval:     time.Millisecond,
+			MaxInterval:         200 * time.Millisecond,
+			RandomizationFactor: 0.99,
+			FirstRetryImmediate: true,
+			MinInterval:         100 * time.Millisecond,
+		},
+		retryabletransport.WithAfter(func(d time.Duration) <-chan time.Time {
+			c := make(chan time.Time, 1)
+			c <- time.Now()
+			return c
+		}),
+	)
+	req, err := http.NewRequest(http.MethodGet, "http://example.com", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, _ = rt.RoundTrip(req)
+	if assert.Len(t, delays, 50) {
+		for _, d := range delays {
+			assert.GreaterOrEqual(t, d, 100*time.Millisecond)
+		}
+		assert.Equal(t, 100*time.Millisecond, delays[0], "the immediate first retry must be raised to the floor")
+		assert.Greater(t, slices.Max(delays), 100*time.Millisecond, "delays above the floor must be kept")
+	}
+}
+
+func Test_WithImmediateRetry(t *testing.T) {
+	type test struct {
+		name       string
+		err        error
+		wantDelays []time.Duration
+	}
+	tests := []test{
+		{
+			name:       "immediate failures are retried without delay up to the limit",
+			err:        fmt.Errorf("dial: %w", syscall.ECONNREFUSED),
+			wantDelays: []time.Duration{0, 0, 10 * time.Millisecond, 15 * time.Millisecond},
+		},
+		{
+			name:       "other failures back off",
+			err:        syscall.ECONNRESET,
+			wantDelays: []time.Duration{10 * time.Millisecond, 15 * time.Millisecond, 22500 * time.Microsecond, 33750 * time.Microsecond},
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			calledCount := 0
+			var delays []time.Duration
+			rt := retryabletransport.New(
+				roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+					calledCount++
+					if calledCount <= 4 {
+						return nil, tc.err
+					}
+					return &http.Response{StatusCode: http.StatusOK, Body: http.NoBody}, nil
+				}),
+				nil,
+				func(ctx context.Context, err error, duration time.Duration) {
+					delays = append(delays, duration)
+				},
+				&retryabletransport.BackOffPolicy{MaxRetries: 4, InitialInterval: 10 * time.Millisecond, RandomizationFactor: -1},
+				retryabletransport.WithImmediateRetry(retryabletransport.RetryOnConnectError(), 2),
+			)
+			req, err := http.NewRequest(http.MethodGet, "http://example.com", nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			resp, err := rt.RoundTrip(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			assert.Equal(t, http.StatusOK, resp.StatusCode)
+			assert.Equal(t, tc.wantDelays, delays)
+		})
+	}
+}
+
+func Test_WithStopCondition(t *testing.T) {
+	type test struct {
+		name          string
+		stopCondition retryabletransport.StopConditionFunc
+		wantAttempts  int
+	}
+	tests := []test{
+		{
+			name: "stops after the given attempts",
+			stopCondition: func(attempt int, elapsed time.Duration) bool {
+				return attempt >= 3
+			},
+			wantAttempts: 3,
+		},
+		{
+			name: "stops once time has elapsed",
+			stopCondition: func(attempt int, elapsed time.Duration) bool {
+				return elapsed >= 50*time.Millisecond
+			},
+			wantAttempts: 3,
+		},
+		{
+			name: "MaxRetries still applies",
+			stopCondition: func(attempt int, elapsed time.Duration) bool {
+				return false
+			},
+			wantAttempts: 6,
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			calledCount := 0
+			rt := retryabletransport.New(
+				roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+					calledCount++
+					time.Sleep(20 * time.Millisecond)
+					return &http.Response{StatusCode: http.StatusServiceUnavailable}, nil
+				}),
+				nil,
+				nil,
+				&retryabletransport.BackOffPolicy{MaxRetries: 5, InitialInterval: time.Microsecond},
+				retryabletransport.WithStopCondition(tc.stopCondition),
+			)
+			req, err := http.NewRequest(http.MethodGet, "http://example.com", nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			resp, err := rt.RoundTrip(req)
+			assert.NoError(t, err)
+			assert.Equal(t, http.StatusServiceUnavailable, resp.StatusCode)
+			assert.Equal(t, tc.wantAttempts, calledCount)
+		})
+	}
+}
+
+func Test_BackOffPolicy_FirstRetryImmediate(t *testing.T) {
+	var delays []time.Duration
+	rt := retryabletransport.New(
+		roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+			return &http.Response{StatusCode: http.StatusServiceUnavailable}, nil
+		}),
+		nil,
+		func(ctx context.Context, err error, duration time.Duration) {
+			delays = append(delays, duration)
+		},
+		&retryabletransport.BackOffPolicy{
+			MaxRetries:          2,
+			InitialInterval:     20 * time.Millisecond,
+			RandomizationFactor: -1,
+			FirstRetryImmediate: true,
+		},
+	)
+	req, err := http.NewRequest(http.MethodGet, "http://example.com", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, _ = rt.RoundTrip(req)
+	assert.Equal(t, []time.Duration{0, 20 * time.Millisecond}, delays)
+}
+
+func Test_WithAfter(t *testing.T) {
+	var waits []time.Duration
+	fakeAfter := func(d time.Duration) <-chan time.Time {
+		waits = append(waits, d)
+		c := make(chan time.Time, 1)
+		c <- time.Now().Add(d)
+		return c
+	}
+	calledCount := 0
+	rt := retryabletransport.New(
+		roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+			calledCount++
+			resp := &http.Response{StatusCode: http.StatusServiceUnavailable, Header: http.Header{}}
+			if calledCount == 2 {
+				resp.Header.Set("Retry-After", "120")
+			}
+			return resp, nil
+		}),
+		nil,
+		nil,
+		&retryabletransport.BackOffPolicy{
+			MaxRetries:          2,
+			InitialInterval:     time.Minute,
+			RandomizationFactor: -1,
+		},
+		retryabletransport.WithAfter(fakeAfter),
+		retryabletransport.WithRetryAfter(),
+	)
+	req, err := http.NewRequest(http.MethodGet, "http://example.com", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	start := time.Now()
+	_, _ = rt.RoundTrip(req)
+	assert.Less(t, time.Since(start), time.Second)
+	assert.Equal(t, 3, calledCount)
+	assert.Equal(t, []time.Duration{time.Minute, 2 * time.Minute}, waits)
+}
+
+func Test_SuggestMaxRetries(t *testing.T) {
+	type test struct {
+		name          string
+		failureRate   float64
+		targetSuccess float64
+		want          uint64
+	}
+	tests := []test{
+		{
+			name:          "target met exactly",
+			failureRate:   0.1,
+			targetSuccess: 0.999,
+			want:          2,
+		},
+		{
+			name:          "target between two counts is rounded up",
+			failureRate:   0.5,
+			targetSuccess: 0.99,
+			want:          6,
+		},
+		{
+			name:          "single attempt meets the target",
+			failureRate:   0.01,
+			targetSuccess: 0.95,
+			want:          0,
+		},
+		{
+			name:          "attempts never fail",
+			failureRate:   0,
+			targetSuccess: 0.999,
+			want:          0,
+		},
+		{
+			name:          "attempts always fail",
+			failureRate:   1,
+			targetSuccess: 0.9,
+			want:          math.MaxUint64,
+		},
+		{
+			name:          "certain success is unreachable",
+			failureRate:   0.1,
+			targetSuccess: 1,
+			want:          math.MaxUint64,
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.want, retryabletransport.SuggestMaxRetries(tc.failureRate, tc.targetSuccess))
+		})
+	}
+}
@@ -0,0 +1,203 @@
+package retryabletransport
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+	"sync/atomic"
+)
+
+// WithStreamingBody streams request bodies to the first attempt instead of buffering them up front, recording the
+// bytes read for replay on retries. This saves the up-front buffering latency for large bodies when the first
+// attempt succeeds; the body still ends up fully in memory once it has been sent. A retry replays the recorded
+// bytes followed by whatever the previous attempt did not read yet. Once RoundTrip returned, GetBody of the request,
+// as used by an *http.Client following a redirect, replays the body only if it was read to its end, and fails
+// otherwise.
+func WithStreamingBody() Option {
+	return func(p *RoundTripper) {
+		p.streamBody = true
+	}
+}
+
+// WithoutBodyBuffering sends request bodies as-is instead of buffering them, for inner transports that handle
+// replay themselves or requests whose bodies are too large to hold in memory. Requests providing GetBody are
+// replayed through it, as they are by default; requests without GetBody are sent once and never retried, since
+// their body is consumed by the first attempt, and fail if they should be with StrictBodyReplay. It takes
+// precedence over WithStreamingBody and WithBodyBufferPool.
+//
+// An inner *http.Transport already retries idempotent requests, and requests with an idempotency key, that lost
+// the race with a server closing an idle connection before any of the response arrived, rewinding their body
+// through GetBody. Such retries happen within a single attempt of the RoundTripper and do not count against
+// BackOffPolicy.MaxRetries; the RoundTripper only retries what the inner transport reports as failed.
+func WithoutBodyBuffering() Option {
+	return func(p *RoundTripper) {
+		p.noBodyBuffering = true
+	}
+}
+
+// StrictBodyReplay makes the RoundTripper fail with BodyNotReplayableError when shouldRetryFunc retries an attempt
+// whose request body cannot be replayed, as happens with WithoutBodyBuffering for requests without GetBody, instead
+// of returning the result of that attempt. This surfaces configuration mistakes that would otherwise silently
+// disable retries. The response of the attempt, if any, is closed.
+func StrictBodyReplay() Option {
+	return func(p *RoundTripper) {
+		p.strictBodyReplay = true
+	}
+}
+
+// bodyNotReplayable discards the result of the latest attempt of state and returns the BodyNotReplayableError
+// for it.
+func (p *RoundTripper) bodyNotReplayable(state *retryState) error {
+	err := state.err
+	if err == nil {
+		err = fmt.Errorf("last attempt got status %d", state.resp.StatusCode)
+	}
+	drainBody(state.resp, p.drainLimit())
+	state.resp = nil
+	return fmt.Errorf("%w: %w", BodyNotReplayableError, err)
+}
+
+// countingBody counts the bytes read from the wrapped body into n.
+type countingBody struct {
+	io.ReadCloser
+	n *atomic.Int64
+}
+
+func (b *countingBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	b.n.Add(int64(n))
+	return n, err
+}
+
+// errStaleBody is returned when reading the body of an attempt that has been superseded by a retry.
+var errStaleBody = errors.New("request body was replaced by a retry")
+
+// errBodyFinished is returned by GetBody of a streamed body that RoundTrip returned before it was read to its end,
+// since its source may be closed by then.
+var errBodyFinished = errors.New("streamed request body cannot be replayed after RoundTrip returned")
+
+// teeBody streams a request body while recording it, so that every attempt can read it from the start.
+// Only the reader of the latest attempt may read; readers of earlier attempts fail with errStaleBody.
+// The source is read without holding the lock, so that Close and new readers do not wait for a blocking read.
+type teeBody struct {
+	mu       sync.Mutex
+	cond     *sync.Cond
+	src      io.ReadCloser
+	srcErr   error
+	buf      bytes.Buffer
+	gen      int
+	closed   bool
+	finished bool
+	// reading is set while a reader reads from the source.
+	reading bool
+}
+
+// newTeeBody creates a new teeBody reading from src.
+func newTeeBody(src io.ReadCloser) *teeBody {
+	b := &teeBody{src: src}
+	b.cond = sync.NewCond(&b.mu)
+	return b
+}
+
+// newReader returns a reader for the next attempt, superseding all earlier readers.
+func (b *teeBody) newReader() io.ReadCloser {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.nextReader()
+}
+
+// nextReader returns a reader superseding all earlier readers. b.mu must be held.
+func (b *teeBody) nextReader() *teeBodyReader {
+	b.gen++
+	b.closed = false
+	return &teeBodyReader{body: b, gen: b.gen}
+}
+
+// getBody implements GetBody of the request. Once no more attempts follow, the source is not read anymore: a body
+// recorded to its end, e.g. for a redirect, is replayed from the recording, and GetBody fails with errBodyFinished
+// otherwise.
+func (b *teeBody) getBody() (io.ReadCloser, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if !b.finished {
+		return b.nextReader(), nil
+	}
+	if b.srcErr != io.EOF || b.reading {
+		return nil, errBodyFinished
+	}
+	return io.NopCloser(bytes.NewReader(b.buf.Bytes())), nil
+}
+
+// finish marks that no more attempts follow. The source is closed once the last reader is.
+func (b *teeBody) finish() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.finished = true
+	if b.closed {
+		_ = b.src.Close()
+	}
+}
+
+// teeBodyReader reads a teeBody from the start on behalf of a single attempt.
+type teeBodyReader struct {
+	body *teeBody
+	gen  int
+	off  int
+}
+
+// Read serves the recorded bytes first and records further bytes as it reads them from the source.
+func (r *teeBodyReader) Read(p []byte) (int, error) {
+	b := r.body
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for {
+		if r.gen != b.gen {
+			return 0, errStaleBody
+		}
+		if r.off < b.buf.Len() {
+			n := copy(p, b.buf.Bytes()[r.off:])
+			r.off += n
+			return n, nil
+		}
+		if b.srcErr != nil {
+			return 0, b.srcErr
+		}
+		if !b.reading {
+			break
+		}
+		// A superseded reader is still reading from the source; its bytes are recorded for this one.
+		b.cond.Wait()
+	}
+	b.reading = true
+	b.mu.Unlock()
+	n, err := b.src.Read(p)
+	b.mu.Lock()
+	b.reading = false
+	b.cond.Broadcast()
+	b.buf.Write(p[:n])
+	if err != nil {
+		b.srcErr = err
+	}
+	if r.gen != b.gen {
+		return 0, errStaleBody
+	}
+	r.off += n
+	return n, err
+}
+
+// Close closes the source if the reader belongs to the last attempt.
+func (r *teeBodyReader) Close() error {
+	b := r.body
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if r.gen != b.gen || b.closed {
+		return nil
+	}
+	b.closed = true
+	if b.finished {
+		return b.src.Close()
+	}
+	return nil
+}
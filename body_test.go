@@ -0,0 +1,611 @@
+package retryabletransport_test
+
+import (
+	"errors"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/linzhengen/retryabletransport"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_WithStreamingBody(t *testing.T) {
+	pr, pw := io.Pipe()
+	firstChunkRead := make(chan struct{})
+	go func() {
+		_, _ = pw.Write([]byte("hello "))
+		select {
+		case <-firstChunkRead:
+			_, _ = pw.Write([]byte("world"))
+			_ = pw.Close()
+		case <-time.After(2 * time.Second):
+			_ = pw.CloseWithError(errors.New("body was not streamed"))
+		}
+	}()
+
+	var bodies []string
+	rt := retryabletransport.New(
+		roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+			defer req.Body.Close()
+			if len(bodies) == 0 {
+				// The first attempt fails after reading only the first chunk, which is all
+				// that has been written yet: the body must be streamed, not pre-buffered.
+				b := make([]byte, len("hello "))
+				_, err := io.ReadFull(req.Body, b)
+				if err != nil {
+					t.Error(err)
+				}
+				bodies = append(bodies, string(b))
+				close(firstChunkRead)
+				return nil, syscall.ECONNREFUSED
+			}
+			b, err := io.ReadAll(req.Body)
+			if err != nil {
+				t.Error(err)
+			}
+			bodies = append(bodies, string(b))
+			return &http.Response{StatusCode: http.StatusOK}, nil
+		}),
+		nil,
+		nil,
+		&retryabletransport.BackOffPolicy{MaxRetries: 1, InitialInterval: time.Millisecond},
+		retryabletransport.WithStreamingBody(),
+	)
+	req, err := http.NewRequest(http.MethodPost, "http://example.com", pr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := rt.RoundTrip(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, []string{"hello ", "hello world"}, bodies)
+}
+
+func Test_WithStreamingBody_BlockedRead(t *testing.T) {
+	pr, pw := io.Pipe()
+	reading := make(chan struct{})
+	staleRead := make(chan error, 1)
+	retried := make(chan struct{})
+	var retryBody string
+	rt := retryabletransport.New(
+		roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+			select {
+			case <-reading:
+			default:
+				// The first attempt leaves a read of the body blocked on the source behind, as a transport
+				// still writing the request would.
+				close(reading)
+				go func() {
+					_, err := io.ReadAll(req.Body)
+					staleRead <- err
+				}()
+				return nil, syscall.ECONNREFUSED
+			}
+			close(retried)
+			b, err := io.ReadAll(req.Body)
+			if err != nil {
+				t.Error(err)
+			}
+			retryBody = string(b)
+			return &http.Response{StatusCode: http.StatusOK, Body: http.NoBody}, nil
+		}),
+		nil,
+		nil,
+		&retryabletransport.BackOffPolicy{MaxRetries: 1, InitialInterval: time.Millisecond},
+		retryabletransport.WithStreamingBody(),
+	)
+	req, err := http.NewRequest(http.MethodPost, "http://example.com", pr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		resp, err := rt.RoundTrip(req)
+		if assert.NoError(t, err) {
+			assert.Equal(t, http.StatusOK, resp.StatusCode)
+		}
+	}()
+	select {
+	case <-retried:
+	case <-time.After(2 * time.Second):
+		t.Fatal("the retry must not wait for the blocked read of the first attempt")
+	}
+	_, _ = pw.Write([]byte("payload"))
+	_ = pw.Close()
+	<-done
+	assert.Equal(t, "payload", retryBody)
+	assert.ErrorContains(t, <-staleRead, "replaced by a retry")
+
+	body, err := req.GetBody()
+	if assert.NoError(t, err, "a body recorded to its end is replayed after RoundTrip returned") {
+		b, _ := io.ReadAll(body)
+		assert.Equal(t, "payload", string(b))
+	}
+}
+
+func Test_WithStreamingBody_GetBodyAfterRoundTrip(t *testing.T) {
+	rt := retryabletransport.New(
+		roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+			// The body is not read to its end.
+			return &http.Response{StatusCode: http.StatusOK, Body: http.NoBody}, nil
+		}),
+		nil,
+		nil,
+		nil,
+		retryabletransport.WithStreamingBody(),
+	)
+	req, err := http.NewRequest(http.MethodPost, "http://example.com", io.NopCloser(strings.NewReader("payload")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := rt.RoundTrip(req); err != nil {
+		t.Fatal(err)
+	}
+	_, err = req.GetBody()
+	assert.ErrorContains(t, err, "cannot be replayed after RoundTrip returned")
+}
+
+func Test_RoundTripper_RoundTrip_MultipartBody(t *testing.T) {
+	type attempt struct {
+		contentType   string
+		contentLength int64
+		field         string
+		file          string
+	}
+	var attempts []attempt
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		a := attempt{contentType: r.Header.Get("Content-Type"), contentLength: r.ContentLength}
+		if err := r.ParseMultipartForm(1 << 20); err != nil {
+			t.Error(err)
+			return
+		}
+		a.field = r.FormValue("field")
+		f, _, err := r.FormFile("file")
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		b, err := io.ReadAll(f)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		a.file = string(b)
+		attempts = append(attempts, a)
+		if len(attempts) == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer server.Close()
+
+	// The form is streamed through a pipe, so its length is unknown when the request is built.
+	pr, pw := io.Pipe()
+	mw := multipart.NewWriter(pw)
+	go func() {
+		_ = mw.WriteField("field", "value")
+		fw, err := mw.CreateFormFile("file", "file.txt")
+		if err != nil {
+			_ = pw.CloseWithError(err)
+			return
+		}
+		_, _ = fw.Write([]byte("file content"))
+		_ = pw.CloseWithError(mw.Close())
+	}()
+	client := &http.Client{
+		Transport: retryabletransport.New(
+			nil,
+			nil,
+			nil,
+			&retryabletransport.BackOffPolicy{MaxRetries: 1, InitialInterval: time.Millisecond},
+		),
+	}
+	req, err := http.NewRequest(http.MethodPost, server.URL, pr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Content-Type", mw.FormDataContentType())
+	resp, err := client.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	if assert.Len(t, attempts, 2) {
+		for _, a := range attempts {
+			assert.Equal(t, mw.FormDataContentType(), a.contentType)
+			assert.Greater(t, a.contentLength, int64(0))
+			assert.Equal(t, "value", a.field)
+			assert.Equal(t, "file content", a.file)
+		}
+	}
+}
+
+func Test_RoundTripper_RoundTrip_GetBody(t *testing.T) {
+	var bodies []string
+	rt := retryabletransport.New(
+		roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+			b, err := io.ReadAll(req.Body)
+			if err != nil {
+				return nil, err
+			}
+			bodies = append(bodies, string(b))
+			if len(bodies) == 1 {
+				return &http.Response{StatusCode: http.StatusServiceUnavailable, Body: http.NoBody}, nil
+			}
+			return &http.Response{StatusCode: http.StatusOK, Body: http.NoBody}, nil
+		}),
+		nil,
+		nil,
+		&retryabletransport.BackOffPolicy{MaxRetries: 1, InitialInterval: time.Millisecond},
+	)
+	req, err := http.NewRequest(http.MethodPut, "http://example.com", strings.NewReader("hello"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	getBodyCalls := 0
+	getBody := req.GetBody
+	req.GetBody = func() (io.ReadCloser, error) {
+		getBodyCalls++
+		return getBody()
+	}
+	resp, err := rt.RoundTrip(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, []string{"hello", "hello"}, bodies)
+	// The first attempt sends the body as-is, the retry replays it through GetBody.
+	assert.Equal(t, 1, getBodyCalls)
+}
+
+func Test_RoundTripper_RoundTrip_RedirectReplaysBody(t *testing.T) {
+	type test struct {
+		name    string
+		opts    []retryabletransport.Option
+		getBody bool
+	}
+	tests := []test{
+		{
+			name: "buffered body",
+		},
+		{
+			name: "buffered body with total timeout",
+			opts: []retryabletransport.Option{retryabletransport.WithTotalTimeout(time.Minute)},
+		},
+		{
+			name: "streamed body",
+			opts: []retryabletransport.Option{retryabletransport.WithStreamingBody()},
+		},
+		{
+			name:    "body replayed through GetBody",
+			getBody: true,
+		},
+	}
+	const body = "hello world"
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			// The first attempt is retried, and the retry is redirected.
+			var startCount int
+			var finalBody string
+			mux := http.NewServeMux()
+			mux.HandleFunc("/start", func(w http.ResponseWriter, r *http.Request) {
+				_, _ = io.Copy(io.Discard, r.Body)
+				startCount++
+				if startCount == 1 {
+					w.WriteHeader(http.StatusServiceUnavailable)
+					return
+				}
+				http.Redirect(w, r, "/final", http.StatusTemporaryRedirect)
+			})
+			mux.HandleFunc("/final", func(w http.ResponseWriter, r *http.Request) {
+				b, err := io.ReadAll(r.Body)
+				if err != nil {
+					t.Error(err)
+				}
+				finalBody = string(b)
+			})
+			server := httptest.NewServer(mux)
+			defer server.Close()
+
+			client := &http.Client{
+				Transport: retryabletransport.New(
+					nil,
+					nil,
+					nil,
+					&retryabletransport.BackOffPolicy{MaxRetries: 1, InitialInterval: time.Millisecond},
+					tc.opts...,
+				),
+			}
+			var reqBody io.Reader = strings.NewReader(body)
+			if !tc.getBody {
+				// Hide the concrete type so that http.NewRequest does not set GetBody.
+				reqBody = struct{ io.Reader }{reqBody}
+			}
+			req, err := http.NewRequest(http.MethodPost, server.URL+"/start", reqBody)
+			if err != nil {
+				t.Fatal(err)
+			}
+			resp, err := client.Do(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer resp.Body.Close()
+			assert.Equal(t, http.StatusOK, resp.StatusCode)
+			assert.Equal(t, 2, startCount)
+			assert.Equal(t, body, finalBody)
+		})
+	}
+}
+
+func Test_WithoutBodyBuffering(t *testing.T) {
+	type test struct {
+		name         string
+		getBody      bool
+		wantBodies   []string
+		wantStatus   int
+		wantAttempts uint64
+	}
+	tests := []test{
+		{
+			name:         "body is replayed through GetBody",
+			getBody:      true,
+			wantBodies:   []string{"hello", "hello"},
+			wantStatus:   http.StatusOK,
+			wantAttempts: 2,
+		},
+		{
+			name:         "body without GetBody is sent once",
+			wantBodies:   []string{"hello"},
+			wantStatus:   http.StatusServiceUnavailable,
+			wantAttempts: 1,
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			var bodies []string
+			rt := retryabletransport.New(
+				roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+					b, err := io.ReadAll(req.Body)
+					if err != nil {
+						return nil, err
+					}
+					bodies = append(bodies, string(b))
+					if len(bodies) == 1 {
+						return &http.Response{StatusCode: http.StatusServiceUnavailable, Body: http.NoBody}, nil
+					}
+					return &http.Response{StatusCode: http.StatusOK, Body: http.NoBody}, nil
+				}),
+				nil,
+				nil,
+				&retryabletransport.BackOffPolicy{MaxRetries: 1, InitialInterval: time.Millisecond},
+				retryabletransport.WithoutBodyBuffering(),
+			)
+			var body io.Reader = strings.NewReader("hello")
+			if !tc.getBody {
+				// Hide the concrete type so that http.NewRequest does not set GetBody.
+				body = struct{ io.Reader }{body}
+			}
+			req, err := http.NewRequest(http.MethodPut, "http://example.com", body)
+			if err != nil {
+				t.Fatal(err)
+			}
+			resp, err := rt.RoundTrip(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			assert.Equal(t, tc.wantStatus, resp.StatusCode)
+			assert.Equal(t, tc.wantBodies, bodies)
+			attempts, _ := retryabletransport.AttemptsFromContext(resp.Request.Context())
+			assert.Equal(t, tc.wantAttempts, attempts)
+			if !tc.getBody {
+				assert.Nil(t, req.GetBody, "the body must not be buffered")
+			}
+		})
+	}
+}
+
+func Test_RoundTripper_RoundTrip_InnerTransportRetries(t *testing.T) {
+	type test struct {
+		name string
+		opts []retryabletransport.Option
+	}
+	tests := []test{
+		{
+			name: "buffered body",
+		},
+		{
+			name: "body replayed through GetBody without buffering",
+			opts: []retryabletransport.Option{retryabletransport.WithoutBodyBuffering()},
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			// The inner transport retries its first send itself by rewinding the body through GetBody, like
+			// *http.Transport does for a lost idle connection race, and then fails the attempt.
+			var sends []string
+			roundTrips := 0
+			inner := roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+				roundTrips++
+				b, err := io.ReadAll(req.Body)
+				if err != nil {
+					return nil, err
+				}
+				sends = append(sends, string(b))
+				if roundTrips > 1 {
+					return &http.Response{StatusCode: http.StatusOK, Body: http.NoBody}, nil
+				}
+				body, err := req.GetBody()
+				if err != nil {
+					return nil, err
+				}
+				b, err = io.ReadAll(body)
+				if err != nil {
+					return nil, err
+				}
+				sends = append(sends, string(b))
+				return &http.Response{StatusCode: http.StatusServiceUnavailable, Body: http.NoBody}, nil
+			})
+			rt := retryabletransport.New(
+				inner,
+				nil,
+				nil,
+				&retryabletransport.BackOffPolicy{MaxRetries: 1, InitialInterval: time.Millisecond},
+				tc.opts...,
+			)
+			req, err := http.NewRequest(http.MethodPut, "http://example.com", strings.NewReader("hello"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			resp, err := rt.RoundTrip(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			assert.Equal(t, http.StatusOK, resp.StatusCode)
+			// Retries of the inner transport stay within a single attempt.
+			assert.Equal(t, 2, roundTrips)
+			assert.Equal(t, []string{"hello", "hello", "hello"}, sends)
+			attempts, _ := retryabletransport.AttemptsFromContext(resp.Request.Context())
+			assert.Equal(t, uint64(2), attempts)
+		})
+	}
+}
+
+func Test_StrictBodyReplay(t *testing.T) {
+	type test struct {
+		name       string
+		resp       *http.Response
+		err        error
+		wantErr    error
+		wantStatus int
+	}
+	tests := []test{
+		{
+			name:    "retryable response fails loudly",
+			resp:    &http.Response{StatusCode: http.StatusServiceUnavailable},
+			wantErr: retryabletransport.BodyNotReplayableError,
+		},
+		{
+			name:    "retryable error fails loudly",
+			err:     syscall.ECONNREFUSED,
+			wantErr: syscall.ECONNREFUSED,
+		},
+		{
+			name:       "non-retryable response is returned",
+			resp:       &http.Response{StatusCode: http.StatusBadRequest},
+			wantStatus: http.StatusBadRequest,
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			calledCount := 0
+			var respBody *trackingBody
+			if tc.resp != nil {
+				respBody = &trackingBody{r: strings.NewReader("error")}
+				tc.resp.Body = respBody
+			}
+			rt := retryabletransport.New(
+				roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+					calledCount++
+					_, _ = io.Copy(io.Discard, req.Body)
+					return tc.resp, tc.err
+				}),
+				nil,
+				nil,
+				&retryabletransport.BackOffPolicy{MaxRetries: 1, InitialInterval: time.Millisecond},
+				retryabletransport.WithoutBodyBuffering(),
+				retryabletransport.StrictBodyReplay(),
+			)
+			// The body is not seekable and there is no GetBody, so it cannot be replayed.
+			pr, pw := io.Pipe()
+			go func() {
+				_, _ = pw.Write([]byte("hello"))
+				_ = pw.Close()
+			}()
+			req, err := http.NewRequest(http.MethodPut, "http://example.com", pr)
+			if err != nil {
+				t.Fatal(err)
+			}
+			resp, err := rt.RoundTrip(req)
+			assert.Equal(t, 1, calledCount)
+			if tc.wantErr != nil {
+				assert.ErrorIs(t, err, retryabletransport.BodyNotReplayableError)
+				assert.ErrorIs(t, err, tc.wantErr)
+				assert.Nil(t, resp)
+				if respBody != nil {
+					assert.True(t, respBody.closed, "the discarded response must be closed")
+				}
+				return
+			}
+			if assert.NoError(t, err) {
+				assert.Equal(t, tc.wantStatus, resp.StatusCode)
+			}
+		})
+	}
+}
+
+func Test_RoundTripper_RoundTrip_ZeroContentLength(t *testing.T) {
+	type attempt struct {
+		noBody        bool
+		contentLength int64
+		body          string
+	}
+	type test struct {
+		name         string
+		body         io.Reader
+		wantAttempts []attempt
+	}
+	tests := []test{
+		{
+			name: "empty body of unknown length is replayed as no body",
+			// Hiding the type keeps http.NewRequest from recognizing the reader as empty.
+			body:         struct{ io.Reader }{strings.NewReader("")},
+			wantAttempts: []attempt{{noBody: true}, {noBody: true}},
+		},
+		{
+			name:         "non-empty body of unknown length is buffered whole",
+			body:         struct{ io.Reader }{strings.NewReader("hello")},
+			wantAttempts: []attempt{{contentLength: 5, body: "hello"}, {contentLength: 5, body: "hello"}},
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			var attempts []attempt
+			rt := retryabletransport.New(
+				roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+					b, err := io.ReadAll(req.Body)
+					if err != nil {
+						return nil, err
+					}
+					attempts = append(attempts, attempt{noBody: req.Body == http.NoBody, contentLength: req.ContentLength, body: string(b)})
+					if len(attempts) == 1 {
+						return &http.Response{StatusCode: http.StatusServiceUnavailable, Body: http.NoBody}, nil
+					}
+					return &http.Response{StatusCode: http.StatusOK, Body: http.NoBody}, nil
+				}),
+				nil,
+				nil,
+				&retryabletransport.BackOffPolicy{MaxRetries: 1, InitialInterval: time.Millisecond},
+			)
+			req, err := http.NewRequest(http.MethodPut, "http://example.com", tc.body)
+			if err != nil {
+				t.Fatal(err)
+			}
+			assert.Equal(t, int64(0), req.ContentLength)
+			resp, err := rt.RoundTrip(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			assert.Equal(t, http.StatusOK, resp.StatusCode)
+			assert.Equal(t, tc.wantAttempts, attempts)
+		})
+	}
+}
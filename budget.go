@@ -0,0 +1,85 @@
+package retryabletransport
+
+import (
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/cenkalti/backoff/v4"
+)
+
+// ConsumeBudgetFunc decides whether a retry of the given request, response, and error withdraws from a RetryBudget.
+type ConsumeBudgetFunc func(*http.Request, *http.Response, error) bool
+
+// RetryBudget caps retries at a fraction of the requests sent through the transports sharing it,
+// which keeps client-side retries from amplifying the load on a struggling upstream.
+// Every request deposits ratio tokens, every retry withdraws one token, and a retry is skipped
+// when less than one token is left. The balance starts at, and never exceeds, maxTokens.
+// A RetryBudget is safe for concurrent use.
+type RetryBudget struct {
+	ratio       float64
+	maxTokens   float64
+	consumeFunc ConsumeBudgetFunc
+
+	mu     sync.Mutex
+	tokens float64
+}
+
+// NewRetryBudget creates a new RetryBudget. If consumeFunc is nil, every retry withdraws from the budget.
+// Otherwise only retries for which consumeFunc returns true do, so that e.g. server-paced 429 retries
+// can be kept from exhausting a budget meant to curb retries on network errors.
+func NewRetryBudget(ratio, maxTokens float64, consumeFunc ConsumeBudgetFunc) *RetryBudget {
+	return &RetryBudget{
+		ratio:       ratio,
+		maxTokens:   maxTokens,
+		consumeFunc: consumeFunc,
+		tokens:      maxTokens,
+	}
+}
+
+// WithRetryBudget limits the retries of the RoundTripper by the given budget.
+func WithRetryBudget(budget *RetryBudget) Option {
+	return func(p *RoundTripper) {
+		p.retryBudget = budget
+	}
+}
+
+// deposit credits the budget for a new request.
+func (b *RetryBudget) deposit() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.tokens = min(b.tokens+b.ratio, b.maxTokens)
+}
+
+// withdraw reports whether a retry for the given outcome is allowed, withdrawing a token if it consumes budget.
+func (b *RetryBudget) withdraw(req *http.Request, resp *http.Response, err error) bool {
+	if b.consumeFunc != nil && !b.consumeFunc(req, resp, err) {
+		return true
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.tokens < 1 {
+		return false
+	}
+	b.tokens--
+	return true
+}
+
+// budgetBackOff stops retrying once the retry budget is exhausted.
+type budgetBackOff struct {
+	backoff.BackOffContext
+	budget *RetryBudget
+	state  *retryState
+}
+
+// NextBackOff returns the wrapped backoff delay, or backoff.Stop if the retry is not covered by the budget.
+func (b *budgetBackOff) NextBackOff() time.Duration {
+	next := b.BackOffContext.NextBackOff()
+	if next == backoff.Stop {
+		return next
+	}
+	if !b.budget.withdraw(b.state.req, b.state.resp, b.state.err) {
+		return backoff.Stop
+	}
+	return next
+}
@@ -0,0 +1,125 @@
+package retryabletransport_test
+
+import (
+	"errors"
+	"net/http"
+	"sync/atomic"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/linzhengen/retryabletransport"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_RetryBudget(t *testing.T) {
+	type test struct {
+		name         string
+		resp         *http.Response
+		err          error
+		consumeFunc  retryabletransport.ConsumeBudgetFunc
+		wantErr      error
+		wantAttempts []int
+	}
+	tests := []test{
+		{
+			name:         "network errors exhaust the budget",
+			err:          syscall.ECONNRESET,
+			wantErr:      syscall.ECONNRESET,
+			wantAttempts: []int{2, 1},
+		},
+		{
+			name: "429s excluded by the classifier do not consume the budget",
+			resp: &http.Response{StatusCode: http.StatusTooManyRequests},
+			consumeFunc: func(req *http.Request, resp *http.Response, err error) bool {
+				return resp == nil || resp.StatusCode != http.StatusTooManyRequests
+			},
+			wantAttempts: []int{2, 2},
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			calledCount := 0
+			rt := retryabletransport.New(
+				roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+					calledCount++
+					return tc.resp, tc.err
+				}),
+				func(req *http.Request, resp *http.Response, err error) bool {
+					if errors.Is(err, syscall.ECONNRESET) {
+						return true
+					}
+					return resp != nil && resp.StatusCode == http.StatusTooManyRequests
+				},
+				nil,
+				&retryabletransport.BackOffPolicy{MaxRetries: 1},
+				retryabletransport.WithRetryBudget(retryabletransport.NewRetryBudget(0, 1, tc.consumeFunc)),
+			)
+			for _, want := range tc.wantAttempts {
+				calledCount = 0
+				req, err := http.NewRequest(http.MethodGet, "http://example.com", nil)
+				if err != nil {
+					t.Fatal(err)
+				}
+				_, err = rt.RoundTrip(req)
+				assert.ErrorIs(t, err, tc.wantErr)
+				assert.Equal(t, want, calledCount)
+			}
+		})
+	}
+}
+
+func Test_RetryBudget_NotSpentWithoutRetry(t *testing.T) {
+	var attemptsA, attemptsB atomic.Int64
+	retrying := make(chan struct{})
+	release := make(chan struct{})
+	rt := retryabletransport.New(
+		roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+			if req.URL.Path == "/a" {
+				if attemptsA.Add(1) > 1 {
+					close(retrying)
+					<-release
+					return &http.Response{StatusCode: http.StatusOK}, nil
+				}
+			} else {
+				attemptsB.Add(1)
+			}
+			return nil, syscall.ECONNRESET
+		}),
+		nil,
+		nil,
+		&retryabletransport.BackOffPolicy{MaxRetries: 1, InitialInterval: time.Millisecond},
+		// Only the retries of /b consume the single token.
+		retryabletransport.WithRetryBudget(retryabletransport.NewRetryBudget(0, 1, func(req *http.Request, resp *http.Response, err error) bool {
+			return req.URL.Path == "/b"
+		})),
+		retryabletransport.WithMaxConcurrentRetries(1),
+	)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		req, err := http.NewRequest(http.MethodGet, "http://example.com/a", nil)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		_, err = rt.RoundTrip(req)
+		assert.NoError(t, err)
+	}()
+	<-retrying
+	req, err := http.NewRequest(http.MethodGet, "http://example.com/b", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// No retry slot is free, so /b is not retried, and keeps the token for later.
+	_, err = rt.RoundTrip(req)
+	assert.ErrorIs(t, err, syscall.ECONNRESET)
+	assert.Equal(t, int64(1), attemptsB.Load())
+	close(release)
+	<-done
+
+	attemptsB.Store(0)
+	_, err = rt.RoundTrip(req)
+	assert.ErrorIs(t, err, syscall.ECONNRESET)
+	assert.Equal(t, int64(2), attemptsB.Load(), "the token should not have been spent without a retry")
+}
@@ -0,0 +1,77 @@
+package retryabletransport
+
+import (
+	"context"
+	"net/http"
+	"sync"
+)
+
+// WithBufferMemoryLimit caps the bytes of request bodies buffered for replay by all requests of the RoundTripper at
+// the same time at n, so that many large uploads at once cannot exhaust memory. A request whose body would exceed
+// the limit waits until enough buffers are released, or fails with the error of its context once it is done.
+// Bodies larger than n or of unknown length cannot be counted against the limit; they are not buffered but sent
+// once, unless the request can replay them through GetBody. Buffers are released when RoundTrip returns, so no
+// GetBody replaying a buffer is set on the request, unlike without a limit; an *http.Client therefore does not
+// follow 307 and 308 redirects of requests whose body the RoundTripper buffered, but returns the redirect response.
+func WithBufferMemoryLimit(n int64) Option {
+	return func(p *RoundTripper) {
+		p.bufferMemory = &bufferMemory{limit: n}
+	}
+}
+
+// bufferMemoryLimit returns the limit of WithBufferMemoryLimit, or zero if there is none.
+func (p *RoundTripper) bufferMemoryLimit() int64 {
+	if p.bufferMemory == nil {
+		return 0
+	}
+	return p.bufferMemory.limit
+}
+
+// bufferMemory is a counting semaphore of the bytes of buffered request bodies.
+type bufferMemory struct {
+	limit int64
+
+	mu   sync.Mutex
+	used int64
+	// released is closed, and replaced, whenever buffers are released, to wake up waiting requests.
+	released chan struct{}
+}
+
+// fits reports whether the body of req can be counted against the limit.
+func (m *bufferMemory) fits(req *http.Request) bool {
+	return req.ContentLength > 0 && req.ContentLength <= m.limit
+}
+
+// acquire takes n bytes, waiting for them until ctx is done.
+func (m *bufferMemory) acquire(ctx context.Context, n int64) error {
+	for {
+		m.mu.Lock()
+		if m.used+n <= m.limit {
+			m.used += n
+			m.mu.Unlock()
+			return nil
+		}
+		if m.released == nil {
+			m.released = make(chan struct{})
+		}
+		released := m.released
+		m.mu.Unlock()
+		select {
+		case <-released:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// release returns n bytes taken by acquire.
+func (m *bufferMemory) release(n int64) {
+	m.mu.Lock()
+	m.used -= n
+	released := m.released
+	m.released = nil
+	m.mu.Unlock()
+	if released != nil {
+		close(released)
+	}
+}
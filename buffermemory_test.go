@@ -0,0 +1,91 @@
+package retryabletransport_test
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/linzhengen/retryabletransport"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_WithBufferMemoryLimit(t *testing.T) {
+	sending := make(chan struct{})
+	unblock := make(chan struct{})
+	var calls atomic.Int32
+	rt := retryabletransport.New(
+		roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+			calls.Add(1)
+			if req.URL.Path == "/blocking" {
+				close(sending)
+				<-unblock
+			}
+			if _, err := io.Copy(io.Discard, req.Body); err != nil {
+				return nil, err
+			}
+			if req.URL.Path == "/unavailable" {
+				return &http.Response{StatusCode: http.StatusServiceUnavailable, Body: http.NoBody}, nil
+			}
+			return &http.Response{StatusCode: http.StatusOK, Body: http.NoBody}, nil
+		}),
+		nil,
+		nil,
+		&retryabletransport.BackOffPolicy{MaxRetries: 2, InitialInterval: time.Millisecond},
+		retryabletransport.WithBufferMemoryLimit(10),
+	)
+	newRequest := func(ctx context.Context, path, body string) *http.Request {
+		req, err := http.NewRequestWithContext(ctx, http.MethodPut, "http://example.com"+path, strings.NewReader(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		// The body is only replayable through the buffer.
+		req.GetBody = nil
+		return req
+	}
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		resp, err := rt.RoundTrip(newRequest(context.Background(), "/blocking", "12345678"))
+		if assert.NoError(t, err) {
+			assert.Equal(t, http.StatusOK, resp.StatusCode)
+		}
+	}()
+	<-sending
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	_, err := rt.RoundTrip(newRequest(ctx, "/waiting", "12345"))
+	assert.ErrorIs(t, err, context.DeadlineExceeded, "the body must wait while the limit is taken")
+
+	calls.Store(0)
+	resp, err := rt.RoundTrip(newRequest(context.Background(), "/unavailable", "too large to be buffered"))
+	if assert.NoError(t, err) {
+		assert.Equal(t, http.StatusServiceUnavailable, resp.StatusCode)
+	}
+	assert.Equal(t, int32(1), calls.Load(), "a body over the limit must be sent once without buffering")
+
+	waited := make(chan error, 1)
+	go func() {
+		_, err := rt.RoundTrip(newRequest(context.Background(), "/waiting", "12345"))
+		waited <- err
+	}()
+	select {
+	case <-waited:
+		t.Fatal("the body must wait while the limit is taken")
+	case <-time.After(20 * time.Millisecond):
+	}
+	close(unblock)
+	<-done
+	assert.NoError(t, <-waited, "the body must be buffered once the limit is released")
+
+	req := newRequest(context.Background(), "/unavailable", "12345")
+	resp, err = rt.RoundTrip(req)
+	if assert.NoError(t, err) {
+		assert.Equal(t, http.StatusServiceUnavailable, resp.StatusCode)
+	}
+	assert.Nil(t, req.GetBody, "the released buffer must not stay reachable through GetBody")
+}
@@ -0,0 +1,128 @@
+package retryabletransport
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"net/http"
+	"sync"
+)
+
+// maxPooledBodyBytes is the capacity above which body buffers are left to the garbage collector
+// instead of being returned to the pool, so that a few huge bodies do not pin memory.
+const maxPooledBodyBytes = 1 << 20
+
+// bodyBufferPool holds the buffers used by WithBodyBufferPool.
+var bodyBufferPool = sync.Pool{
+	New: func() any {
+		return new(bytes.Buffer)
+	},
+}
+
+// WithBodyBufferPool buffers request bodies in buffers taken from a shared sync.Pool instead of allocating a fresh
+// slice per request, which reduces GC pressure under high throughput. Bodies replayable through GetBody are not
+// buffered at all, so the pool only holds bodies without one. A buffer returns to the pool only once the
+// RoundTrip has returned and every attempt has closed its body, as http.RoundTripper implementations must, so no
+// retry can still read it; buffers of bodies larger than 1MiB are not pooled.
+//
+// The pooled buffer is private to the RoundTrip, so in contrast to plain buffering, GetBody of the request is left
+// as provided by the caller; an *http.Client does not follow 307 and 308 redirects of requests without one.
+func WithBodyBufferPool() Option {
+	return func(p *RoundTripper) {
+		p.bodyBufferPool = true
+	}
+}
+
+// errClosedBody is returned when reading a pooled body after it was closed.
+var errClosedBody = errors.New("read on closed request body")
+
+// pooledBody is a request body buffered in a pooled buffer, which is returned to the pool once all references
+// to it are released.
+type pooledBody struct {
+	mu   sync.Mutex
+	buf  *bytes.Buffer
+	refs int
+}
+
+// readPooledBody reads the request body into a pooled buffer and closes it.
+// The returned pooledBody holds a reference that the caller has to release.
+func readPooledBody(r *http.Request) (*pooledBody, error) {
+	buf := bodyBufferPool.Get().(*bytes.Buffer)
+	buf.Reset()
+	if r.ContentLength > 0 && r.ContentLength <= maxPooledBodyBytes {
+		buf.Grow(int(r.ContentLength))
+	}
+	_, err := buf.ReadFrom(r.Body)
+	if closeErr := r.Body.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		putBodyBuffer(buf)
+		return nil, err
+	}
+	return &pooledBody{buf: buf, refs: 1}, nil
+}
+
+// len returns the length of the body.
+func (b *pooledBody) len() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Len()
+}
+
+// newReader returns a reader for an attempt, which holds a reference until it is closed.
+// It must only be called while the caller holds a reference itself.
+func (b *pooledBody) newReader() io.ReadCloser {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.refs++
+	return &pooledBodyReader{body: b, r: bytes.NewReader(b.buf.Bytes())}
+}
+
+// release releases a reference, returning the buffer to the pool once none is left.
+func (b *pooledBody) release() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.refs--
+	if b.refs == 0 {
+		putBodyBuffer(b.buf)
+		b.buf = nil
+	}
+}
+
+// putBodyBuffer returns buf to the pool unless it grew too large.
+func putBodyBuffer(buf *bytes.Buffer) {
+	if buf.Cap() <= maxPooledBodyBytes {
+		bodyBufferPool.Put(buf)
+	}
+}
+
+// pooledBodyReader reads a pooledBody on behalf of a single attempt.
+type pooledBodyReader struct {
+	mu     sync.Mutex
+	body   *pooledBody
+	r      *bytes.Reader
+	closed bool
+}
+
+// Read implements io.Reader.
+func (r *pooledBodyReader) Read(p []byte) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.closed {
+		return 0, errClosedBody
+	}
+	return r.r.Read(p)
+}
+
+// Close implements io.Closer, releasing the reference to the body.
+func (r *pooledBodyReader) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if !r.closed {
+		r.closed = true
+		r.r = nil
+		r.body.release()
+	}
+	return nil
+}
@@ -0,0 +1,104 @@
+package retryabletransport_test
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/linzhengen/retryabletransport"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_WithBodyBufferPool(t *testing.T) {
+	// Every first attempt of a body fails, so each body is replayed from its pooled buffer.
+	var mu sync.Mutex
+	seen := map[string]int{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, err := io.ReadAll(r.Body)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		mu.Lock()
+		seen[string(b)]++
+		first := seen[string(b)] == 1
+		mu.Unlock()
+		if first {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		_, _ = w.Write(b)
+	}))
+	defer server.Close()
+
+	client := &http.Client{
+		Transport: retryabletransport.New(
+			nil,
+			nil,
+			nil,
+			&retryabletransport.BackOffPolicy{MaxRetries: 1, InitialInterval: time.Millisecond},
+			retryabletransport.WithBodyBufferPool(),
+		),
+	}
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			// Bodies of varying size, some larger than the pooled buffers, and without GetBody, so that they
+			// are buffered.
+			body := fmt.Sprintf("%d:%s", i, strings.Repeat("x", i*i*4<<10))
+			resp, err := client.Post(server.URL, "text/plain", io.NopCloser(strings.NewReader(body)))
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			defer resp.Body.Close()
+			got, err := io.ReadAll(resp.Body)
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			assert.Equal(t, http.StatusOK, resp.StatusCode)
+			assert.Equal(t, body, string(got))
+		}(i)
+	}
+	wg.Wait()
+}
+
+func BenchmarkRoundTripper_RoundTrip_BodyBuffer(b *testing.B) {
+	body := bytes.Repeat([]byte("x"), 32<<10)
+	inner := roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		_, _ = io.Copy(io.Discard, req.Body)
+		_ = req.Body.Close()
+		return &http.Response{StatusCode: http.StatusOK, Body: http.NoBody}, nil
+	})
+	for _, bc := range []struct {
+		name string
+		opts []retryabletransport.Option
+	}{
+		{name: "Alloc"},
+		{name: "Pool", opts: []retryabletransport.Option{retryabletransport.WithBodyBufferPool()}},
+	} {
+		b.Run(bc.name, func(b *testing.B) {
+			rt := retryabletransport.New(inner, nil, nil, nil, bc.opts...)
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				// The body has no GetBody, so that both cases buffer it.
+				req, err := http.NewRequest(http.MethodPost, "http://example.com", io.NopCloser(bytes.NewReader(body)))
+				if err != nil {
+					b.Fatal(err)
+				}
+				if _, err := rt.RoundTrip(req); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
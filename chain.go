@@ -0,0 +1,25 @@
+package retryabletransport
+
+import "net/http"
+
+// Middleware wraps an http.RoundTripper with additional behavior.
+type Middleware func(http.RoundTripper) http.RoundTripper
+
+// Chain composes middlewares in the declared order: the first middleware is the outermost layer and the last one
+// wraps the transport the chain is applied to. Layers outside the retries see one call per request, while layers
+// inside see every attempt, e.g. Chain(metrics, NewMiddleware(), auth) counts requests but re-authenticates attempts.
+func Chain(middlewares ...Middleware) Middleware {
+	return func(roundTripper http.RoundTripper) http.RoundTripper {
+		for i := len(middlewares) - 1; i >= 0; i-- {
+			roundTripper = middlewares[i](roundTripper)
+		}
+		return roundTripper
+	}
+}
+
+// NewMiddleware returns a Middleware wrapping a transport in a RoundTripper configured with opts.
+func NewMiddleware(opts ...Option) Middleware {
+	return func(roundTripper http.RoundTripper) http.RoundTripper {
+		return New(roundTripper, nil, nil, nil, opts...)
+	}
+}
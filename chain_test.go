@@ -0,0 +1,54 @@
+package retryabletransport_test
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+
+	"github.com/linzhengen/retryabletransport"
+)
+
+func ExampleChain() {
+	var calledCount atomic.Int64
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if calledCount.Add(1) == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer server.Close()
+
+	metrics := func(next http.RoundTripper) http.RoundTripper {
+		return roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+			fmt.Println("metrics: request")
+			return next.RoundTrip(req)
+		})
+	}
+	auth := func(next http.RoundTripper) http.RoundTripper {
+		return roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+			fmt.Println("auth: attempt")
+			req = req.Clone(req.Context())
+			req.Header.Set("Authorization", "Bearer token")
+			return next.RoundTrip(req)
+		})
+	}
+	client := &http.Client{
+		Transport: retryabletransport.Chain(
+			metrics,
+			retryabletransport.NewMiddleware(),
+			auth,
+		)(http.DefaultTransport),
+	}
+	resp, err := client.Get(server.URL)
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	defer resp.Body.Close()
+	fmt.Println(resp.StatusCode)
+	// Output:
+	// metrics: request
+	// auth: attempt
+	// auth: attempt
+	// 200
+}
@@ -0,0 +1,22 @@
+package retryabletransport
+
+import "net/http"
+
+// DoWithRetry sends req with client.Do and retries the whole call, including the redirects client follows, as
+// configured by opts, which default to the same as New with nil parameters. Unlike retries at the transport level,
+// which repeat single requests of a redirect chain, every retry starts over at the URL of req and re-evaluates the
+// redirects, for scenarios where the redirects themselves are flaky. Retries are decided on the final response of
+// each chain. client.Timeout applies to each attempt; the context of req bounds all of them. If the
+// Transport of client retries as well, the retries multiply.
+func DoWithRetry(client *http.Client, req *http.Request, opts ...Option) (*http.Response, error) {
+	return New(clientRoundTripper{client: client}, nil, nil, nil, opts...).RoundTrip(req)
+}
+
+// clientRoundTripper sends requests through an *http.Client, following its redirects.
+type clientRoundTripper struct {
+	client *http.Client
+}
+
+func (c clientRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	return c.client.Do(req)
+}
@@ -0,0 +1,60 @@
+package retryabletransport_test
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/linzhengen/retryabletransport"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_DoWithRetry(t *testing.T) {
+	// The first redirect leads to a failing location, the second one to a healthy location.
+	var startCount, failingCount, healthyCount int
+	var bodies []string
+	mux := http.NewServeMux()
+	mux.HandleFunc("/start", func(w http.ResponseWriter, r *http.Request) {
+		b, _ := io.ReadAll(r.Body)
+		bodies = append(bodies, string(b))
+		startCount++
+		if startCount == 1 {
+			http.Redirect(w, r, "/failing", http.StatusTemporaryRedirect)
+			return
+		}
+		http.Redirect(w, r, "/healthy", http.StatusTemporaryRedirect)
+	})
+	mux.HandleFunc("/failing", func(w http.ResponseWriter, r *http.Request) {
+		failingCount++
+		w.WriteHeader(http.StatusServiceUnavailable)
+	})
+	mux.HandleFunc("/healthy", func(w http.ResponseWriter, r *http.Request) {
+		b, _ := io.ReadAll(r.Body)
+		bodies = append(bodies, string(b))
+		healthyCount++
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	req, err := http.NewRequest(http.MethodPut, server.URL+"/start", strings.NewReader("hello"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := retryabletransport.DoWithRetry(
+		server.Client(),
+		req,
+		retryabletransport.WithBackOffPolicy(&retryabletransport.BackOffPolicy{MaxRetries: 1, InitialInterval: time.Millisecond}),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, 2, startCount, "the retry must start over at the original URL")
+	assert.Equal(t, 1, failingCount)
+	assert.Equal(t, 1, healthyCount)
+	assert.Equal(t, []string{"hello", "hello", "hello"}, bodies)
+}
@@ -0,0 +1,43 @@
+package retryabletransport
+
+import (
+	"time"
+
+	"github.com/cenkalti/backoff/v4"
+)
+
+// WithMaxConcurrentRetries limits the number of requests that are retrying at the same time to n, which curbs
+// retry amplification without throttling first attempts. A request takes a slot when it is about to be retried
+// the first time and holds it until RoundTrip returns. If no slot is free, the request is not retried and the
+// result of its first attempt is returned. An n of 0 or less means no limit, which is the default.
+func WithMaxConcurrentRetries(n int) Option {
+	return func(p *RoundTripper) {
+		if n <= 0 {
+			p.retrySlots = nil
+			return
+		}
+		p.retrySlots = make(chan struct{}, n)
+	}
+}
+
+// retrySlotBackOff stops retrying a request that cannot take a retry slot.
+type retrySlotBackOff struct {
+	backoff.BackOff
+	slots chan struct{}
+	state *retryState
+}
+
+// NextBackOff returns the wrapped backoff delay, or backoff.Stop if the request holds no retry slot and none is free.
+func (b *retrySlotBackOff) NextBackOff() time.Duration {
+	next := b.BackOff.NextBackOff()
+	if next == backoff.Stop || b.state.holdsRetrySlot {
+		return next
+	}
+	select {
+	case b.slots <- struct{}{}:
+		b.state.holdsRetrySlot = true
+		return next
+	default:
+		return backoff.Stop
+	}
+}
@@ -0,0 +1,129 @@
+package retryabletransport_test
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/linzhengen/retryabletransport"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_WithMaxConcurrentRetries(t *testing.T) {
+	var attemptsA, attemptsB atomic.Int64
+	retrying := make(chan struct{})
+	var once sync.Once
+	rt := retryabletransport.New(
+		roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+			if req.URL.Path == "/a" {
+				if attemptsA.Add(1) > 1 {
+					return &http.Response{StatusCode: http.StatusOK}, nil
+				}
+			} else {
+				attemptsB.Add(1)
+			}
+			return nil, syscall.ECONNRESET
+		}),
+		nil,
+		func(ctx context.Context, err error, duration time.Duration) {
+			once.Do(func() { close(retrying) })
+		},
+		&retryabletransport.BackOffPolicy{MaxRetries: 1},
+		retryabletransport.WithMaxConcurrentRetries(1),
+	)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		req, err := http.NewRequest(http.MethodGet, "http://example.com/a", nil)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		resp, err := rt.RoundTrip(req)
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+	}()
+	<-retrying
+	req, err := http.NewRequest(http.MethodGet, "http://example.com/b", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = rt.RoundTrip(req)
+	assert.ErrorIs(t, err, syscall.ECONNRESET)
+	assert.Equal(t, int64(1), attemptsB.Load(), "no retry slot should be free while /a is retrying")
+	<-done
+	assert.Equal(t, int64(2), attemptsA.Load())
+}
+
+func Test_WithMaxConcurrentRetries_NoLimit(t *testing.T) {
+	for _, n := range []int{0, -1} {
+		attempts := 0
+		rt := retryabletransport.New(
+			roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+				attempts++
+				return nil, syscall.ECONNRESET
+			}),
+			nil,
+			nil,
+			&retryabletransport.BackOffPolicy{MaxRetries: 2, InitialInterval: time.Millisecond},
+			retryabletransport.WithMaxConcurrentRetries(3),
+			retryabletransport.WithMaxConcurrentRetries(n),
+		)
+		assert.Equal(t, 0, rt.Config().MaxConcurrentRetries)
+		req, err := http.NewRequest(http.MethodGet, "http://example.com", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, err = rt.RoundTrip(req)
+		assert.ErrorIs(t, err, syscall.ECONNRESET)
+		assert.Equal(t, 3, attempts, "n=%d", n)
+	}
+}
+
+func Test_RoundTripper_ConcurrentUse(t *testing.T) {
+	var calledCount atomic.Int64
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if calledCount.Add(1)%3 == 0 {
+			w.Header().Set("Retry-After", "0")
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer server.Close()
+	host := strings.TrimPrefix(server.URL, "http://")
+	client := &http.Client{
+		Transport: retryabletransport.New(
+			nil,
+			nil,
+			func(ctx context.Context, err error, duration time.Duration) {},
+			&retryabletransport.BackOffPolicy{MaxRetries: 2, InitialInterval: time.Millisecond},
+			retryabletransport.WithRetryBudget(retryabletransport.NewRetryBudget(0.5, 10, nil)),
+			retryabletransport.WithMaxConcurrentRetries(5),
+			retryabletransport.WithBackends([]string{host}, retryabletransport.BackendSpread),
+			retryabletransport.WithNotifyCoalescing(retryabletransport.NotifyEveryN(2)),
+			retryabletransport.WithAttemptHeader("", true),
+			retryabletransport.WithRetryAfter(),
+		),
+	}
+	var wg sync.WaitGroup
+	for i := 0; i < 100; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			resp, err := client.Post(server.URL, "text/plain", strings.NewReader("payload"))
+			if err != nil {
+				return
+			}
+			_, _ = io.Copy(io.Discard, resp.Body)
+			_ = resp.Body.Close()
+		}()
+	}
+	wg.Wait()
+	assert.GreaterOrEqual(t, calledCount.Load(), int64(100))
+}
@@ -0,0 +1,26 @@
+package retryabletransport
+
+import (
+	"net/http"
+	"time"
+)
+
+// WithRetryConditions sets shouldRetryFunc to retry what any of conditions retries, like the retry conditions of
+// go-resty. It replaces shouldRetryFunc, so include DefaultShouldRetry in conditions to keep retrying what it
+// retries. It is a shorthand for WithShouldRetry(AnyOf(conditions...)).
+func WithRetryConditions(conditions []ShouldRetryFunc) Option {
+	return WithShouldRetry(AnyOf(conditions...))
+}
+
+// WithRetryAfterConditions is like WithRetryAfterFunc, but extracts the delay with the first of conditions that
+// finds one in the response, in order, e.g. ParseRetryAfter followed by a function reading a nonstandard header.
+func WithRetryAfterConditions(conditions []RetryAfterFunc) Option {
+	return WithRetryAfterFunc(func(resp *http.Response) (time.Duration, bool) {
+		for _, condition := range conditions {
+			if delay, ok := condition(resp); ok {
+				return delay, true
+			}
+		}
+		return 0, false
+	})
+}
@@ -0,0 +1,68 @@
+package retryabletransport_test
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"github.com/linzhengen/retryabletransport"
+)
+
+func ExampleWithRetryConditions() {
+	var calledCount atomic.Int64
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch calledCount.Add(1) {
+		case 1:
+			w.Header().Set("Retry-In-Ms", "10")
+			w.WriteHeader(http.StatusServiceUnavailable)
+		case 2:
+			w.Header().Set("Retry-After", "0")
+			w.WriteHeader(http.StatusConflict)
+		}
+	}))
+	defer server.Close()
+
+	retryOnConflict := func(req *http.Request, resp *http.Response, err error) bool {
+		return resp != nil && resp.StatusCode == http.StatusConflict
+	}
+	retryInMs := func(resp *http.Response) (time.Duration, bool) {
+		ms, err := strconv.Atoi(resp.Header.Get("Retry-In-Ms"))
+		if err != nil {
+			return 0, false
+		}
+		return time.Duration(ms) * time.Millisecond, true
+	}
+	client := &http.Client{
+		Transport: retryabletransport.New(
+			nil,
+			nil,
+			func(ctx context.Context, err error, duration time.Duration) {
+				fmt.Println("retry in", duration)
+			},
+			nil,
+			retryabletransport.WithRetryConditions([]retryabletransport.ShouldRetryFunc{
+				retryabletransport.DefaultShouldRetry,
+				retryOnConflict,
+			}),
+			retryabletransport.WithRetryAfterConditions([]retryabletransport.RetryAfterFunc{
+				retryabletransport.ParseRetryAfter,
+				retryInMs,
+			}),
+		),
+	}
+	resp, err := client.Get(server.URL)
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	defer resp.Body.Close()
+	fmt.Println(resp.StatusCode, calledCount.Load())
+	// Output:
+	// retry in 10ms
+	// retry in 0s
+	// 200 3
+}
@@ -0,0 +1,134 @@
+package retryabletransport
+
+import (
+	"reflect"
+	"time"
+)
+
+// Config is a snapshot of the effective configuration of a RoundTripper, with all defaults applied.
+// Hooks are reported by whether they are set, since functions cannot be inspected.
+type Config struct {
+	BackOffPolicy BackOffPolicy
+	RoutePolicies []RoutePolicy
+
+	DefaultShouldRetry   bool
+	Notify               bool
+	NotifyCoalescing     bool
+	MaxRetriesForError   bool
+	RetryBudget          bool
+	MaxConcurrentRetries int
+	LoadScaledBackOff    bool
+	ImmediateRetry       bool
+	MaxImmediateRetries  int
+	TotalTimeout         time.Duration
+	HealthGate           bool
+	StartupSpread        time.Duration
+	StopCondition        bool
+	KillSwitch           bool
+	BeforeRequest        bool
+
+	PerAttemptTimeout           time.Duration
+	PerAttemptTimeoutMultiplier float64
+	MaxPerAttemptTimeout        time.Duration
+
+	AllowRetryOnSuccess bool
+	AllowRetryAfterSent bool
+	RetryIfSlowerThan   time.Duration
+
+	AttemptHeader               string
+	AttemptHeaderOnFirstAttempt bool
+	CorrelationHeader           string
+	TokenRefresh                bool
+
+	Backends         []string
+	BackendSelection BackendSelection
+	BackendFunc      bool
+	HTTP1Fallback    int
+
+	StreamingBody     bool
+	BodyBufferPool    bool
+	NoBodyBuffering   bool
+	StrictBodyReplay  bool
+	BodyReplayCheck   bool
+	BufferMemoryLimit int64
+
+	RetryAfter       bool
+	RetryAfterJitter float64
+	MaxRetryAfter    time.Duration
+	RateLimitHeaders bool
+
+	MaxInspectBodyBytes int64
+	MaxDrainBodyBytes   int64
+	IntegrityCheck      bool
+	ResponseValidator   bool
+	MetricsRecorder     bool
+	Logger              bool
+	EventChannel        bool
+	AttemptTimings      bool
+	GiveUpResponse      bool
+	After               bool
+	FaultInjectionRate  float64
+
+	ReturnLastResponseOnExhaustion bool
+}
+
+// Config returns a snapshot of the effective configuration of the RoundTripper,
+// e.g. for logging at startup. Modifying the returned Config has no effect on the RoundTripper.
+func (p *RoundTripper) Config() Config {
+	return Config{
+		BackOffPolicy:               p.backOffPolicy.resolve(),
+		RoutePolicies:               p.routePoliciesConfig(),
+		DefaultShouldRetry:          reflect.ValueOf(p.shouldRetryFunc).Pointer() == reflect.ValueOf(DefaultShouldRetry).Pointer(),
+		Notify:                      p.notifyFunc != nil,
+		NotifyCoalescing:            p.notifyFilter != nil,
+		MaxRetriesForError:          p.maxRetriesFunc != nil,
+		RetryBudget:                 p.retryBudget != nil,
+		MaxConcurrentRetries:        cap(p.retrySlots),
+		LoadScaledBackOff:           p.loadScale != nil,
+		ImmediateRetry:              p.immediateRetryFunc != nil,
+		MaxImmediateRetries:         p.maxImmediateRetries,
+		TotalTimeout:                p.totalTimeout,
+		PerAttemptTimeout:           p.perAttemptTimeout,
+		PerAttemptTimeoutMultiplier: p.perAttemptTimeoutMultiplier,
+		MaxPerAttemptTimeout:        p.maxPerAttemptTimeout,
+		HealthGate:                  p.healthGate != nil,
+		StartupSpread:               p.startupSpread,
+		StopCondition:               p.stopCondition != nil,
+		KillSwitch:                  p.killSwitch != nil,
+		BeforeRequest:               p.beforeRequestFunc != nil,
+		AllowRetryOnSuccess:         p.allowRetryOnSuccess,
+		AllowRetryAfterSent:         p.allowRetryAfterSent,
+		RetryIfSlowerThan:           p.slowerThan,
+		AttemptHeader:               p.attemptHeader,
+		AttemptHeaderOnFirstAttempt: p.attemptHeaderOnFirst,
+		CorrelationHeader:           p.correlationHeader,
+		TokenRefresh:                p.refreshTokenFunc != nil,
+		Backends:                    append([]string(nil), p.backends...),
+		BackendSelection:            p.backendSelection,
+		BackendFunc:                 p.backendFunc != nil,
+		HTTP1Fallback:               p.http1FallbackConfig(),
+		StreamingBody:               p.streamBody,
+		BodyBufferPool:              p.bodyBufferPool,
+		NoBodyBuffering:             p.noBodyBuffering,
+		StrictBodyReplay:            p.strictBodyReplay,
+		BodyReplayCheck:             p.bodyReplayCheck,
+		BufferMemoryLimit:           p.bufferMemoryLimit(),
+		RetryAfter:                  p.retryAfterFunc != nil,
+		RetryAfterJitter:            p.retryAfterJitter,
+		MaxRetryAfter:               p.retryAfterCap(),
+		RateLimitHeaders:            p.rateLimiter != nil,
+		MaxInspectBodyBytes:         p.inspectLimit(),
+		MaxDrainBodyBytes:           p.drainLimit(),
+		IntegrityCheck:              p.integrityCheck,
+		ResponseValidator:           p.responseValidator != nil,
+		MetricsRecorder:             p.metricsRecorder != nil,
+		Logger:                      p.logger != nil,
+		EventChannel:                p.eventChannel != nil,
+		AttemptTimings:              p.attemptTimings,
+		GiveUpResponse:              p.giveUpResponseFunc != nil,
+		After:                       p.after != nil,
+		FaultInjectionRate:          p.faultRate,
+
+		ReturnLastResponseOnExhaustion: !p.errorOnExhaustion,
+	}
+}
@@ -0,0 +1,56 @@
+package retryabletransport_test
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/linzhengen/retryabletransport"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_RoundTripper_Config(t *testing.T) {
+	t.Run("defaults", func(t *testing.T) {
+		cfg := retryabletransport.New(nil, nil, nil, nil).Config()
+		assert.Equal(t, retryabletransport.Config{
+			BackOffPolicy: retryabletransport.BackOffPolicy{
+				MaxRetries:          3,
+				InitialInterval:     500 * time.Millisecond,
+				MaxInterval:         60 * time.Second,
+				Multiplier:          1.5,
+				RandomizationFactor: 0.5,
+				MaxElapsedTime:      15 * time.Minute,
+			},
+			DefaultShouldRetry:  true,
+			MaxRetryAfter:       retryabletransport.DefaultMaxRetryAfter,
+			MaxInspectBodyBytes: retryabletransport.DefaultMaxInspectBodyBytes,
+			MaxDrainBodyBytes:   retryabletransport.DefaultMaxDrainBodyBytes,
+
+			ReturnLastResponseOnExhaustion: true,
+		}, cfg)
+	})
+	t.Run("options", func(t *testing.T) {
+		rt := retryabletransport.New(
+			nil,
+			func(req *http.Request, resp *http.Response, err error) bool { return false },
+			nil,
+			&retryabletransport.BackOffPolicy{MaxRetries: 1, InitialInterval: time.Millisecond, RandomizationFactor: -1},
+			retryabletransport.WithMaxConcurrentRetries(4),
+			retryabletransport.WithTotalTimeout(time.Second),
+			retryabletransport.WithAttemptHeader("", false),
+			retryabletransport.WithBackends([]string{"a.example.com"}, retryabletransport.BackendSticky),
+		)
+		cfg := rt.Config()
+		assert.False(t, cfg.DefaultShouldRetry)
+		assert.Equal(t, uint64(1), cfg.BackOffPolicy.MaxRetries)
+		assert.Equal(t, time.Millisecond, cfg.BackOffPolicy.InitialInterval)
+		assert.Equal(t, float64(0), cfg.BackOffPolicy.RandomizationFactor)
+		assert.Equal(t, 4, cfg.MaxConcurrentRetries)
+		assert.Equal(t, time.Second, cfg.TotalTimeout)
+		assert.Equal(t, retryabletransport.DefaultAttemptHeader, cfg.AttemptHeader)
+		assert.Equal(t, retryabletransport.BackendSticky, cfg.BackendSelection)
+
+		cfg.Backends[0] = "b.example.com"
+		assert.Equal(t, []string{"a.example.com"}, rt.Config().Backends)
+	})
+}
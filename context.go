@@ -0,0 +1,161 @@
+package retryabletransport
+
+import (
+	"context"
+	"net/http"
+	"time"
+)
+
+// singleAttemptKey is the context key marking a request for a single attempt.
+type singleAttemptKey struct{}
+
+// WithSingleAttempt returns a context that makes RoundTripper send requests made with it exactly once, e.g. because
+// a higher layer such as a job runner already retries them, or for once-only operations whose side effects must
+// not be duplicated even by failures that look safe to retry, such as refused connections. It overrides all other
+// retry logic for the request, including BackOffPolicy.MaxRetries, WithMaxRetriesForError, and the resending of
+// WithTokenRefresh. Retries *http.Transport makes internally, for idempotent requests on a reused connection that
+// was closed before the request was written, are not affected.
+func WithSingleAttempt(ctx context.Context) context.Context {
+	return context.WithValue(ctx, singleAttemptKey{}, true)
+}
+
+// isSingleAttempt reports whether ctx was marked by WithSingleAttempt.
+func isSingleAttempt(ctx context.Context) bool {
+	single, _ := ctx.Value(singleAttemptKey{}).(bool)
+	return single
+}
+
+// notifyKey is the context key for the NotifyFunc overriding that of the RoundTripper for a request.
+type notifyKey struct{}
+
+// WithRequestNotify returns a context that makes RoundTripper notify the retries of requests made with it to
+// notifyFunc instead of its own NotifyFunc, e.g. for verbose logging of a single call while debugging.
+// It takes precedence over the NotifyFunc passed to New, even if that is nil, while notification coalescing
+// and WithNotifyContext still apply.
+func WithRequestNotify(ctx context.Context, notifyFunc NotifyFunc) context.Context {
+	return context.WithValue(ctx, notifyKey{}, notifyFunc)
+}
+
+// requestNotify returns the NotifyFunc set by WithRequestNotify, if any.
+func requestNotify(ctx context.Context) (NotifyFunc, bool) {
+	notifyFunc, ok := ctx.Value(notifyKey{}).(NotifyFunc)
+	return notifyFunc, ok && notifyFunc != nil
+}
+
+// transportKey is the context key for the http.RoundTripper overriding the inner transport for a request.
+type transportKey struct{}
+
+// WithRequestTransport returns a context that makes RoundTripper send every attempt of requests made with it
+// through roundTripper instead of the transport it wraps, e.g. for a request-specific proxy or fault injection,
+// while retrying them as usual. It takes precedence over the transport passed to New; if roundTripper is nil,
+// that transport is used.
+func WithRequestTransport(ctx context.Context, roundTripper http.RoundTripper) context.Context {
+	return context.WithValue(ctx, transportKey{}, roundTripper)
+}
+
+// transportFor returns the transport the attempts of req are sent through.
+func (p *RoundTripper) transportFor(req *http.Request) http.RoundTripper {
+	if rt, ok := req.Context().Value(transportKey{}).(http.RoundTripper); ok && rt != nil {
+		return rt
+	}
+	return p.roundTripper
+}
+
+// retryStateKey is the context key for the retryState of a request, which stateful ShouldRetryFuncs keep
+// their per-request state in.
+type retryStateKey struct{}
+
+// withRetryState records state in the context of its request, unless it is recorded already.
+// It is only done once an attempt failed, so that requests succeeding right away are not copied.
+func withRetryState(state *retryState) {
+	if _, ok := state.req.Context().Value(retryStateKey{}).(*retryState); ok {
+		return
+	}
+	state.req = state.req.WithContext(context.WithValue(state.req.Context(), retryStateKey{}, state))
+}
+
+// AttemptDurationFromContext returns how long the latest attempt of a request took until its response headers
+// arrived or it failed. ctx is the context of the request passed to ShouldRetryFunc, i.e. req.Context(), so that
+// predicates can tell, e.g., fast-failing 503s from slow timeouts; it reports false for other contexts.
+func AttemptDurationFromContext(ctx context.Context) (time.Duration, bool) {
+	state, ok := ctx.Value(retryStateKey{}).(*retryState)
+	if !ok {
+		return 0, false
+	}
+	return state.attemptDuration, true
+}
+
+// predicateState returns the state kept under key for the request by a stateful ShouldRetryFunc, creating it with
+// newState if there is none yet. It returns nil if req is not being sent by a RoundTripper.
+func predicateState[T any](req *http.Request, key any, newState func() *T) *T {
+	state, ok := req.Context().Value(retryStateKey{}).(*retryState)
+	if !ok {
+		return nil
+	}
+	if state.predicateStates == nil {
+		state.predicateStates = map[any]any{}
+	}
+	s, ok := state.predicateStates[key].(*T)
+	if !ok {
+		s = newState()
+		state.predicateStates[key] = s
+	}
+	return s
+}
+
+// statsKey is the context key for the retry statistics of a request.
+type statsKey struct{}
+
+// stats holds the retry statistics of a request.
+type stats struct {
+	attempts   uint64
+	elapsed    time.Duration
+	outcomes   []AttemptOutcome
+	reuploaded int64
+}
+
+// withStats returns resp with the retry statistics of state recorded in the context of resp.Request.
+func withStats(resp *http.Response, state *retryState, start time.Time) *http.Response {
+	if resp == nil {
+		return nil
+	}
+	req := resp.Request
+	if req == nil {
+		req = state.req
+	}
+	s := &stats{attempts: state.attempts, elapsed: time.Since(start), outcomes: state.outcomes, reuploaded: state.reuploaded.Load()}
+	resp.Request = req.WithContext(context.WithValue(req.Context(), statsKey{}, s))
+	return resp
+}
+
+// AttemptsFromContext returns the number of attempts made for a request, including the first one.
+// ctx is the context of the request carried by the response, i.e. resp.Request.Context().
+func AttemptsFromContext(ctx context.Context) (uint64, bool) {
+	s, ok := ctx.Value(statsKey{}).(*stats)
+	if !ok {
+		return 0, false
+	}
+	return s.attempts, true
+}
+
+// ElapsedFromContext returns the time spent on a request across all of its attempts and the waits between them.
+// ctx is the context of the request carried by the response, i.e. resp.Request.Context().
+func ElapsedFromContext(ctx context.Context) (time.Duration, bool) {
+	s, ok := ctx.Value(statsKey{}).(*stats)
+	if !ok {
+		return 0, false
+	}
+	return s.elapsed, true
+}
+
+// ReuploadedBytesFromContext returns the bytes of the request body that retries sent again on top of the first
+// attempt, e.g. to account for the egress cost of retrying large uploads. Bytes are counted as the wrapped transport
+// reads them, so a body it reads only partly, e.g. because the server answered early, counts partly.
+// ctx is the context of the request carried by the response, i.e. resp.Request.Context().
+func ReuploadedBytesFromContext(ctx context.Context) (int64, bool) {
+	s, ok := ctx.Value(statsKey{}).(*stats)
+	if !ok {
+		return 0, false
+	}
+	return s.reuploaded, true
+}
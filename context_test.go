@@ -0,0 +1,315 @@
+package retryabletransport_test
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/linzhengen/retryabletransport"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_ElapsedFromContext(t *testing.T) {
+	calledCount := 0
+	var delay time.Duration
+	rt := retryabletransport.New(
+		roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+			calledCount++
+			if calledCount == 1 {
+				return &http.Response{StatusCode: http.StatusServiceUnavailable}, nil
+			}
+			return &http.Response{StatusCode: http.StatusOK}, nil
+		}),
+		nil,
+		func(ctx context.Context, err error, duration time.Duration) {
+			delay = duration
+		},
+		&retryabletransport.BackOffPolicy{MaxRetries: 1},
+	)
+	req, err := http.NewRequest(http.MethodGet, "http://example.com", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := rt.RoundTrip(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	elapsed, ok := retryabletransport.ElapsedFromContext(resp.Request.Context())
+	assert.True(t, ok)
+	assert.GreaterOrEqual(t, elapsed, delay)
+	attempts, ok := retryabletransport.AttemptsFromContext(resp.Request.Context())
+	assert.True(t, ok)
+	assert.Equal(t, uint64(2), attempts)
+
+	_, ok = retryabletransport.ElapsedFromContext(req.Context())
+	assert.False(t, ok, "the caller's request must not be modified")
+}
+
+func Test_WithSingleAttempt(t *testing.T) {
+	calledCount := 0
+	rt := retryabletransport.New(
+		roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+			calledCount++
+			return &http.Response{StatusCode: http.StatusServiceUnavailable}, nil
+		}),
+		nil,
+		nil,
+		&retryabletransport.BackOffPolicy{MaxRetries: 3},
+		retryabletransport.WithMaxRetriesForError(func(req *http.Request, resp *http.Response, err error) (uint64, bool) {
+			return 5, true
+		}),
+	)
+	req, err := http.NewRequestWithContext(retryabletransport.WithSingleAttempt(context.Background()), http.MethodGet, "http://example.com", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := rt.RoundTrip(req)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusServiceUnavailable, resp.StatusCode)
+	assert.Equal(t, 1, calledCount)
+
+	t.Run("overrides the resending of WithTokenRefresh", func(t *testing.T) {
+		calledCount := 0
+		rt := retryabletransport.New(
+			roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+				calledCount++
+				return &http.Response{StatusCode: http.StatusUnauthorized, Body: http.NoBody}, nil
+			}),
+			nil,
+			nil,
+			&retryabletransport.BackOffPolicy{MaxRetries: 3},
+			retryabletransport.WithTokenRefresh(func(ctx context.Context) (string, error) {
+				return "Bearer fresh", nil
+			}),
+		)
+		req, err := http.NewRequestWithContext(retryabletransport.WithSingleAttempt(context.Background()), http.MethodPost, "http://example.com", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp, err := rt.RoundTrip(req)
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+		assert.Equal(t, 1, calledCount)
+	})
+}
+
+func Test_WithRequestNotify(t *testing.T) {
+	type test struct {
+		name              string
+		notifyFunc        retryabletransport.NotifyFunc
+		requestNotify     bool
+		wantTransportCall int
+		wantRequestCall   int
+	}
+	var transportCalls, requestCalls int
+	countTransport := func(ctx context.Context, err error, duration time.Duration) { transportCalls++ }
+	tests := []test{
+		{
+			name:              "transport notify is used without an override",
+			notifyFunc:        countTransport,
+			wantTransportCall: 2,
+		},
+		{
+			name:            "override takes precedence over transport notify",
+			notifyFunc:      countTransport,
+			requestNotify:   true,
+			wantRequestCall: 2,
+		},
+		{
+			name:            "override applies without transport notify",
+			requestNotify:   true,
+			wantRequestCall: 2,
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			transportCalls, requestCalls = 0, 0
+			rt := retryabletransport.New(
+				roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+					return &http.Response{StatusCode: http.StatusServiceUnavailable}, nil
+				}),
+				nil,
+				tc.notifyFunc,
+				&retryabletransport.BackOffPolicy{MaxRetries: 2, InitialInterval: time.Millisecond},
+			)
+			ctx := context.Background()
+			if tc.requestNotify {
+				ctx = retryabletransport.WithRequestNotify(ctx, func(ctx context.Context, err error, duration time.Duration) {
+					requestCalls++
+				})
+			}
+			req, err := http.NewRequestWithContext(ctx, http.MethodGet, "http://example.com", nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			_, _ = rt.RoundTrip(req)
+			assert.Equal(t, tc.wantTransportCall, transportCalls)
+			assert.Equal(t, tc.wantRequestCall, requestCalls)
+		})
+	}
+}
+
+func Test_AttemptDurationFromContext(t *testing.T) {
+	type test struct {
+		name         string
+		latency      time.Duration
+		wantAttempts int
+	}
+	tests := []test{
+		{
+			name:         "slow failure is retried",
+			latency:      50 * time.Millisecond,
+			wantAttempts: 2,
+		},
+		{
+			name:         "fast failure is not retried",
+			wantAttempts: 1,
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			calledCount := 0
+			var durations []time.Duration
+			rt := retryabletransport.New(
+				roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+					calledCount++
+					time.Sleep(tc.latency)
+					return &http.Response{StatusCode: http.StatusServiceUnavailable}, nil
+				}),
+				func(req *http.Request, resp *http.Response, err error) bool {
+					d, ok := retryabletransport.AttemptDurationFromContext(req.Context())
+					assert.True(t, ok)
+					durations = append(durations, d)
+					return d >= 20*time.Millisecond
+				},
+				nil,
+				&retryabletransport.BackOffPolicy{MaxRetries: 1, InitialInterval: time.Millisecond},
+			)
+			req, err := http.NewRequest(http.MethodGet, "http://example.com", nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			_, _ = rt.RoundTrip(req)
+			assert.Equal(t, tc.wantAttempts, calledCount)
+			for _, d := range durations {
+				assert.GreaterOrEqual(t, d, tc.latency)
+			}
+		})
+	}
+	_, ok := retryabletransport.AttemptDurationFromContext(context.Background())
+	assert.False(t, ok)
+}
+
+func Test_WithRequestTransport(t *testing.T) {
+	var defaultCalls, requestCalls int
+	rt := retryabletransport.New(
+		roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+			defaultCalls++
+			return &http.Response{StatusCode: http.StatusOK}, nil
+		}),
+		nil,
+		nil,
+		&retryabletransport.BackOffPolicy{MaxRetries: 1, InitialInterval: time.Millisecond},
+	)
+	override := roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		requestCalls++
+		return &http.Response{StatusCode: http.StatusServiceUnavailable}, nil
+	})
+	type test struct {
+		name             string
+		ctx              context.Context
+		wantDefaultCalls int
+		wantRequestCalls int
+	}
+	tests := []test{
+		{
+			name:             "override is retried instead of the configured transport",
+			ctx:              retryabletransport.WithRequestTransport(context.Background(), override),
+			wantRequestCalls: 2,
+		},
+		{
+			name:             "nil falls back to the configured transport",
+			ctx:              retryabletransport.WithRequestTransport(context.Background(), nil),
+			wantDefaultCalls: 1,
+		},
+		{
+			name:             "configured transport is used without an override",
+			ctx:              context.Background(),
+			wantDefaultCalls: 1,
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			defaultCalls, requestCalls = 0, 0
+			req, err := http.NewRequestWithContext(tc.ctx, http.MethodGet, "http://example.com", nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			_, _ = rt.RoundTrip(req)
+			assert.Equal(t, tc.wantDefaultCalls, defaultCalls)
+			assert.Equal(t, tc.wantRequestCalls, requestCalls)
+		})
+	}
+}
+
+func Test_ReuploadedBytesFromContext(t *testing.T) {
+	type test struct {
+		name           string
+		failures       int
+		noGetBody      bool
+		wantReuploaded int64
+	}
+	tests := []test{
+		{
+			name:           "retries replaying a buffered body",
+			failures:       2,
+			noGetBody:      true,
+			wantReuploaded: 2 * 1000,
+		},
+		{
+			name:           "retries replaying a body through GetBody",
+			failures:       1,
+			wantReuploaded: 1000,
+		},
+		{
+			name: "no retries",
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			calledCount := 0
+			rt := retryabletransport.New(
+				roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+					calledCount++
+					if _, err := io.Copy(io.Discard, req.Body); err != nil {
+						return nil, err
+					}
+					if calledCount <= tc.failures {
+						return &http.Response{StatusCode: http.StatusServiceUnavailable, Body: http.NoBody}, nil
+					}
+					return &http.Response{StatusCode: http.StatusOK, Body: http.NoBody}, nil
+				}),
+				nil,
+				nil,
+				&retryabletransport.BackOffPolicy{MaxRetries: 3, InitialInterval: time.Millisecond},
+			)
+			req, err := http.NewRequest(http.MethodPut, "http://example.com", strings.NewReader(strings.Repeat("x", 1000)))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tc.noGetBody {
+				req.GetBody = nil
+			}
+			resp, err := rt.RoundTrip(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			reuploaded, ok := retryabletransport.ReuploadedBytesFromContext(resp.Request.Context())
+			assert.True(t, ok)
+			assert.Equal(t, tc.wantReuploaded, reuploaded)
+		})
+	}
+}
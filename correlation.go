@@ -0,0 +1,36 @@
+package retryabletransport
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+)
+
+// WithCorrelationHeader sets the header name on every attempt of a request to the same ID, generated with gen on the
+// first attempt, so that server logs and distributed traces can tie the attempts of a logical request together.
+// If the request carries the header already, its value is kept instead. If gen is nil, a random 128-bit ID in hex is
+// generated. The caller's request is never modified; each attempt is sent as a clone carrying the header.
+func WithCorrelationHeader(name string, gen func() string) Option {
+	if gen == nil {
+		gen = randomID
+	}
+	return func(p *RoundTripper) {
+		p.correlationHeader = name
+		p.correlationIDFunc = gen
+	}
+}
+
+// correlationID returns the ID the attempts of the request set in the correlation header, or an empty string
+// if the request carries the header already.
+func (p *RoundTripper) correlationID(state *retryState) string {
+	if state.attempts == 0 && state.req.Header.Get(p.correlationHeader) == "" {
+		state.correlationID = p.correlationIDFunc()
+	}
+	return state.correlationID
+}
+
+// randomID returns a random 128-bit ID in hex.
+func randomID() string {
+	var b [16]byte
+	_, _ = rand.Read(b[:])
+	return hex.EncodeToString(b[:])
+}
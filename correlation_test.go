@@ -0,0 +1,85 @@
+package retryabletransport_test
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/linzhengen/retryabletransport"
+	"github.com/linzhengen/retryabletransport/retrytest"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_WithCorrelationHeader(t *testing.T) {
+	type test struct {
+		name   string
+		gen    func() string
+		header string
+		wantID string
+	}
+	tests := []test{
+		{
+			name:   "generated ID is set on every attempt",
+			gen:    func() string { return "generated" },
+			wantID: "generated",
+		},
+		{
+			name:   "existing header is kept",
+			gen:    func() string { return "generated" },
+			header: "existing",
+			wantID: "existing",
+		},
+		{
+			name: "random ID is generated by default",
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			genCount := 0
+			gen := tc.gen
+			if gen != nil {
+				gen = func() string {
+					genCount++
+					return tc.gen()
+				}
+			}
+			recorder := retrytest.NewRecordingRoundTripper(roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+				return &http.Response{StatusCode: http.StatusServiceUnavailable, Body: http.NoBody}, nil
+			}))
+			rt := retryabletransport.New(
+				recorder,
+				nil,
+				nil,
+				&retryabletransport.BackOffPolicy{MaxRetries: 2, InitialInterval: time.Millisecond},
+				retryabletransport.WithCorrelationHeader("X-Correlation-Id", gen),
+			)
+			req, err := http.NewRequest(http.MethodGet, "http://example.com", nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tc.header != "" {
+				req.Header.Set("X-Correlation-Id", tc.header)
+			}
+			_, _ = rt.RoundTrip(req)
+			requests := recorder.Requests()
+			if !assert.Len(t, requests, 3) {
+				return
+			}
+			id := requests[0].Header.Get("X-Correlation-Id")
+			if tc.wantID != "" {
+				assert.Equal(t, tc.wantID, id)
+			} else {
+				assert.Len(t, id, 32)
+			}
+			for _, r := range requests {
+				assert.Equal(t, id, r.Header.Get("X-Correlation-Id"))
+			}
+			if tc.gen != nil && tc.header == "" {
+				assert.Equal(t, 1, genCount)
+			} else {
+				assert.Equal(t, 0, genCount)
+			}
+			assert.Equal(t, tc.header, req.Header.Get("X-Correlation-Id"), "the caller's request must not be modified")
+		})
+	}
+}
@@ -0,0 +1,107 @@
+package retryabletransport
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// DebugDecision is the decision taken on the outcome of an attempt, as recorded by WithDebugTrace.
+type DebugDecision string
+
+const (
+	// DecisionSuccess ends the request with a successful response.
+	DecisionSuccess DebugDecision = "success"
+	// DecisionRetry retries the attempt, unless the retries ran out.
+	DecisionRetry DebugDecision = "retry"
+	// DecisionNoRetry ends the request because shouldRetryFunc did not retry the attempt.
+	DecisionNoRetry DebugDecision = "no retry"
+	// DecisionSentAlready ends the request because a non-idempotent request failed after being sent.
+	DecisionSentAlready DebugDecision = "sent already"
+	// DecisionBodyNotReplayable ends the request because its body cannot be sent again, see WithoutBodyBuffering.
+	DecisionBodyNotReplayable DebugDecision = "body not replayable"
+	// DecisionDropExpect retries the attempt without the 100-continue handshake the server refused.
+	DecisionDropExpect DebugDecision = "retry without Expect"
+	// DecisionRefreshToken resends the request with a refreshed token after a 401, see WithTokenRefresh.
+	DecisionRefreshToken DebugDecision = "retry with refreshed token"
+)
+
+// DebugTraceEntry records an attempt of a request and the decision taken on its outcome.
+type DebugTraceEntry struct {
+	// Attempt is the zero-based number of the attempt.
+	Attempt uint64
+	// StatusCode is the status code of the response, or zero if there is none.
+	StatusCode int
+	// Err is the error of the attempt, if any.
+	Err      error
+	Decision DebugDecision
+	// Retried reports whether a retry was scheduled after Delay, which a retry decision is not if the retries ran
+	// out. A scheduled retry is not made if the request context is done while waiting for it.
+	Retried bool
+	Delay   time.Duration
+	// Timings is the breakdown of the time the attempt took if WithAttemptTimings is used, or nil otherwise.
+	Timings *AttemptTimings
+}
+
+// debugTraceKey is the context key for the debug trace of a request.
+type debugTraceKey struct{}
+
+// debugTrace collects the entries recorded for a request.
+type debugTrace struct {
+	mu      sync.Mutex
+	entries []DebugTraceEntry
+}
+
+// WithDebugTrace returns a context that makes RoundTripper record every attempt of requests made with it, along
+// with the decision taken on its outcome, for diagnosing why a request was or was not retried. The entries are
+// retrieved with DebugTraceFromContext from the returned context once the request returns, even if it failed.
+// Requests made without it record nothing.
+func WithDebugTrace(ctx context.Context) context.Context {
+	return context.WithValue(ctx, debugTraceKey{}, &debugTrace{})
+}
+
+// DebugTraceFromContext returns the entries recorded for requests made with ctx, a context returned by
+// WithDebugTrace or derived from one.
+func DebugTraceFromContext(ctx context.Context) ([]DebugTraceEntry, bool) {
+	t, ok := ctx.Value(debugTraceKey{}).(*debugTrace)
+	if !ok {
+		return nil, false
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return append([]DebugTraceEntry(nil), t.entries...), true
+}
+
+// debugTraceFor returns the debug trace of req, or nil if it is not traced.
+func debugTraceFor(req *http.Request) *debugTrace {
+	t, _ := req.Context().Value(debugTraceKey{}).(*debugTrace)
+	return t
+}
+
+// recordDecision records the latest attempt of state and decision in its debug trace, if any.
+func (s *retryState) recordDecision(decision DebugDecision) {
+	if s.debugTrace == nil {
+		return
+	}
+	e := DebugTraceEntry{Attempt: s.attempts - 1, Err: s.err, Decision: decision, Timings: s.timings}
+	if s.resp != nil {
+		e.StatusCode = s.resp.StatusCode
+	}
+	s.debugTrace.mu.Lock()
+	defer s.debugTrace.mu.Unlock()
+	s.debugTrace.entries = append(s.debugTrace.entries, e)
+}
+
+// recordRetry records in the debug trace of state, if any, that the latest attempt is retried after delay.
+func (s *retryState) recordRetry(delay time.Duration) {
+	if s.debugTrace == nil {
+		return
+	}
+	s.debugTrace.mu.Lock()
+	defer s.debugTrace.mu.Unlock()
+	if n := len(s.debugTrace.entries); n > 0 {
+		s.debugTrace.entries[n-1].Retried = true
+		s.debugTrace.entries[n-1].Delay = delay
+	}
+}
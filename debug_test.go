@@ -0,0 +1,84 @@
+package retryabletransport_test
+
+import (
+	"context"
+	"net/http"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/linzhengen/retryabletransport"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_WithDebugTrace(t *testing.T) {
+	type test struct {
+		name  string
+		resps []*http.Response
+		errs  []error
+		want  []retryabletransport.DebugTraceEntry
+	}
+	tests := []test{
+		{
+			name:  "retried until success",
+			resps: []*http.Response{{StatusCode: http.StatusServiceUnavailable}, nil, {StatusCode: http.StatusOK}},
+			errs:  []error{nil, syscall.ECONNREFUSED, nil},
+			want: []retryabletransport.DebugTraceEntry{
+				{Attempt: 0, StatusCode: http.StatusServiceUnavailable, Decision: retryabletransport.DecisionRetry, Retried: true, Delay: time.Millisecond},
+				{Attempt: 1, Err: syscall.ECONNREFUSED, Decision: retryabletransport.DecisionRetry, Retried: true, Delay: time.Millisecond},
+				{Attempt: 2, StatusCode: http.StatusOK, Decision: retryabletransport.DecisionSuccess},
+			},
+		},
+		{
+			name:  "not retryable",
+			resps: []*http.Response{{StatusCode: http.StatusBadRequest}},
+			errs:  []error{nil},
+			want: []retryabletransport.DebugTraceEntry{
+				{Attempt: 0, StatusCode: http.StatusBadRequest, Decision: retryabletransport.DecisionNoRetry},
+			},
+		},
+		{
+			name:  "retries ran out",
+			resps: []*http.Response{{StatusCode: http.StatusServiceUnavailable}, {StatusCode: http.StatusServiceUnavailable}, {StatusCode: http.StatusServiceUnavailable}},
+			errs:  []error{nil, nil, nil},
+			want: []retryabletransport.DebugTraceEntry{
+				{Attempt: 0, StatusCode: http.StatusServiceUnavailable, Decision: retryabletransport.DecisionRetry, Retried: true, Delay: time.Millisecond},
+				{Attempt: 1, StatusCode: http.StatusServiceUnavailable, Decision: retryabletransport.DecisionRetry, Retried: true, Delay: time.Millisecond},
+				{Attempt: 2, StatusCode: http.StatusServiceUnavailable, Decision: retryabletransport.DecisionRetry},
+			},
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			calledCount := 0
+			rt := retryabletransport.New(
+				roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+					resp, err := tc.resps[calledCount], tc.errs[calledCount]
+					calledCount++
+					return resp, err
+				}),
+				nil,
+				nil,
+				&retryabletransport.BackOffPolicy{
+					MaxRetries:          2,
+					InitialInterval:     time.Millisecond,
+					Multiplier:          1,
+					RandomizationFactor: -1,
+				},
+			)
+			ctx := retryabletransport.WithDebugTrace(context.Background())
+			req, err := http.NewRequestWithContext(ctx, http.MethodGet, "http://example.com", nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			_, _ = rt.RoundTrip(req)
+			entries, ok := retryabletransport.DebugTraceFromContext(ctx)
+			assert.True(t, ok)
+			assert.Equal(t, tc.want, entries)
+		})
+	}
+	t.Run("untraced requests record nothing", func(t *testing.T) {
+		_, ok := retryabletransport.DebugTraceFromContext(context.Background())
+		assert.False(t, ok)
+	})
+}
@@ -0,0 +1,37 @@
+package retryabletransport
+
+import (
+	"io"
+	"net/http"
+)
+
+// DefaultMaxDrainBodyBytes is the default maximum number of response body bytes drained before a retry.
+const DefaultMaxDrainBodyBytes = 4 << 10
+
+// WithMaxDrainBodyBytes sets the maximum number of bytes drained from the body of a response that is retried
+// before the body is closed. Draining the body lets the underlying connection be reused for the next attempt,
+// but draining a huge error page wastes time, so bodies larger than n are closed with the rest unread, accepting
+// that their connection is not reused. A negative n closes bodies without draining them. It defaults to
+// DefaultMaxDrainBodyBytes.
+func WithMaxDrainBodyBytes(n int64) Option {
+	return func(p *RoundTripper) {
+		p.maxDrainBodyBytes = n
+	}
+}
+
+// drainLimit returns the maximum number of response body bytes drained before a retry.
+func (p *RoundTripper) drainLimit() int64 {
+	if p.maxDrainBodyBytes == 0 {
+		return DefaultMaxDrainBodyBytes
+	}
+	return max(p.maxDrainBodyBytes, 0)
+}
+
+// drainBody drains up to limit bytes of the body of a response that is retried and closes it.
+func drainBody(resp *http.Response, limit int64) {
+	if resp == nil || resp.Body == nil {
+		return
+	}
+	_, _ = io.CopyN(io.Discard, resp.Body, limit)
+	_ = resp.Body.Close()
+}
@@ -0,0 +1,94 @@
+package retryabletransport_test
+
+import (
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/linzhengen/retryabletransport"
+	"github.com/stretchr/testify/assert"
+)
+
+// trackingBody records how much of it was read and whether it was closed.
+type trackingBody struct {
+	r      io.Reader
+	read   int
+	closed bool
+}
+
+func (b *trackingBody) Read(p []byte) (int, error) {
+	n, err := b.r.Read(p)
+	b.read += n
+	return n, err
+}
+
+func (b *trackingBody) Close() error {
+	b.closed = true
+	return nil
+}
+
+func Test_WithMaxDrainBodyBytes(t *testing.T) {
+	type test struct {
+		name     string
+		bodySize int
+		opts     []retryabletransport.Option
+		wantRead int
+	}
+	tests := []test{
+		{
+			name:     "body within the default limit is drained",
+			bodySize: 1 << 10,
+			wantRead: 1 << 10,
+		},
+		{
+			name:     "body over the default limit is drained up to it",
+			bodySize: 1 << 20,
+			wantRead: retryabletransport.DefaultMaxDrainBodyBytes,
+		},
+		{
+			name:     "body over the configured limit is drained up to it",
+			bodySize: 1 << 10,
+			opts:     []retryabletransport.Option{retryabletransport.WithMaxDrainBodyBytes(100)},
+			wantRead: 100,
+		},
+		{
+			name:     "negative limit disables draining",
+			bodySize: 1 << 10,
+			opts:     []retryabletransport.Option{retryabletransport.WithMaxDrainBodyBytes(-1)},
+			wantRead: 0,
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			var bodies []*trackingBody
+			rt := retryabletransport.New(
+				roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+					body := &trackingBody{r: strings.NewReader(strings.Repeat("x", tc.bodySize))}
+					bodies = append(bodies, body)
+					return &http.Response{StatusCode: http.StatusServiceUnavailable, Body: body}, nil
+				}),
+				nil,
+				nil,
+				&retryabletransport.BackOffPolicy{MaxRetries: 1, InitialInterval: time.Millisecond},
+				tc.opts...,
+			)
+			req, err := http.NewRequest(http.MethodGet, "http://example.com", nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			resp, _ := rt.RoundTrip(req)
+			if !assert.Len(t, bodies, 2) {
+				return
+			}
+			assert.Equal(t, tc.wantRead, bodies[0].read)
+			assert.True(t, bodies[0].closed)
+
+			// The response returned to the caller is left untouched.
+			assert.Equal(t, 0, bodies[1].read)
+			assert.False(t, bodies[1].closed)
+			assert.Same(t, bodies[1], resp.Body)
+		})
+	}
+}
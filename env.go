@@ -0,0 +1,143 @@
+package retryabletransport
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// FromEnv creates a RoundTripper using http.DefaultTransport and DefaultShouldRetry, configured from environment
+// variables whose names are prefix, an underscore, and one of the following, e.g. HTTP_RETRY_MAX_RETRIES for the
+// prefix "HTTP_RETRY". Unset or empty variables keep their default.
+//
+//   - MAX_RETRIES: BackOffPolicy.MaxRetries, a non-negative integer
+//   - INITIAL_INTERVAL, MAX_INTERVAL, MAX_ELAPSED_TIME, CEILING_INTERVAL, MIN_INTERVAL, ABSOLUTE_MAX_SLEEP: the
+//     BackOffPolicy field of that name, a duration such as "500ms"
+//   - MULTIPLIER, RANDOMIZATION_FACTOR: the BackOffPolicy field of that name, a number of at least 1 and at most
+//     1, respectively
+//   - FIRST_RETRY_IMMEDIATE: BackOffPolicy.FirstRetryImmediate, a boolean such as "true"
+//   - TOTAL_TIMEOUT: WithTotalTimeout, a duration
+//   - MAX_CONCURRENT_RETRIES: WithMaxConcurrentRetries, a non-negative integer
+//   - RETRY_AFTER: WithRetryAfter if true, a boolean
+//
+// Durations must not be negative. Invalid values are reported, all at once, by an error naming the variables. opts
+// are applied after the settings read from the environment.
+func FromEnv(prefix string, opts ...Option) (*RoundTripper, error) {
+	if prefix != "" && !strings.HasSuffix(prefix, "_") {
+		prefix += "_"
+	}
+	e := envReader{prefix: prefix}
+	policy := &BackOffPolicy{MaxRetries: 3}
+	e.uint("MAX_RETRIES", &policy.MaxRetries)
+	e.duration("INITIAL_INTERVAL", &policy.InitialInterval)
+	e.duration("MAX_INTERVAL", &policy.MaxInterval)
+	e.duration("MAX_ELAPSED_TIME", &policy.MaxElapsedTime)
+	e.duration("CEILING_INTERVAL", &policy.CeilingInterval)
+	e.duration("MIN_INTERVAL", &policy.MinInterval)
+	e.duration("ABSOLUTE_MAX_SLEEP", &policy.AbsoluteMaxSleep)
+	e.float("MULTIPLIER", &policy.Multiplier, func(v float64) error {
+		if v != 0 && v < 1 {
+			return errors.New("must be at least 1")
+		}
+		return nil
+	})
+	e.float("RANDOMIZATION_FACTOR", &policy.RandomizationFactor, func(v float64) error {
+		if v > 1 {
+			return errors.New("must be at most 1")
+		}
+		return nil
+	})
+	e.bool("FIRST_RETRY_IMMEDIATE", &policy.FirstRetryImmediate)
+	var envOpts []Option
+	var totalTimeout time.Duration
+	if e.duration("TOTAL_TIMEOUT", &totalTimeout) {
+		envOpts = append(envOpts, WithTotalTimeout(totalTimeout))
+	}
+	var maxConcurrentRetries int
+	if e.int("MAX_CONCURRENT_RETRIES", &maxConcurrentRetries) {
+		envOpts = append(envOpts, WithMaxConcurrentRetries(maxConcurrentRetries))
+	}
+	var retryAfter bool
+	if e.bool("RETRY_AFTER", &retryAfter) && retryAfter {
+		envOpts = append(envOpts, WithRetryAfter())
+	}
+	if err := errors.Join(e.errs...); err != nil {
+		return nil, err
+	}
+	return New(nil, nil, nil, policy, append(envOpts, opts...)...), nil
+}
+
+// envReader reads the environment variables of FromEnv, collecting the errors of invalid values.
+type envReader struct {
+	prefix string
+	errs   []error
+}
+
+// lookup returns the value of the variable name, and whether it is set and not empty.
+func (e *envReader) lookup(name string) (string, bool) {
+	v := os.Getenv(e.prefix + name)
+	return v, v != ""
+}
+
+// read parses the variable name with parse, reporting whether it was set to a valid value.
+func (e *envReader) read(name string, parse func(string) error) bool {
+	v, ok := e.lookup(name)
+	if !ok {
+		return false
+	}
+	if err := parse(v); err != nil {
+		e.errs = append(e.errs, fmt.Errorf("invalid %s%s %q: %w", e.prefix, name, v, err))
+		return false
+	}
+	return true
+}
+
+func (e *envReader) uint(name string, dst *uint64) bool {
+	return e.read(name, func(v string) (err error) {
+		*dst, err = strconv.ParseUint(v, 10, 64)
+		return err
+	})
+}
+
+// errNegative is the error of negative values where they are not allowed.
+var errNegative = errors.New("must not be negative")
+
+func (e *envReader) int(name string, dst *int) bool {
+	return e.read(name, func(v string) (err error) {
+		*dst, err = strconv.Atoi(v)
+		if err == nil && *dst < 0 {
+			err = errNegative
+		}
+		return err
+	})
+}
+
+// float reads a number, which also has to pass check.
+func (e *envReader) float(name string, dst *float64, check func(float64) error) bool {
+	return e.read(name, func(v string) (err error) {
+		if *dst, err = strconv.ParseFloat(v, 64); err != nil {
+			return err
+		}
+		return check(*dst)
+	})
+}
+
+func (e *envReader) bool(name string, dst *bool) bool {
+	return e.read(name, func(v string) (err error) {
+		*dst, err = strconv.ParseBool(v)
+		return err
+	})
+}
+
+func (e *envReader) duration(name string, dst *time.Duration) bool {
+	return e.read(name, func(v string) (err error) {
+		*dst, err = time.ParseDuration(v)
+		if err == nil && *dst < 0 {
+			err = errNegative
+		}
+		return err
+	})
+}
@@ -0,0 +1,78 @@
+package retryabletransport_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/linzhengen/retryabletransport"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_FromEnv(t *testing.T) {
+	t.Run("valid values", func(t *testing.T) {
+		t.Setenv("HTTP_RETRY_MAX_RETRIES", "5")
+		t.Setenv("HTTP_RETRY_INITIAL_INTERVAL", "100ms")
+		t.Setenv("HTTP_RETRY_MAX_INTERVAL", "2s")
+		t.Setenv("HTTP_RETRY_MIN_INTERVAL", "50ms")
+		t.Setenv("HTTP_RETRY_ABSOLUTE_MAX_SLEEP", "3s")
+		t.Setenv("HTTP_RETRY_MULTIPLIER", "2")
+		t.Setenv("HTTP_RETRY_FIRST_RETRY_IMMEDIATE", "true")
+		t.Setenv("HTTP_RETRY_TOTAL_TIMEOUT", "30s")
+		t.Setenv("HTTP_RETRY_RETRY_AFTER", "true")
+		rt, err := retryabletransport.FromEnv("HTTP_RETRY")
+		if err != nil {
+			t.Fatal(err)
+		}
+		cfg := rt.Config()
+		assert.True(t, cfg.DefaultShouldRetry)
+		assert.Equal(t, uint64(5), cfg.BackOffPolicy.MaxRetries)
+		assert.Equal(t, 100*time.Millisecond, cfg.BackOffPolicy.InitialInterval)
+		assert.Equal(t, 2*time.Second, cfg.BackOffPolicy.MaxInterval)
+		assert.Equal(t, 50*time.Millisecond, cfg.BackOffPolicy.MinInterval)
+		assert.Equal(t, 3*time.Second, cfg.BackOffPolicy.AbsoluteMaxSleep)
+		assert.Equal(t, float64(2), cfg.BackOffPolicy.Multiplier)
+		assert.True(t, cfg.BackOffPolicy.FirstRetryImmediate)
+		assert.Equal(t, 30*time.Second, cfg.TotalTimeout)
+		assert.True(t, cfg.RetryAfter)
+		assert.Equal(t, 0, cfg.MaxConcurrentRetries)
+	})
+	t.Run("unset values keep their default", func(t *testing.T) {
+		rt, err := retryabletransport.FromEnv("HTTP_RETRY_UNSET")
+		if err != nil {
+			t.Fatal(err)
+		}
+		assert.Equal(t, retryabletransport.New(nil, nil, nil, nil).Config(), rt.Config())
+	})
+	t.Run("invalid values are reported", func(t *testing.T) {
+		t.Setenv("HTTP_RETRY_MAX_RETRIES", "-1")
+		t.Setenv("HTTP_RETRY_INITIAL_INTERVAL", "100")
+		rt, err := retryabletransport.FromEnv("HTTP_RETRY_")
+		assert.Nil(t, rt)
+		if assert.Error(t, err) {
+			assert.Contains(t, err.Error(), `invalid HTTP_RETRY_MAX_RETRIES "-1"`)
+			assert.Contains(t, err.Error(), `invalid HTTP_RETRY_INITIAL_INTERVAL "100"`)
+		}
+	})
+	t.Run("out of range values are reported", func(t *testing.T) {
+		type test struct {
+			name    string
+			value   string
+			wantErr string
+		}
+		tests := []test{
+			{name: "MAX_CONCURRENT_RETRIES", value: "-1", wantErr: "must not be negative"},
+			{name: "INITIAL_INTERVAL", value: "-1s", wantErr: "must not be negative"},
+			{name: "TOTAL_TIMEOUT", value: "-1s", wantErr: "must not be negative"},
+			{name: "MULTIPLIER", value: "0.5", wantErr: "must be at least 1"},
+			{name: "RANDOMIZATION_FACTOR", value: "1.5", wantErr: "must be at most 1"},
+		}
+		for _, tc := range tests {
+			t.Run(tc.name, func(t *testing.T) {
+				t.Setenv("HTTP_RETRY_"+tc.name, tc.value)
+				rt, err := retryabletransport.FromEnv("HTTP_RETRY")
+				assert.Nil(t, rt)
+				assert.EqualError(t, err, "invalid HTTP_RETRY_"+tc.name+` "`+tc.value+`": `+tc.wantErr)
+			})
+		}
+	})
+}
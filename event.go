@@ -0,0 +1,41 @@
+package retryabletransport
+
+import "time"
+
+// RetryEvent describes a retry, as sent by WithEventChannel.
+type RetryEvent struct {
+	// Attempt is the zero-based number of the attempt that failed and is retried.
+	Attempt uint64
+	// StatusCode is the status code of the response of the failed attempt, or zero if there is none.
+	StatusCode int
+	// Err is the error of the failed attempt, if any.
+	Err error
+	// Delay is the wait before the retry.
+	Delay time.Duration
+	// Host is the host the failed attempt was sent to.
+	Host string
+}
+
+// WithEventChannel sends a RetryEvent to ch for every retry, e.g. for custom dashboards or tests. Sends never
+// block: if ch is full, the event is dropped, so that a slow consumer cannot stall requests, and ch should be
+// buffered accordingly. The RoundTripper never closes ch.
+func WithEventChannel(ch chan<- RetryEvent) Option {
+	return func(p *RoundTripper) {
+		p.eventChannel = ch
+	}
+}
+
+// sendEvent sends the RetryEvent of the latest attempt of state, retried after delay, unless the channel is full.
+func (p *RoundTripper) sendEvent(state *retryState, delay time.Duration) {
+	e := RetryEvent{Attempt: state.attempts - 1, Err: state.err, Delay: delay, Host: state.host}
+	if state.resp != nil {
+		e.StatusCode = state.resp.StatusCode
+	}
+	if e.Host == "" {
+		e.Host = state.req.URL.Host
+	}
+	select {
+	case p.eventChannel <- e:
+	default:
+	}
+}
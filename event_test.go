@@ -0,0 +1,68 @@
+package retryabletransport_test
+
+import (
+	"net/http"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/linzhengen/retryabletransport"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_WithEventChannel(t *testing.T) {
+	newTransport := func(ch chan<- retryabletransport.RetryEvent) *retryabletransport.RoundTripper {
+		calledCount := 0
+		return retryabletransport.New(
+			roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+				calledCount++
+				switch calledCount {
+				case 1:
+					return &http.Response{StatusCode: http.StatusServiceUnavailable}, nil
+				case 2:
+					return nil, syscall.ECONNREFUSED
+				}
+				return &http.Response{StatusCode: http.StatusOK}, nil
+			}),
+			nil,
+			nil,
+			&retryabletransport.BackOffPolicy{
+				MaxRetries:          2,
+				InitialInterval:     time.Millisecond,
+				Multiplier:          1,
+				RandomizationFactor: -1,
+			},
+			retryabletransport.WithEventChannel(ch),
+		)
+	}
+	t.Run("every retry is sent", func(t *testing.T) {
+		ch := make(chan retryabletransport.RetryEvent, 10)
+		req, err := http.NewRequest(http.MethodGet, "http://example.com", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, err = newTransport(ch).RoundTrip(req)
+		assert.NoError(t, err)
+		close(ch)
+		var events []retryabletransport.RetryEvent
+		for e := range ch {
+			events = append(events, e)
+		}
+		assert.Equal(t, []retryabletransport.RetryEvent{
+			{Attempt: 0, StatusCode: http.StatusServiceUnavailable, Delay: time.Millisecond, Host: "example.com"},
+			{Attempt: 1, Err: syscall.ECONNREFUSED, Delay: time.Millisecond, Host: "example.com"},
+		}, events)
+	})
+	t.Run("events are dropped when the channel is full", func(t *testing.T) {
+		ch := make(chan retryabletransport.RetryEvent, 1)
+		req, err := http.NewRequest(http.MethodGet, "http://example.com", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp, err := newTransport(ch).RoundTrip(req)
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		assert.Len(t, ch, 1)
+		assert.Equal(t, uint64(0), (<-ch).Attempt)
+	})
+}
@@ -0,0 +1,61 @@
+package retryabletransport
+
+import (
+	"errors"
+	"math/rand/v2"
+	"net/http"
+	"strconv"
+)
+
+// FaultStatusError makes an attempt failed by WithFaultInjection get a response with StatusCode instead of
+// an error.
+type FaultStatusError struct {
+	StatusCode int
+}
+
+func (e *FaultStatusError) Error() string {
+	return "injected fault: status " + strconv.Itoa(e.StatusCode)
+}
+
+// WithFaultInjection fails each attempt with probability rate, between 0 and 1, before it reaches the network,
+// for verifying in staging or tests that retries and backoff behave as designed under failures. A failed attempt
+// gets the error returned by failure, or a response with the status code of a *FaultStatusError it returns. If
+// failure is nil, attempts fail with 503 Service Unavailable. It is disabled by default.
+func WithFaultInjection(rate float64, failure func() error) Option {
+	if failure == nil {
+		failure = func() error {
+			return &FaultStatusError{StatusCode: http.StatusServiceUnavailable}
+		}
+	}
+	return func(p *RoundTripper) {
+		p.faultRate = rate
+		p.faultFunc = failure
+	}
+}
+
+// injectsFault reports whether the next attempt fails by fault injection.
+func (p *RoundTripper) injectsFault() bool {
+	return p.faultRate > 0 && rand.Float64() < p.faultRate
+}
+
+// fault returns the outcome of an attempt of req failed by fault injection.
+func (p *RoundTripper) fault(req *http.Request) (*http.Response, error) {
+	if req.Body != nil {
+		_ = req.Body.Close()
+	}
+	err := p.faultFunc()
+	var statusErr *FaultStatusError
+	if !errors.As(err, &statusErr) {
+		return nil, err
+	}
+	return &http.Response{
+		Status:     strconv.Itoa(statusErr.StatusCode) + " " + http.StatusText(statusErr.StatusCode),
+		StatusCode: statusErr.StatusCode,
+		Proto:      "HTTP/1.1",
+		ProtoMajor: 1,
+		ProtoMinor: 1,
+		Header:     http.Header{},
+		Body:       http.NoBody,
+		Request:    req,
+	}, nil
+}
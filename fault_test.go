@@ -0,0 +1,85 @@
+package retryabletransport_test
+
+import (
+	"net/http"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/linzhengen/retryabletransport"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_WithFaultInjection(t *testing.T) {
+	type test struct {
+		name         string
+		rate         float64
+		failure      func() error
+		wantStatus   int
+		wantErr      error
+		wantNetwork  int
+		wantAttempts uint64
+	}
+	tests := []test{
+		{
+			name:         "every attempt fails with 503 by default",
+			rate:         1,
+			wantStatus:   http.StatusServiceUnavailable,
+			wantAttempts: 3,
+		},
+		{
+			name: "every attempt fails with the chosen status",
+			rate: 1,
+			failure: func() error {
+				return &retryabletransport.FaultStatusError{StatusCode: http.StatusTooManyRequests}
+			},
+			wantStatus:   http.StatusTooManyRequests,
+			wantAttempts: 3,
+		},
+		{
+			name:         "every attempt fails with the chosen error",
+			rate:         1,
+			failure:      func() error { return syscall.ECONNREFUSED },
+			wantErr:      syscall.ECONNREFUSED,
+			wantAttempts: 3,
+		},
+		{
+			name:         "no attempt fails with a zero rate",
+			rate:         0,
+			wantStatus:   http.StatusOK,
+			wantNetwork:  1,
+			wantAttempts: 1,
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			network := 0
+			rt := retryabletransport.New(
+				roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+					network++
+					return &http.Response{StatusCode: http.StatusOK, Body: http.NoBody}, nil
+				}),
+				nil,
+				nil,
+				&retryabletransport.BackOffPolicy{MaxRetries: 2, InitialInterval: time.Millisecond},
+				retryabletransport.WithFaultInjection(tc.rate, tc.failure),
+			)
+			req, err := http.NewRequest(http.MethodGet, "http://example.com", nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			resp, err := rt.RoundTrip(req)
+			if tc.wantErr != nil {
+				assert.ErrorIs(t, err, tc.wantErr)
+				return
+			}
+			if !assert.NoError(t, err) {
+				return
+			}
+			assert.Equal(t, tc.wantStatus, resp.StatusCode)
+			assert.Equal(t, tc.wantNetwork, network)
+			attempts, _ := retryabletransport.AttemptsFromContext(resp.Request.Context())
+			assert.Equal(t, tc.wantAttempts, attempts)
+		})
+	}
+}
@@ -0,0 +1,104 @@
+package retryabletransport
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// FileConfig is a plain configuration of a RoundTripper, for loading from configuration files with decoders such
+// as encoding/json or YAML libraries, which is applied by FromConfig. Durations are given in milliseconds, so that
+// they decode the same way with any decoder. Zero values keep their default, except for MaxRetries, which is a
+// pointer so that zero retries can be told apart from an unset field.
+type FileConfig struct {
+	// MaxRetries is BackOffPolicy.MaxRetries. It defaults to 3.
+	MaxRetries *uint64 `json:"max_retries,omitempty" yaml:"max_retries,omitempty"`
+	// InitialIntervalMS, MaxIntervalMS, MaxElapsedTimeMS, CeilingIntervalMS, MinIntervalMS, and AbsoluteMaxSleepMS
+	// are the BackOffPolicy fields of those names.
+	InitialIntervalMS  int64 `json:"initial_interval_ms,omitempty" yaml:"initial_interval_ms,omitempty"`
+	MaxIntervalMS      int64 `json:"max_interval_ms,omitempty" yaml:"max_interval_ms,omitempty"`
+	MaxElapsedTimeMS   int64 `json:"max_elapsed_time_ms,omitempty" yaml:"max_elapsed_time_ms,omitempty"`
+	CeilingIntervalMS  int64 `json:"ceiling_interval_ms,omitempty" yaml:"ceiling_interval_ms,omitempty"`
+	MinIntervalMS      int64 `json:"min_interval_ms,omitempty" yaml:"min_interval_ms,omitempty"`
+	AbsoluteMaxSleepMS int64 `json:"absolute_max_sleep_ms,omitempty" yaml:"absolute_max_sleep_ms,omitempty"`
+	// Multiplier, RandomizationFactor, and FirstRetryImmediate are the BackOffPolicy fields of those names.
+	Multiplier          float64 `json:"multiplier,omitempty" yaml:"multiplier,omitempty"`
+	RandomizationFactor float64 `json:"randomization_factor,omitempty" yaml:"randomization_factor,omitempty"`
+	FirstRetryImmediate bool    `json:"first_retry_immediate,omitempty" yaml:"first_retry_immediate,omitempty"`
+
+	// TotalTimeoutMS applies WithTotalTimeout, and PerAttemptTimeoutMS WithPerAttemptTimeout.
+	TotalTimeoutMS      int64 `json:"total_timeout_ms,omitempty" yaml:"total_timeout_ms,omitempty"`
+	PerAttemptTimeoutMS int64 `json:"per_attempt_timeout_ms,omitempty" yaml:"per_attempt_timeout_ms,omitempty"`
+	// MaxConcurrentRetries applies WithMaxConcurrentRetries.
+	MaxConcurrentRetries int `json:"max_concurrent_retries,omitempty" yaml:"max_concurrent_retries,omitempty"`
+	// RetryAfter applies WithRetryAfter, and MaxRetryAfterMS WithMaxRetryAfter.
+	RetryAfter      bool  `json:"retry_after,omitempty" yaml:"retry_after,omitempty"`
+	MaxRetryAfterMS int64 `json:"max_retry_after_ms,omitempty" yaml:"max_retry_after_ms,omitempty"`
+}
+
+// FromConfig creates a RoundTripper using http.DefaultTransport and DefaultShouldRetry, configured by cfg with the
+// same defaults as New. Invalid values, such as negative durations or a Multiplier below 1, are reported, all at
+// once, by an error naming the fields. opts are applied after the settings of cfg.
+func FromConfig(cfg FileConfig, opts ...Option) (*RoundTripper, error) {
+	c := fileConfigReader{}
+	policy := &BackOffPolicy{MaxRetries: 3}
+	if cfg.MaxRetries != nil {
+		policy.MaxRetries = *cfg.MaxRetries
+	}
+	policy.InitialInterval = c.duration("initial_interval_ms", cfg.InitialIntervalMS)
+	policy.MaxInterval = c.duration("max_interval_ms", cfg.MaxIntervalMS)
+	policy.MaxElapsedTime = c.duration("max_elapsed_time_ms", cfg.MaxElapsedTimeMS)
+	policy.CeilingInterval = c.duration("ceiling_interval_ms", cfg.CeilingIntervalMS)
+	policy.MinInterval = c.duration("min_interval_ms", cfg.MinIntervalMS)
+	policy.AbsoluteMaxSleep = c.duration("absolute_max_sleep_ms", cfg.AbsoluteMaxSleepMS)
+	if cfg.Multiplier != 0 && cfg.Multiplier < 1 {
+		c.invalid("multiplier", cfg.Multiplier, "must be at least 1")
+	}
+	policy.Multiplier = cfg.Multiplier
+	if cfg.RandomizationFactor > 1 {
+		c.invalid("randomization_factor", cfg.RandomizationFactor, "must be at most 1")
+	}
+	policy.RandomizationFactor = cfg.RandomizationFactor
+	policy.FirstRetryImmediate = cfg.FirstRetryImmediate
+	var cfgOpts []Option
+	if d := c.duration("total_timeout_ms", cfg.TotalTimeoutMS); d > 0 {
+		cfgOpts = append(cfgOpts, WithTotalTimeout(d))
+	}
+	if d := c.duration("per_attempt_timeout_ms", cfg.PerAttemptTimeoutMS); d > 0 {
+		cfgOpts = append(cfgOpts, WithPerAttemptTimeout(d))
+	}
+	if cfg.MaxConcurrentRetries < 0 {
+		c.invalid("max_concurrent_retries", cfg.MaxConcurrentRetries, "must not be negative")
+	} else if cfg.MaxConcurrentRetries > 0 {
+		cfgOpts = append(cfgOpts, WithMaxConcurrentRetries(cfg.MaxConcurrentRetries))
+	}
+	if cfg.RetryAfter {
+		cfgOpts = append(cfgOpts, WithRetryAfter())
+	}
+	if d := c.duration("max_retry_after_ms", cfg.MaxRetryAfterMS); d > 0 {
+		cfgOpts = append(cfgOpts, WithMaxRetryAfter(d))
+	}
+	if err := errors.Join(c.errs...); err != nil {
+		return nil, err
+	}
+	return New(nil, nil, nil, policy, append(cfgOpts, opts...)...), nil
+}
+
+// fileConfigReader converts the fields of a FileConfig, collecting the errors of invalid values.
+type fileConfigReader struct {
+	errs []error
+}
+
+// invalid records that the field name has the invalid value v.
+func (c *fileConfigReader) invalid(name string, v any, reason string) {
+	c.errs = append(c.errs, fmt.Errorf("invalid %s %v: %s", name, v, reason))
+}
+
+// duration returns the milliseconds ms of the field name as a duration, or zero if they are negative.
+func (c *fileConfigReader) duration(name string, ms int64) time.Duration {
+	if ms < 0 {
+		c.invalid(name, ms, "must not be negative")
+		return 0
+	}
+	return time.Duration(ms) * time.Millisecond
+}
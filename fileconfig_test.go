@@ -0,0 +1,89 @@
+package retryabletransport_test
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/linzhengen/retryabletransport"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_FromConfig(t *testing.T) {
+	t.Run("fields are applied", func(t *testing.T) {
+		var fileCfg retryabletransport.FileConfig
+		err := json.Unmarshal([]byte(`{
+			"max_retries": 5,
+			"initial_interval_ms": 100,
+			"max_interval_ms": 2000,
+			"min_interval_ms": 50,
+			"multiplier": 2,
+			"first_retry_immediate": true,
+			"total_timeout_ms": 30000,
+			"per_attempt_timeout_ms": 1000,
+			"max_concurrent_retries": 8,
+			"retry_after": true,
+			"max_retry_after_ms": 10000
+		}`), &fileCfg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		rt, err := retryabletransport.FromConfig(fileCfg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		cfg := rt.Config()
+		assert.Equal(t, uint64(5), cfg.BackOffPolicy.MaxRetries)
+		assert.Equal(t, 100*time.Millisecond, cfg.BackOffPolicy.InitialInterval)
+		assert.Equal(t, 2*time.Second, cfg.BackOffPolicy.MaxInterval)
+		assert.Equal(t, 50*time.Millisecond, cfg.BackOffPolicy.MinInterval)
+		assert.Equal(t, float64(2), cfg.BackOffPolicy.Multiplier)
+		assert.True(t, cfg.BackOffPolicy.FirstRetryImmediate)
+		assert.Equal(t, 30*time.Second, cfg.TotalTimeout)
+		assert.Equal(t, time.Second, cfg.PerAttemptTimeout)
+		assert.Equal(t, 8, cfg.MaxConcurrentRetries)
+		assert.True(t, cfg.RetryAfter)
+		assert.Equal(t, 10*time.Second, cfg.MaxRetryAfter)
+	})
+	t.Run("empty config has the defaults of New", func(t *testing.T) {
+		rt, err := retryabletransport.FromConfig(retryabletransport.FileConfig{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		assert.Equal(t, retryabletransport.New(nil, nil, nil, nil).Config(), rt.Config())
+	})
+	t.Run("zero retries are kept", func(t *testing.T) {
+		var fileCfg retryabletransport.FileConfig
+		if err := json.Unmarshal([]byte(`{"max_retries": 0}`), &fileCfg); err != nil {
+			t.Fatal(err)
+		}
+		rt, err := retryabletransport.FromConfig(fileCfg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		assert.Equal(t, uint64(0), rt.Config().BackOffPolicy.MaxRetries)
+	})
+	t.Run("invalid values are reported together", func(t *testing.T) {
+		rt, err := retryabletransport.FromConfig(retryabletransport.FileConfig{
+			InitialIntervalMS:    -1,
+			Multiplier:           0.5,
+			MaxConcurrentRetries: -2,
+		})
+		assert.Nil(t, rt)
+		if assert.Error(t, err) {
+			assert.Contains(t, err.Error(), "initial_interval_ms")
+			assert.Contains(t, err.Error(), "multiplier")
+			assert.Contains(t, err.Error(), "max_concurrent_retries")
+		}
+	})
+	t.Run("options are applied after the config", func(t *testing.T) {
+		rt, err := retryabletransport.FromConfig(
+			retryabletransport.FileConfig{TotalTimeoutMS: 1000},
+			retryabletransport.WithTotalTimeout(time.Minute),
+		)
+		if err != nil {
+			t.Fatal(err)
+		}
+		assert.Equal(t, time.Minute, rt.Config().TotalTimeout)
+	})
+}
@@ -0,0 +1,18 @@
+package retryabletransport
+
+import "net/http"
+
+// GiveUpResponseFunc builds the response returned for a request that failed for good, from its last response,
+// which may be nil, and last error.
+type GiveUpResponseFunc func(req *http.Request, lastResp *http.Response, lastErr error) *http.Response
+
+// WithGiveUpResponse replaces the error of a request that failed for good, whether because retries were exhausted
+// or because the failure was not retryable, with the response built by giveUpResponseFunc and a nil error, e.g. a
+// synthesized 503 with a Retry-After for the application's own callers. If giveUpResponseFunc returns nil, the
+// original result is kept. giveUpResponseFunc is responsible for closing the body of lastResp if it does not
+// return it.
+func WithGiveUpResponse(giveUpResponseFunc GiveUpResponseFunc) Option {
+	return func(p *RoundTripper) {
+		p.giveUpResponseFunc = giveUpResponseFunc
+	}
+}
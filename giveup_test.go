@@ -0,0 +1,80 @@
+package retryabletransport_test
+
+import (
+	"io"
+	"net/http"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/linzhengen/retryabletransport"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_WithGiveUpResponse(t *testing.T) {
+	type test struct {
+		name       string
+		resp       *http.Response
+		err        error
+		giveUp     retryabletransport.GiveUpResponseFunc
+		wantStatus int
+		wantErr    error
+	}
+	synthesize := func(req *http.Request, lastResp *http.Response, lastErr error) *http.Response {
+		if lastResp != nil && lastResp.StatusCode == http.StatusBadRequest {
+			return nil
+		}
+		return &http.Response{
+			StatusCode: http.StatusServiceUnavailable,
+			Header:     http.Header{"Retry-After": []string{"30"}},
+			Body:       io.NopCloser(strings.NewReader("try again later")),
+		}
+	}
+	tests := []test{
+		{
+			name:       "transport error is replaced after retries are exhausted",
+			err:        syscall.ECONNREFUSED,
+			giveUp:     synthesize,
+			wantStatus: http.StatusServiceUnavailable,
+		},
+		{
+			name:       "retryable response is replaced after retries are exhausted",
+			resp:       &http.Response{StatusCode: http.StatusTooManyRequests},
+			giveUp:     synthesize,
+			wantStatus: http.StatusServiceUnavailable,
+		},
+		{
+			name:       "nil keeps the original result",
+			resp:       &http.Response{StatusCode: http.StatusBadRequest},
+			err:        syscall.ECONNRESET,
+			giveUp:     synthesize,
+			wantStatus: http.StatusBadRequest,
+			wantErr:    syscall.ECONNRESET,
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			rt := retryabletransport.New(
+				roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+					return tc.resp, tc.err
+				}),
+				nil,
+				nil,
+				&retryabletransport.BackOffPolicy{MaxRetries: 1, InitialInterval: time.Millisecond},
+				retryabletransport.WithGiveUpResponse(tc.giveUp),
+			)
+			req, err := http.NewRequest(http.MethodGet, "http://example.com", nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			resp, err := rt.RoundTrip(req)
+			if tc.wantErr == nil {
+				assert.NoError(t, err)
+			} else {
+				assert.ErrorIs(t, err, tc.wantErr)
+			}
+			assert.Equal(t, tc.wantStatus, resp.StatusCode)
+		})
+	}
+}
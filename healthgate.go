@@ -0,0 +1,39 @@
+package retryabletransport
+
+import (
+	"context"
+	"time"
+
+	"github.com/cenkalti/backoff/v4"
+)
+
+// HealthGateFunc reports whether the upstream is healthy enough to retry into, e.g. from a separate health
+// endpoint. ctx is the context of the request.
+type HealthGateFunc func(ctx context.Context) bool
+
+// WithHealthGate makes the RoundTripper consult healthGate before each retry and stop retrying once it returns
+// false, so that retries are not sent into an upstream known to be down. The result of the last attempt is
+// returned as if the retries ran out. A gated retry withdraws nothing from a RetryBudget and takes no slot of
+// WithMaxConcurrentRetries. healthGate is called before waiting for the retry, so it must be fast, e.g. by
+// reporting a health status that is checked in the background.
+func WithHealthGate(healthGate HealthGateFunc) Option {
+	return func(p *RoundTripper) {
+		p.healthGate = healthGate
+	}
+}
+
+// healthGateBackOff stops retrying once the health gate reports the upstream as unhealthy.
+type healthGateBackOff struct {
+	backoff.BackOff
+	healthGate HealthGateFunc
+	state      *retryState
+}
+
+// NextBackOff returns the wrapped backoff delay, or backoff.Stop if the upstream is not healthy.
+func (b *healthGateBackOff) NextBackOff() time.Duration {
+	next := b.BackOff.NextBackOff()
+	if next == backoff.Stop || b.healthGate(b.state.req.Context()) {
+		return next
+	}
+	return backoff.Stop
+}
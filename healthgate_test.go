@@ -0,0 +1,86 @@
+package retryabletransport_test
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/linzhengen/retryabletransport"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_WithHealthGate(t *testing.T) {
+	type test struct {
+		name         string
+		healthyFor   int
+		wantAttempts int
+	}
+	tests := []test{
+		{
+			name:         "healthy upstream is retried",
+			healthyFor:   3,
+			wantAttempts: 4,
+		},
+		{
+			name:         "retries stop once the upstream is unhealthy",
+			healthyFor:   1,
+			wantAttempts: 2,
+		},
+		{
+			name:         "unhealthy upstream is not retried",
+			wantAttempts: 1,
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			calledCount, gateCount := 0, 0
+			rt := retryabletransport.New(
+				roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+					calledCount++
+					return &http.Response{StatusCode: http.StatusServiceUnavailable}, nil
+				}),
+				nil,
+				nil,
+				&retryabletransport.BackOffPolicy{MaxRetries: 3, InitialInterval: time.Millisecond},
+				retryabletransport.WithHealthGate(func(ctx context.Context) bool {
+					gateCount++
+					return gateCount <= tc.healthyFor
+				}),
+			)
+			req, err := http.NewRequest(http.MethodGet, "http://example.com", nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			resp, err := rt.RoundTrip(req)
+			assert.NoError(t, err)
+			assert.Equal(t, http.StatusServiceUnavailable, resp.StatusCode)
+			assert.Equal(t, tc.wantAttempts, calledCount)
+		})
+	}
+	t.Run("gated retries do not consume the retry budget", func(t *testing.T) {
+		budget := retryabletransport.NewRetryBudget(0, 1, nil)
+		healthy := false
+		calledCount := 0
+		rt := retryabletransport.New(
+			roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+				calledCount++
+				return &http.Response{StatusCode: http.StatusServiceUnavailable}, nil
+			}),
+			nil,
+			nil,
+			&retryabletransport.BackOffPolicy{MaxRetries: 1, InitialInterval: time.Millisecond},
+			retryabletransport.WithRetryBudget(budget),
+			retryabletransport.WithHealthGate(func(ctx context.Context) bool { return healthy }),
+		)
+		for _, h := range []bool{false, true} {
+			healthy = h
+			req, err := http.NewRequest(http.MethodGet, "http://example.com", nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			_, _ = rt.RoundTrip(req)
+		}
+		assert.Equal(t, 3, calledCount, "the budget token must be left for the healthy request")
+	})
+}
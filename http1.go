@@ -0,0 +1,89 @@
+package retryabletransport
+
+import (
+	"crypto/tls"
+	"net/http"
+	"slices"
+	"strings"
+)
+
+// WithHTTP1Fallback sends the remaining attempts of a request over HTTP/1.1 once after of its attempts failed
+// with HTTP/2 stream errors, as a workaround for middleboxes or servers with broken HTTP/2 support. The
+// attempts are sent through http1, or, if it is nil, through a clone of the wrapped transport that only
+// speaks HTTP/1.1, which requires the wrapped transport to be an *http.Transport; otherwise, the option has
+// no effect. It only applies to requests sent through the wrapped transport, not to those sent through a
+// transport set by WithRequestTransport.
+//
+// The fallback is advanced interop and comes with limitations: it applies per request, so every request
+// starts over HTTP/2 again; the HTTP/1.1 attempts use their own connection pool; stream errors are recognized
+// by the messages of the HTTP/2 implementations of net/http and golang.org/x/net/http2; and servers that
+// require HTTP/2, such as gRPC servers, fail the HTTP/1.1 attempts. Whether an attempt failing with a
+// stream error is retried at all is still up to the ShouldRetryFunc, which DefaultShouldRetry does not do;
+// include RetryOnHTTP2StreamError in the retry conditions for that.
+func WithHTTP1Fallback(after int, http1 http.RoundTripper) Option {
+	return func(p *RoundTripper) {
+		if http1 == nil {
+			if t, ok := p.roundTripper.(*http.Transport); ok {
+				http1 = http1Transport(t)
+			}
+		}
+		p.http1Fallback = after
+		p.http1Transport = http1
+	}
+}
+
+// http1Transport returns a clone of t that only speaks HTTP/1.1.
+func http1Transport(t *http.Transport) *http.Transport {
+	t = t.Clone()
+	t.ForceAttemptHTTP2 = false
+	// A non-nil, empty TLSNextProto disables HTTP/2.
+	t.TLSNextProto = map[string]func(string, *tls.Conn) http.RoundTripper{}
+	if t.TLSClientConfig != nil {
+		t.TLSClientConfig.NextProtos = slices.DeleteFunc(slices.Clone(t.TLSClientConfig.NextProtos), func(proto string) bool {
+			return proto == "h2"
+		})
+	}
+	return t
+}
+
+// observeHTTP2StreamError switches the remaining attempts of the request to HTTP/1.1 once the configured
+// number of them failed with HTTP/2 stream errors.
+func (p *RoundTripper) observeHTTP2StreamError(state *retryState) {
+	if state.http1 || !isHTTP2StreamError(state.err) {
+		return
+	}
+	if rt, ok := state.req.Context().Value(transportKey{}).(http.RoundTripper); ok && rt != nil {
+		return
+	}
+	state.http2StreamErrors++
+	if state.http2StreamErrors >= p.http1Fallback {
+		state.roundTripper = p.http1Transport
+		state.http1 = true
+	}
+}
+
+// RetryOnHTTP2StreamError returns a ShouldRetryFunc that retries idempotent requests whose attempt failed with
+// an HTTP/2 stream error, such as a stream reset by the server or a middlebox. The server may have processed
+// the request before resetting its stream, so non-idempotent requests are not retried.
+func RetryOnHTTP2StreamError() ShouldRetryFunc {
+	return retryOnHTTP2StreamError
+}
+
+// retryOnHTTP2StreamError implements RetryOnHTTP2StreamError.
+func retryOnHTTP2StreamError(req *http.Request, resp *http.Response, err error) bool {
+	return isIdempotent(req) && req.Context().Err() == nil && isHTTP2StreamError(err)
+}
+
+// isHTTP2StreamError reports whether err is an HTTP/2 stream error, such as a stream reset by the server.
+func isHTTP2StreamError(err error) bool {
+	return err != nil && strings.Contains(err.Error(), "stream error: stream ID")
+}
+
+// http1FallbackConfig returns the number of attempts failing with HTTP/2 stream errors after which the remaining
+// attempts fall back to HTTP/1.1, or 0 if they never do.
+func (p *RoundTripper) http1FallbackConfig() int {
+	if p.http1Transport == nil {
+		return 0
+	}
+	return max(p.http1Fallback, 1)
+}
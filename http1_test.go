@@ -0,0 +1,127 @@
+package retryabletransport_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/linzhengen/retryabletransport"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_WithHTTP1Fallback(t *testing.T) {
+	var http2Attempts, http1Attempts atomic.Int32
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.ProtoMajor == 2 {
+			http2Attempts.Add(1)
+			// Resets the stream, which fails the attempt with a stream error.
+			panic(http.ErrAbortHandler)
+		}
+		http1Attempts.Add(1)
+	}))
+	server.EnableHTTP2 = true
+	server.StartTLS()
+	defer server.Close()
+	policy := &retryabletransport.BackOffPolicy{MaxRetries: 3, InitialInterval: time.Millisecond}
+
+	type test struct {
+		name             string
+		after            int
+		ctx              context.Context
+		wantErr          bool
+		wantHTTP2Attempt int32
+		wantHTTP1Attempt int32
+	}
+	tests := []test{
+		{name: "falls back after the first stream error", after: 1, ctx: context.Background(), wantHTTP2Attempt: 1, wantHTTP1Attempt: 1},
+		{name: "falls back after repeated stream errors", after: 2, ctx: context.Background(), wantHTTP2Attempt: 2, wantHTTP1Attempt: 1},
+		{name: "never falls back before retries run out", after: 5, ctx: context.Background(), wantErr: true, wantHTTP2Attempt: 4},
+		{
+			name:             "request transport is kept",
+			after:            1,
+			ctx:              retryabletransport.WithRequestTransport(context.Background(), server.Client().Transport),
+			wantErr:          true,
+			wantHTTP2Attempt: 4,
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			http2Attempts.Store(0)
+			http1Attempts.Store(0)
+			rt := retryabletransport.New(
+				server.Client().Transport,
+				retryabletransport.RetryOnHTTP2StreamError(),
+				nil,
+				policy,
+				retryabletransport.WithHTTP1Fallback(tc.after, nil),
+			)
+			assert.Equal(t, tc.after, rt.Config().HTTP1Fallback)
+			req, err := http.NewRequestWithContext(tc.ctx, http.MethodGet, server.URL, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			resp, err := rt.RoundTrip(req)
+			if tc.wantErr {
+				assert.ErrorContains(t, err, "stream error")
+			} else if assert.NoError(t, err) {
+				resp.Body.Close()
+				assert.Equal(t, 1, resp.ProtoMajor)
+			}
+			assert.Equal(t, tc.wantHTTP2Attempt, http2Attempts.Load())
+			assert.Equal(t, tc.wantHTTP1Attempt, http1Attempts.Load())
+		})
+	}
+
+	t.Run("custom HTTP/1.1 transport", func(t *testing.T) {
+		errStream := errors.New("stream error: stream ID 1; INTERNAL_ERROR; received from peer")
+		var http1Sent atomic.Int32
+		rt := retryabletransport.New(
+			roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+				return nil, errStream
+			}),
+			retryabletransport.RetryOnHTTP2StreamError(),
+			nil,
+			policy,
+			retryabletransport.WithHTTP1Fallback(1, roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+				http1Sent.Add(1)
+				return &http.Response{StatusCode: http.StatusOK, Body: http.NoBody}, nil
+			})),
+		)
+		req, err := http.NewRequest(http.MethodGet, "http://example.com", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp, err := rt.RoundTrip(req)
+		if assert.NoError(t, err) {
+			assert.Equal(t, http.StatusOK, resp.StatusCode)
+		}
+		assert.Equal(t, int32(1), http1Sent.Load())
+	})
+
+	t.Run("non-idempotent requests are not retried", func(t *testing.T) {
+		http2Attempts.Store(0)
+		rt := retryabletransport.New(
+			server.Client().Transport,
+			retryabletransport.RetryOnHTTP2StreamError(),
+			nil,
+			policy,
+			retryabletransport.WithHTTP1Fallback(1, nil),
+		)
+		req, err := http.NewRequest(http.MethodPost, server.URL, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, err = rt.RoundTrip(req)
+		assert.ErrorContains(t, err, "stream error")
+		assert.Equal(t, int32(1), http2Attempts.Load())
+	})
+
+	t.Run("no effect without an *http.Transport", func(t *testing.T) {
+		rt := retryabletransport.New(roundTripperFunc(http.DefaultTransport.RoundTrip), nil, nil, policy, retryabletransport.WithHTTP1Fallback(1, nil))
+		assert.Equal(t, 0, rt.Config().HTTP1Fallback)
+	})
+}
@@ -0,0 +1,80 @@
+package retryabletransport
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+)
+
+// DefaultMaxInspectBodyBytes is the default maximum number of response body bytes buffered for body-based
+// retry predicates.
+const DefaultMaxInspectBodyBytes = 64 << 10
+
+// inspectLimitKey is the context key for the body inspection limit of a request.
+type inspectLimitKey struct{}
+
+// WithMaxInspectBodyBytes sets the maximum number of response body bytes that body-based retry predicates such as
+// RetryOnJSONField buffer for inspection, which protects against huge error pages. Predicates only see up to this
+// many bytes and treat larger bodies as not inspectable. It defaults to DefaultMaxInspectBodyBytes, which is also
+// used if n is not positive.
+func WithMaxInspectBodyBytes(n int64) Option {
+	return func(p *RoundTripper) {
+		p.maxInspectBodyBytes = n
+	}
+}
+
+// inspectLimit returns the maximum number of response body bytes buffered for inspection.
+func (p *RoundTripper) inspectLimit() int64 {
+	if p.maxInspectBodyBytes <= 0 {
+		return DefaultMaxInspectBodyBytes
+	}
+	return p.maxInspectBodyBytes
+}
+
+// withInspectLimit returns req with the body inspection limit of the RoundTripper recorded in its context.
+func (p *RoundTripper) withInspectLimit(req *http.Request) *http.Request {
+	if p.maxInspectBodyBytes <= 0 {
+		return req
+	}
+	return req.WithContext(context.WithValue(req.Context(), inspectLimitKey{}, p.maxInspectBodyBytes))
+}
+
+// InspectResponseBody buffers the response body for a retry predicate, up to the inspection limit of the
+// RoundTripper handling req, and restores resp.Body so that it yields the full, unconsumed body again.
+// complete reports whether the returned bytes are the whole body. Custom body-based predicates should use it
+// so that they honor WithMaxInspectBodyBytes. Responses to HEAD requests have no body, so they are reported as
+// empty and complete without reading resp.Body, so that predicates decide on their status and headers only.
+func InspectResponseBody(req *http.Request, resp *http.Response) (body []byte, complete bool, err error) {
+	limit := int64(DefaultMaxInspectBodyBytes)
+	if req != nil {
+		if req.Method == http.MethodHead {
+			return nil, true, nil
+		}
+		if n, ok := req.Context().Value(inspectLimitKey{}).(int64); ok {
+			limit = n
+		}
+	}
+	return peekResponseBody(resp, limit)
+}
+
+// peekResponseBody reads up to limit bytes of the response body and restores resp.Body so that it yields
+// the full, unconsumed body again. complete reports whether the returned bytes are the whole body.
+func peekResponseBody(resp *http.Response, limit int64) (b []byte, complete bool, err error) {
+	if resp.Body == nil || resp.Body == http.NoBody {
+		return nil, true, nil
+	}
+	b, err = io.ReadAll(io.LimitReader(resp.Body, limit+1))
+	body := resp.Body
+	resp.Body = struct {
+		io.Reader
+		io.Closer
+	}{io.MultiReader(bytes.NewReader(b), body), body}
+	if err != nil {
+		return nil, false, err
+	}
+	if int64(len(b)) > limit {
+		return b[:limit], false, nil
+	}
+	return b, true, nil
+}
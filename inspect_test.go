@@ -0,0 +1,74 @@
+package retryabletransport_test
+
+import (
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/linzhengen/retryabletransport"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_WithMaxInspectBodyBytes(t *testing.T) {
+	const body = `{"retryable":true}`
+	type test struct {
+		name         string
+		opts         []retryabletransport.Option
+		wantAttempts int
+	}
+	tests := []test{
+		{
+			name:         "body within the default limit is inspected",
+			wantAttempts: 2,
+		},
+		{
+			name:         "body over the configured limit is not inspected",
+			opts:         []retryabletransport.Option{retryabletransport.WithMaxInspectBodyBytes(8)},
+			wantAttempts: 1,
+		},
+		{
+			name:         "negative limit falls back to the default",
+			opts:         []retryabletransport.Option{retryabletransport.WithMaxInspectBodyBytes(-1)},
+			wantAttempts: 2,
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			calledCount := 0
+			rt := retryabletransport.New(
+				roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+					calledCount++
+					return &http.Response{StatusCode: http.StatusBadRequest, Body: io.NopCloser(strings.NewReader(body))}, nil
+				}),
+				retryabletransport.RetryOnJSONField("retryable", true),
+				nil,
+				&retryabletransport.BackOffPolicy{MaxRetries: 1, InitialInterval: time.Millisecond},
+				tc.opts...,
+			)
+			req, err := http.NewRequest(http.MethodGet, "http://example.com", nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			resp, _ := rt.RoundTrip(req)
+			assert.Equal(t, tc.wantAttempts, calledCount)
+			got, err := io.ReadAll(resp.Body)
+			if err != nil {
+				t.Fatal(err)
+			}
+			assert.Equal(t, body, string(got))
+		})
+	}
+}
+
+func Test_InspectResponseBody(t *testing.T) {
+	resp := &http.Response{Body: io.NopCloser(strings.NewReader("error page"))}
+	b, complete, err := retryabletransport.InspectResponseBody(nil, resp)
+	assert.NoError(t, err)
+	assert.True(t, complete)
+	assert.Equal(t, "error page", string(b))
+	got, err := io.ReadAll(resp.Body)
+	assert.NoError(t, err)
+	assert.Equal(t, "error page", string(got))
+}
@@ -0,0 +1,147 @@
+package retryabletransport
+
+import (
+	"bytes"
+	"crypto/md5"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// ContentIntegrityError is the error of an attempt, or of reading a response body, whose body does not match the
+// digest in its headers, see WithContentIntegrityCheck.
+var ContentIntegrityError = errors.New("response body does not match its digest")
+
+// WithContentIntegrityCheck verifies the bodies of successful responses against the digest sent along with them,
+// to catch corruption by intermediaries. Digests are taken from the Content-Digest header of RFC 9530, the Digest
+// header of RFC 3230, or the Content-MD5 header, with the SHA-512, SHA-256, and MD5 algorithms.
+//
+// Bodies of idempotent requests that fit into the inspection limit of WithMaxInspectBodyBytes are verified before
+// RoundTrip returns, and a mismatch is retried as a failed attempt with an error matching ContentIntegrityError.
+// Other bodies are verified as they are read, and a mismatch makes the read reaching the end of the body fail with
+// such an error instead of io.EOF, since the caller has consumed the body already. Bodies decompressed by
+// *http.Transport are not verified, as their digest is that of the compressed body.
+func WithContentIntegrityCheck() Option {
+	return func(p *RoundTripper) {
+		p.integrityCheck = true
+	}
+}
+
+// checkIntegrity verifies the body of the successful response of state as configured by WithContentIntegrityCheck.
+// It returns an error matching ContentIntegrityError if the body is buffered and does not match its digest.
+func (p *RoundTripper) checkIntegrity(state *retryState) error {
+	resp := state.resp
+	if state.req.Method == http.MethodHead || resp.Uncompressed {
+		return nil
+	}
+	d, ok := responseDigest(resp.Header)
+	if !ok {
+		return nil
+	}
+	if isIdempotent(state.req) {
+		b, complete, err := peekResponseBody(resp, p.inspectLimit())
+		if err != nil {
+			return err
+		}
+		if complete {
+			d.hash.Write(b)
+			return d.verify()
+		}
+	}
+	resp.Body = &verifyingBody{ReadCloser: resp.Body, digest: d}
+	return nil
+}
+
+// digest is the expected digest of a response body, along with the hash computing its actual value.
+type digest struct {
+	algorithm string
+	hash      hash.Hash
+	want      []byte
+}
+
+// verify returns an error matching ContentIntegrityError if the hash does not match the expected digest.
+func (d *digest) verify() error {
+	if !bytes.Equal(d.hash.Sum(nil), d.want) {
+		return fmt.Errorf("%w: %s mismatch", ContentIntegrityError, d.algorithm)
+	}
+	return nil
+}
+
+// digestAlgorithms are the supported digest algorithms by their lowercased name, strongest first.
+var digestAlgorithms = []struct {
+	name    string
+	newHash func() hash.Hash
+}{
+	{"sha-512", sha512.New},
+	{"sha-256", sha256.New},
+	{"md5", md5.New},
+}
+
+// responseDigest returns the strongest supported digest of a response body found in header.
+func responseDigest(header http.Header) (*digest, bool) {
+	digests := map[string]string{}
+	// Content-Digest wraps its values in colons, as byte sequences of structured fields.
+	for name, v := range digestValues(header.Values("Content-Digest")) {
+		digests[name] = strings.Trim(v, ":")
+	}
+	for name, v := range digestValues(header.Values("Digest")) {
+		if _, ok := digests[name]; !ok {
+			digests[name] = v
+		}
+	}
+	if v := header.Get("Content-MD5"); v != "" {
+		if _, ok := digests["md5"]; !ok {
+			digests["md5"] = v
+		}
+	}
+	for _, algorithm := range digestAlgorithms {
+		v, ok := digests[algorithm.name]
+		if !ok {
+			continue
+		}
+		want, err := base64.StdEncoding.DecodeString(v)
+		if err != nil {
+			continue
+		}
+		return &digest{algorithm: algorithm.name, hash: algorithm.newHash(), want: want}, true
+	}
+	return nil, false
+}
+
+// digestValues returns the values of the comma-separated algorithm=value lists in values by lowercased algorithm.
+func digestValues(values []string) map[string]string {
+	digests := map[string]string{}
+	for _, v := range values {
+		for _, item := range strings.Split(v, ",") {
+			name, value, ok := strings.Cut(strings.TrimSpace(item), "=")
+			if ok {
+				digests[strings.ToLower(name)] = strings.TrimSpace(value)
+			}
+		}
+	}
+	return digests
+}
+
+// verifyingBody verifies a response body against its digest as it is read.
+type verifyingBody struct {
+	io.ReadCloser
+	digest *digest
+}
+
+// Read reads from the wrapped body, failing at its end with an error matching ContentIntegrityError on a mismatch.
+func (b *verifyingBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	b.digest.hash.Write(p[:n])
+	if err == io.EOF {
+		if verr := b.digest.verify(); verr != nil {
+			return n, verr
+		}
+	}
+	return n, err
+}
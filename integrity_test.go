@@ -0,0 +1,150 @@
+package retryabletransport_test
+
+import (
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/base64"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/linzhengen/retryabletransport"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_WithContentIntegrityCheck(t *testing.T) {
+	const body = "the quick brown fox"
+	md5Sum := md5.Sum([]byte(body))
+	sha256Sum := sha256.Sum256([]byte(body))
+	contentMD5 := base64.StdEncoding.EncodeToString(md5Sum[:])
+	sha256Digest := base64.StdEncoding.EncodeToString(sha256Sum[:])
+	type test struct {
+		name          string
+		method        string
+		header        http.Header
+		corrupt       int32
+		opts          []retryabletransport.Option
+		wantAttempts  int32
+		wantRoundTrip error
+		wantReadErr   error
+	}
+	tests := []test{
+		{
+			name:         "matching Content-MD5 is not retried",
+			method:       http.MethodGet,
+			header:       http.Header{"Content-Md5": {contentMD5}},
+			wantAttempts: 1,
+		},
+		{
+			name:         "mismatching Content-MD5 is re-fetched",
+			method:       http.MethodGet,
+			header:       http.Header{"Content-Md5": {contentMD5}},
+			corrupt:      1,
+			wantAttempts: 2,
+		},
+		{
+			name:         "mismatching Digest is re-fetched",
+			method:       http.MethodGet,
+			header:       http.Header{"Digest": {"SHA-256=" + sha256Digest}},
+			corrupt:      1,
+			wantAttempts: 2,
+		},
+		{
+			name:         "mismatching Content-Digest is re-fetched",
+			method:       http.MethodGet,
+			header:       http.Header{"Content-Digest": {"sha-256=:" + sha256Digest + ":"}},
+			corrupt:      1,
+			wantAttempts: 2,
+		},
+		{
+			name:          "persistent mismatch gives up",
+			method:        http.MethodGet,
+			header:        http.Header{"Content-Md5": {contentMD5}},
+			corrupt:       3,
+			wantAttempts:  2,
+			wantRoundTrip: retryabletransport.ContentIntegrityError,
+		},
+		{
+			name:         "mismatch of a body over the inspection limit fails its read",
+			method:       http.MethodGet,
+			header:       http.Header{"Content-Md5": {contentMD5}},
+			corrupt:      1,
+			opts:         []retryabletransport.Option{retryabletransport.WithMaxInspectBodyBytes(4)},
+			wantAttempts: 1,
+			wantReadErr:  retryabletransport.ContentIntegrityError,
+		},
+		{
+			name:         "negative inspection limit falls back to the default",
+			method:       http.MethodGet,
+			header:       http.Header{"Content-Md5": {contentMD5}},
+			corrupt:      1,
+			opts:         []retryabletransport.Option{retryabletransport.WithMaxInspectBodyBytes(-1)},
+			wantAttempts: 2,
+		},
+		{
+			name:         "mismatch of a non-idempotent request fails its read",
+			method:       http.MethodPost,
+			header:       http.Header{"Content-Md5": {contentMD5}},
+			corrupt:      1,
+			wantAttempts: 1,
+			wantReadErr:  retryabletransport.ContentIntegrityError,
+		},
+		{
+			name:         "response without digest is not verified",
+			method:       http.MethodGet,
+			corrupt:      1,
+			wantAttempts: 1,
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			var attempts atomic.Int32
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				for k, v := range tc.header {
+					w.Header()[k] = v
+				}
+				if attempts.Add(1) <= tc.corrupt {
+					_, _ = io.WriteString(w, strings.ToUpper(body))
+					return
+				}
+				_, _ = io.WriteString(w, body)
+			}))
+			defer server.Close()
+			rt := retryabletransport.New(
+				nil,
+				nil,
+				nil,
+				&retryabletransport.BackOffPolicy{MaxRetries: 1, InitialInterval: time.Millisecond},
+				append([]retryabletransport.Option{retryabletransport.WithContentIntegrityCheck()}, tc.opts...)...,
+			)
+			req, err := http.NewRequest(tc.method, server.URL, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			resp, err := rt.RoundTrip(req)
+			assert.Equal(t, tc.wantAttempts, attempts.Load())
+			if tc.wantRoundTrip != nil {
+				assert.ErrorIs(t, err, tc.wantRoundTrip)
+				assert.Nil(t, resp)
+				return
+			}
+			if !assert.NoError(t, err) {
+				return
+			}
+			defer resp.Body.Close()
+			b, err := io.ReadAll(resp.Body)
+			if tc.wantReadErr != nil {
+				assert.ErrorIs(t, err, tc.wantReadErr)
+				return
+			}
+			assert.NoError(t, err)
+			if tc.header != nil {
+				assert.Equal(t, body, string(b))
+			}
+		})
+	}
+}
@@ -0,0 +1,20 @@
+package retryabletransport
+
+import "net/http"
+
+// WithKillSwitch makes the RoundTripper stop retrying while disabled returns true, as a big red button for
+// operators during retry amplification incidents, e.g. with the Load method of an *atomic.Bool toggled from an
+// admin endpoint. It is consulted before every retry, so toggling it takes effect right away, for new requests and
+// for the next retry of requests in flight alike; requests are then sent once, as with WithSingleAttempt.
+// disabled must be safe for concurrent use and fast.
+func WithKillSwitch(disabled func() bool) Option {
+	return func(p *RoundTripper) {
+		p.killSwitch = disabled
+	}
+}
+
+// sendsOnce reports whether req is sent without any retry or resend, as marked by WithSingleAttempt or while the
+// kill switch is pulled.
+func (p *RoundTripper) sendsOnce(req *http.Request) bool {
+	return isSingleAttempt(req.Context()) || p.killSwitch != nil && p.killSwitch()
+}
@@ -0,0 +1,78 @@
+package retryabletransport_test
+
+import (
+	"context"
+	"net/http"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/linzhengen/retryabletransport"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_WithKillSwitch(t *testing.T) {
+	var killSwitch atomic.Bool
+	calledCount, pulled := 0, false
+	rt := retryabletransport.New(
+		roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+			calledCount++
+			if calledCount == 2 && !pulled {
+				// Operators pull the switch while the first request is retrying.
+				pulled = true
+				killSwitch.Store(true)
+			}
+			return &http.Response{StatusCode: http.StatusServiceUnavailable}, nil
+		}),
+		nil,
+		nil,
+		&retryabletransport.BackOffPolicy{MaxRetries: 3, InitialInterval: time.Millisecond},
+		retryabletransport.WithKillSwitch(killSwitch.Load),
+	)
+	send := func() {
+		calledCount = 0
+		req, err := http.NewRequest(http.MethodGet, "http://example.com", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp, err := rt.RoundTrip(req)
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusServiceUnavailable, resp.StatusCode)
+	}
+
+	send()
+	assert.Equal(t, 2, calledCount, "the in-flight request stops retrying")
+	send()
+	assert.Equal(t, 1, calledCount, "new requests are sent once")
+	killSwitch.Store(false)
+	send()
+	assert.Equal(t, 4, calledCount, "retries resume once the switch is released")
+}
+
+func Test_WithKillSwitch_TokenRefresh(t *testing.T) {
+	calledCount, refreshes := 0, 0
+	rt := retryabletransport.New(
+		roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+			calledCount++
+			return &http.Response{StatusCode: http.StatusUnauthorized, Body: http.NoBody}, nil
+		}),
+		nil,
+		nil,
+		&retryabletransport.BackOffPolicy{MaxRetries: 3, InitialInterval: time.Millisecond},
+		retryabletransport.WithKillSwitch(func() bool { return true }),
+		retryabletransport.WithTokenRefresh(func(ctx context.Context) (string, error) {
+			refreshes++
+			return "Bearer fresh", nil
+		}),
+	)
+	req, err := http.NewRequest(http.MethodGet, "http://example.com", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := rt.RoundTrip(req)
+	if assert.NoError(t, err) {
+		assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+	}
+	assert.Equal(t, 1, calledCount, "a rejected token must not be resent while the switch is pulled")
+	assert.Equal(t, 0, refreshes)
+}
@@ -0,0 +1,79 @@
+package retryabletransport
+
+import (
+	"errors"
+	"log/slog"
+	"time"
+)
+
+// LoggerOption configures the logging of WithLogger.
+type LoggerOption func(*logger)
+
+// LogRetriesAt sets the level retries are logged at. It defaults to slog.LevelDebug.
+func LogRetriesAt(level slog.Level) LoggerOption {
+	return func(l *logger) {
+		l.retryLevel = level
+	}
+}
+
+// LogGiveUpsAt sets the level requests that failed for good are logged at. It defaults to slog.LevelWarn.
+func LogGiveUpsAt(level slog.Level) LoggerOption {
+	return func(l *logger) {
+		l.giveUpLevel = level
+	}
+}
+
+// WithLogger logs every retry and every request that failed for good, whether because retries ran out or because
+// the failure was not retryable, to l. By default retries are logged at debug level, so that they stay quiet in
+// production, and give-ups at warn level, so that failures are visible; see LogRetriesAt and LogGiveUpsAt.
+// Logging is independent of NotifyFunc and notification coalescing. URLs are logged with their password redacted.
+func WithLogger(l *slog.Logger, opts ...LoggerOption) Option {
+	lg := &logger{logger: l, retryLevel: slog.LevelDebug, giveUpLevel: slog.LevelWarn}
+	for _, opt := range opts {
+		opt(lg)
+	}
+	return func(p *RoundTripper) {
+		p.logger = lg
+	}
+}
+
+// logger holds the configuration of WithLogger.
+type logger struct {
+	logger      *slog.Logger
+	retryLevel  slog.Level
+	giveUpLevel slog.Level
+}
+
+// logRetry logs that the latest attempt of state failed with err and is retried after delay.
+func (l *logger) logRetry(state *retryState, err error, delay time.Duration) {
+	ctx := state.req.Context()
+	if !l.logger.Enabled(ctx, l.retryLevel) {
+		return
+	}
+	l.logger.LogAttrs(ctx, l.retryLevel, "retrying request", append(l.attrs(state, err), slog.Duration("delay", delay))...)
+}
+
+// logGiveUp logs that the request of state failed for good with err.
+func (l *logger) logGiveUp(state *retryState, err error) {
+	ctx := state.req.Context()
+	if !l.logger.Enabled(ctx, l.giveUpLevel) {
+		return
+	}
+	l.logger.LogAttrs(ctx, l.giveUpLevel, "giving up on request", l.attrs(state, err)...)
+}
+
+// attrs returns the attributes describing the request of state and the outcome of its latest attempt.
+func (l *logger) attrs(state *retryState, err error) []slog.Attr {
+	attrs := []slog.Attr{
+		slog.String("method", state.req.Method),
+		slog.String("url", state.req.URL.Redacted()),
+		slog.Uint64("attempts", state.attempts),
+	}
+	if state.resp != nil {
+		attrs = append(attrs, slog.Int("status", state.resp.StatusCode))
+	}
+	if err != nil && !errors.Is(err, ShouldRetryRespError) {
+		attrs = append(attrs, slog.Any("error", err))
+	}
+	return attrs
+}
@@ -0,0 +1,38 @@
+package retryabletransport
+
+import (
+	"net/http"
+	"time"
+)
+
+// MetricsRecorder receives metrics about the retries of a RoundTripper. Implementations must be safe for
+// concurrent use.
+type MetricsRecorder interface {
+	// ObserveRetryDelay records the delay waited before retrying req, e.g. into a histogram, which shows how often
+	// MaxInterval is hit. It is called for every retry, regardless of notification coalescing.
+	ObserveRetryDelay(req *http.Request, delay time.Duration)
+}
+
+// AttemptMetricsRecorder is an optional interface of a MetricsRecorder, for recorders that also record every
+// attempt, the outcome of the attempts that are retried, and the requests that failed for good, e.g. into
+// counters by host and status code. resp, if any, is only valid for the duration of the call, and its body must
+// not be read.
+type AttemptMetricsRecorder interface {
+	// ObserveAttempt records an attempt of a request, with req as sent for the attempt and its outcome.
+	ObserveAttempt(req *http.Request, resp *http.Response, err error)
+	// ObserveRetry records a retry of req, along with the outcome of the failed attempt and the delay waited
+	// before the retry. It is called right after ObserveRetryDelay.
+	ObserveRetry(req *http.Request, resp *http.Response, err error, delay time.Duration)
+	// ObserveGiveUp records a request that failed for good, along with its last response and error, whether
+	// because retries were exhausted or because the failure was not retryable.
+	ObserveGiveUp(req *http.Request, resp *http.Response, err error)
+}
+
+// WithMetricsRecorder sets the MetricsRecorder receiving metrics about retries. If recorder also implements
+// AttemptMetricsRecorder, it receives those metrics as well.
+func WithMetricsRecorder(recorder MetricsRecorder) Option {
+	return func(p *RoundTripper) {
+		p.metricsRecorder = recorder
+		p.attemptRecorder, _ = recorder.(AttemptMetricsRecorder)
+	}
+}
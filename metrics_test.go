@@ -0,0 +1,131 @@
+package retryabletransport_test
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/linzhengen/retryabletransport"
+	"github.com/stretchr/testify/assert"
+)
+
+type delayRecorder struct {
+	mu     sync.Mutex
+	delays []time.Duration
+}
+
+func (r *delayRecorder) ObserveRetryDelay(req *http.Request, delay time.Duration) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.delays = append(r.delays, delay)
+}
+
+func Test_WithMetricsRecorder(t *testing.T) {
+	recorder := &delayRecorder{}
+	var notified []time.Duration
+	rt := retryabletransport.New(
+		roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+			return &http.Response{StatusCode: http.StatusServiceUnavailable}, nil
+		}),
+		nil,
+		func(ctx context.Context, err error, duration time.Duration) {
+			notified = append(notified, duration)
+		},
+		&retryabletransport.BackOffPolicy{MaxRetries: 3, InitialInterval: time.Millisecond},
+		retryabletransport.WithMetricsRecorder(recorder),
+		retryabletransport.WithNotifyCoalescing(retryabletransport.CoalesceByErrorMessage()),
+	)
+	req, err := http.NewRequest(http.MethodGet, "http://example.com", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, _ = rt.RoundTrip(req)
+	assert.Len(t, recorder.delays, 3)
+	assert.Equal(t, notified[0], recorder.delays[0])
+	assert.Len(t, notified, 1)
+}
+
+type attemptRecorder struct {
+	delayRecorder
+	attempts []int
+	retries  []int
+	giveUps  []int
+}
+
+func statusOf(resp *http.Response) int {
+	if resp == nil {
+		return 0
+	}
+	return resp.StatusCode
+}
+
+func (r *attemptRecorder) ObserveAttempt(req *http.Request, resp *http.Response, err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.attempts = append(r.attempts, statusOf(resp))
+}
+
+func (r *attemptRecorder) ObserveRetry(req *http.Request, resp *http.Response, err error, delay time.Duration) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.retries = append(r.retries, statusOf(resp))
+}
+
+func (r *attemptRecorder) ObserveGiveUp(req *http.Request, resp *http.Response, err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.giveUps = append(r.giveUps, statusOf(resp))
+}
+
+func Test_WithMetricsRecorder_AttemptMetricsRecorder(t *testing.T) {
+	type test struct {
+		name         string
+		statusCodes  []int
+		wantAttempts []int
+		wantRetries  []int
+		wantGiveUps  []int
+	}
+	tests := []test{
+		{
+			name:         "success after retries",
+			statusCodes:  []int{http.StatusServiceUnavailable, http.StatusTooManyRequests, http.StatusOK},
+			wantAttempts: []int{http.StatusServiceUnavailable, http.StatusTooManyRequests, http.StatusOK},
+			wantRetries:  []int{http.StatusServiceUnavailable, http.StatusTooManyRequests},
+		},
+		{
+			name:         "retries exhausted",
+			statusCodes:  []int{http.StatusServiceUnavailable, http.StatusServiceUnavailable, http.StatusServiceUnavailable},
+			wantAttempts: []int{http.StatusServiceUnavailable, http.StatusServiceUnavailable, http.StatusServiceUnavailable},
+			wantRetries:  []int{http.StatusServiceUnavailable, http.StatusServiceUnavailable},
+			wantGiveUps:  []int{http.StatusServiceUnavailable},
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			recorder := &attemptRecorder{}
+			attempt := 0
+			rt := retryabletransport.New(
+				roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+					resp := &http.Response{StatusCode: tc.statusCodes[attempt], Body: http.NoBody}
+					attempt++
+					return resp, nil
+				}),
+				nil,
+				nil,
+				&retryabletransport.BackOffPolicy{MaxRetries: 2, InitialInterval: time.Millisecond},
+				retryabletransport.WithMetricsRecorder(recorder),
+			)
+			req, err := http.NewRequest(http.MethodGet, "http://example.com", nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			_, _ = rt.RoundTrip(req)
+			assert.Equal(t, tc.wantAttempts, recorder.attempts)
+			assert.Equal(t, tc.wantRetries, recorder.retries)
+			assert.Equal(t, tc.wantGiveUps, recorder.giveUps)
+			assert.Len(t, recorder.delays, len(tc.wantRetries))
+		})
+	}
+}
@@ -0,0 +1,59 @@
+package retryabletransport
+
+import (
+	"reflect"
+	"time"
+)
+
+// NotifyFilter decides whether a retry notification for err is passed on to NotifyFunc.
+// last is the error of the previously notified retry of the same request, or nil if none was notified yet,
+// and suppressed is the number of notifications dropped since then.
+type NotifyFilter func(last, err error, suppressed int) bool
+
+// WithNotifyCoalescing coalesces the retry notifications of a request with filter, which reduces log spam
+// during prolonged outages. By default NotifyFunc is invoked for every retry.
+func WithNotifyCoalescing(filter NotifyFilter) Option {
+	return func(p *RoundTripper) {
+		p.notifyFilter = filter
+	}
+}
+
+// CoalesceByErrorType returns a NotifyFilter that notifies only when the type of the error changes.
+func CoalesceByErrorType() NotifyFilter {
+	return func(last, err error, suppressed int) bool {
+		return last == nil || reflect.TypeOf(last) != reflect.TypeOf(err)
+	}
+}
+
+// CoalesceByErrorMessage returns a NotifyFilter that notifies only when the message of the error changes.
+func CoalesceByErrorMessage() NotifyFilter {
+	return func(last, err error, suppressed int) bool {
+		return last == nil || last.Error() != err.Error()
+	}
+}
+
+// NotifyEveryN returns a NotifyFilter that notifies the first retry and every nth retry after it.
+func NotifyEveryN(n int) NotifyFilter {
+	return func(last, err error, suppressed int) bool {
+		return last == nil || suppressed+1 >= n
+	}
+}
+
+// notify passes the retry notification for err on to NotifyFunc unless it is coalesced.
+func (p *RoundTripper) notify(state *retryState, err error, duration time.Duration) {
+	notifyFunc := p.notifyFunc
+	if fn, ok := requestNotify(state.req.Context()); ok {
+		notifyFunc = fn
+	}
+	if notifyFunc == nil {
+		return
+	}
+	if p.notifyFilter != nil {
+		if !p.notifyFilter(state.lastNotified, err, state.suppressedNotifies) {
+			state.suppressedNotifies++
+			return
+		}
+		state.lastNotified, state.suppressedNotifies = err, 0
+	}
+	notifyFunc(p.notifyContextFunc(state.req), err, duration)
+}
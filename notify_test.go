@@ -0,0 +1,88 @@
+package retryabletransport_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/linzhengen/retryabletransport"
+	"github.com/stretchr/testify/assert"
+)
+
+type customErr struct{ msg string }
+
+func (e *customErr) Error() string { return e.msg }
+
+func Test_NotifyFilter(t *testing.T) {
+	errA := errors.New("a")
+	errB := errors.New("b")
+	type test struct {
+		name   string
+		filter retryabletransport.NotifyFilter
+		errs   []error
+		want   []bool
+	}
+	tests := []test{
+		{
+			name:   "CoalesceByErrorType",
+			filter: retryabletransport.CoalesceByErrorType(),
+			errs:   []error{errA, errB, &customErr{"c"}, &customErr{"d"}, errA},
+			want:   []bool{true, false, true, false, true},
+		},
+		{
+			name:   "CoalesceByErrorMessage",
+			filter: retryabletransport.CoalesceByErrorMessage(),
+			errs:   []error{errA, errA, errB, errB, errA},
+			want:   []bool{true, false, true, false, true},
+		},
+		{
+			name:   "NotifyEveryN",
+			filter: retryabletransport.NotifyEveryN(3),
+			errs:   []error{errA, errA, errA, errA, errA, errA, errA},
+			want:   []bool{true, false, false, true, false, false, true},
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			var last error
+			suppressed := 0
+			var got []bool
+			for _, err := range tc.errs {
+				notified := tc.filter(last, err, suppressed)
+				if notified {
+					last, suppressed = err, 0
+				} else {
+					suppressed++
+				}
+				got = append(got, notified)
+			}
+			assert.Equal(t, tc.want, got)
+		})
+	}
+}
+
+func Test_WithNotifyCoalescing(t *testing.T) {
+	var notified []error
+	rt := retryabletransport.New(
+		roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+			return nil, fmt.Errorf("read: %w", syscall.ECONNRESET)
+		}),
+		nil,
+		func(ctx context.Context, err error, duration time.Duration) {
+			notified = append(notified, err)
+		},
+		&retryabletransport.BackOffPolicy{MaxRetries: 2},
+		retryabletransport.WithNotifyCoalescing(retryabletransport.CoalesceByErrorMessage()),
+	)
+	req, err := http.NewRequest(http.MethodGet, "http://example.com", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = rt.RoundTrip(req)
+	assert.ErrorIs(t, err, syscall.ECONNRESET)
+	assert.Len(t, notified, 1)
+}
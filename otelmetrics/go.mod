@@ -0,0 +1,28 @@
+module github.com/linzhengen/retryabletransport/otelmetrics
+
+go 1.22
+
+require (
+	github.com/linzhengen/retryabletransport v0.0.0-20261014070115-44f756ef16e5
+	github.com/stretchr/testify v1.9.0
+	go.opentelemetry.io/otel v1.31.0
+	go.opentelemetry.io/otel/metric v1.31.0
+	go.opentelemetry.io/otel/sdk/metric v1.31.0
+)
+
+require (
+	github.com/cenkalti/backoff/v4 v4.2.1 // indirect
+	github.com/davecgh/go-spew v1.1.1 // indirect
+	github.com/go-logr/logr v1.4.2 // indirect
+	github.com/go-logr/stdr v1.2.2 // indirect
+	github.com/google/uuid v1.6.0 // indirect
+	github.com/pmezard/go-difflib v1.0.0 // indirect
+	go.opentelemetry.io/otel/sdk v1.31.0 // indirect
+	go.opentelemetry.io/otel/trace v1.31.0 // indirect
+	golang.org/x/sys v0.26.0 // indirect
+	gopkg.in/yaml.v3 v3.0.1 // indirect
+)
+
+// The replace only takes effect within this repository, to develop both modules together; consumers get the
+// required version of the root module, which has to be raised when this module needs newer root APIs.
+replace github.com/linzhengen/retryabletransport => ../
@@ -0,0 +1,105 @@
+// Package otelmetrics records the attempts and retries of a retryabletransport.RoundTripper into OpenTelemetry
+// metrics. It is a separate module, so that the retryabletransport package does not depend on OpenTelemetry:
+//
+//	go get github.com/linzhengen/retryabletransport/otelmetrics
+package otelmetrics
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/linzhengen/retryabletransport"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/metric/noop"
+)
+
+// Names of the instruments recorded by WithOTelMetrics.
+const (
+	// AttemptsName is the name of the counter of attempts, including the first attempt of every request.
+	AttemptsName = "http.client.retry.attempts"
+	// RetriesName is the name of the counter of retries, by the outcome of the attempt that is retried.
+	RetriesName = "http.client.retry.retries"
+	// GiveUpsName is the name of the counter of requests that failed for good, by their last outcome.
+	GiveUpsName = "http.client.retry.give_ups"
+	// BackOffDurationName is the name of the histogram of the delays waited before retries, in seconds.
+	BackOffDurationName = "http.client.retry.backoff.duration"
+)
+
+// WithOTelMetrics records the attempts, retries, give-ups, and backoff delays of a RoundTripper into instruments
+// created with meter, named AttemptsName, RetriesName, GiveUpsName, and BackOffDurationName. Every measurement has
+// the attributes "http.request.method" and "server.address", the host of the request, and, if the attempt got a
+// response, "http.response.status_code", or otherwise "error.type" set to "error". It sets the MetricsRecorder of
+// the RoundTripper, replacing the one set by retryabletransport.WithMetricsRecorder, if any. Instruments that
+// meter fails to create are reported to otel.Handle and not recorded.
+func WithOTelMetrics(meter metric.Meter) retryabletransport.Option {
+	return retryabletransport.WithMetricsRecorder(newRecorder(meter))
+}
+
+// recorder is a retryabletransport.AttemptMetricsRecorder recording into OpenTelemetry instruments.
+type recorder struct {
+	attempts        metric.Int64Counter
+	retries         metric.Int64Counter
+	giveUps         metric.Int64Counter
+	backOffDuration metric.Float64Histogram
+}
+
+// newRecorder creates the instruments of a recorder with meter, falling back to no-op instruments on errors.
+func newRecorder(meter metric.Meter) *recorder {
+	fallback := noop.Meter{}
+	r := &recorder{}
+	var err error
+	if r.attempts, err = meter.Int64Counter(AttemptsName,
+		metric.WithUnit("{attempt}"), metric.WithDescription("Attempts of HTTP requests.")); err != nil {
+		otel.Handle(err)
+		r.attempts, _ = fallback.Int64Counter(AttemptsName)
+	}
+	if r.retries, err = meter.Int64Counter(RetriesName,
+		metric.WithUnit("{retry}"), metric.WithDescription("Retries of HTTP requests.")); err != nil {
+		otel.Handle(err)
+		r.retries, _ = fallback.Int64Counter(RetriesName)
+	}
+	if r.giveUps, err = meter.Int64Counter(GiveUpsName,
+		metric.WithUnit("{request}"), metric.WithDescription("HTTP requests that failed for good.")); err != nil {
+		otel.Handle(err)
+		r.giveUps, _ = fallback.Int64Counter(GiveUpsName)
+	}
+	if r.backOffDuration, err = meter.Float64Histogram(BackOffDurationName,
+		metric.WithUnit("s"), metric.WithDescription("Delays waited before retrying HTTP requests.")); err != nil {
+		otel.Handle(err)
+		r.backOffDuration, _ = fallback.Float64Histogram(BackOffDurationName)
+	}
+	return r
+}
+
+// ObserveRetryDelay does nothing, since the delay is recorded by ObserveRetry along with the outcome of the
+// retried attempt.
+func (r *recorder) ObserveRetryDelay(*http.Request, time.Duration) {}
+
+func (r *recorder) ObserveAttempt(req *http.Request, resp *http.Response, err error) {
+	r.attempts.Add(req.Context(), 1, metric.WithAttributeSet(attributes(req, resp)))
+}
+
+func (r *recorder) ObserveRetry(req *http.Request, resp *http.Response, err error, delay time.Duration) {
+	attrs := metric.WithAttributeSet(attributes(req, resp))
+	r.retries.Add(req.Context(), 1, attrs)
+	r.backOffDuration.Record(req.Context(), delay.Seconds(), attrs)
+}
+
+func (r *recorder) ObserveGiveUp(req *http.Request, resp *http.Response, err error) {
+	r.giveUps.Add(req.Context(), 1, metric.WithAttributeSet(attributes(req, resp)))
+}
+
+// attributes returns the attributes of a measurement about req and the response of its attempt, if any.
+func attributes(req *http.Request, resp *http.Response) attribute.Set {
+	outcome := attribute.String("error.type", "error")
+	if resp != nil {
+		outcome = attribute.Int("http.response.status_code", resp.StatusCode)
+	}
+	return attribute.NewSet(
+		attribute.String("http.request.method", req.Method),
+		attribute.String("server.address", req.URL.Host),
+		outcome,
+	)
+}
@@ -0,0 +1,90 @@
+package otelmetrics_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/linzhengen/retryabletransport"
+	"github.com/linzhengen/retryabletransport/otelmetrics"
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel/attribute"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+)
+
+type roundTripperFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripperFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+func Test_WithOTelMetrics(t *testing.T) {
+	reader := sdkmetric.NewManualReader()
+	provider := sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader))
+	attempt := 0
+	rt := retryabletransport.New(
+		roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+			attempt++
+			if attempt == 1 {
+				return nil, errors.New("connection reset")
+			}
+			return &http.Response{StatusCode: http.StatusServiceUnavailable, Body: http.NoBody}, nil
+		}),
+		func(req *http.Request, resp *http.Response, err error) bool {
+			return true
+		},
+		nil,
+		&retryabletransport.BackOffPolicy{MaxRetries: 2, InitialInterval: time.Millisecond, RandomizationFactor: -1, Multiplier: 1},
+		otelmetrics.WithOTelMetrics(provider.Meter("test")),
+	)
+	req, err := http.NewRequest(http.MethodGet, "http://example.com", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := rt.RoundTrip(req)
+	if assert.NoError(t, err) {
+		resp.Body.Close()
+	}
+
+	var rm metricdata.ResourceMetrics
+	if err := reader.Collect(context.Background(), &rm); err != nil {
+		t.Fatal(err)
+	}
+	sums := map[string]map[string]int64{}
+	var backOff metricdata.HistogramDataPoint[float64]
+	for _, m := range rm.ScopeMetrics[0].Metrics {
+		switch data := m.Data.(type) {
+		case metricdata.Sum[int64]:
+			sums[m.Name] = map[string]int64{}
+			for _, dp := range data.DataPoints {
+				sums[m.Name][outcome(dp.Attributes)] = dp.Value
+				host, _ := dp.Attributes.Value("server.address")
+				assert.Equal(t, "example.com", host.AsString())
+			}
+		case metricdata.Histogram[float64]:
+			assert.Equal(t, otelmetrics.BackOffDurationName, m.Name)
+			assert.Equal(t, "s", m.Unit)
+			assert.Len(t, data.DataPoints, 2)
+			backOff = data.DataPoints[0]
+		}
+	}
+	assert.Equal(t, map[string]map[string]int64{
+		otelmetrics.AttemptsName: {"error": 1, "503": 2},
+		otelmetrics.RetriesName:  {"error": 1, "503": 1},
+		otelmetrics.GiveUpsName:  {"503": 1},
+	}, sums)
+	assert.Equal(t, uint64(1), backOff.Count)
+	assert.InDelta(t, time.Millisecond.Seconds(), backOff.Sum, 1e-9)
+}
+
+// outcome returns the status code or error type of a data point.
+func outcome(attrs attribute.Set) string {
+	if v, ok := attrs.Value("http.response.status_code"); ok {
+		return v.Emit()
+	}
+	v, _ := attrs.Value("error.type")
+	return v.AsString()
+}
@@ -0,0 +1,90 @@
+package retryabletransport
+
+import (
+	"context"
+	"errors"
+	"net"
+	"time"
+)
+
+// ErrorClass is the coarse kind of error an attempt failed with, as recorded in its AttemptOutcome.
+type ErrorClass string
+
+const (
+	// ErrorClassNone is the class of attempts that got a response.
+	ErrorClassNone ErrorClass = ""
+	// ErrorClassConnect is the class of attempts whose connection could not be established.
+	ErrorClassConnect ErrorClass = "connect"
+	// ErrorClassIdleConnClosed is the class of attempts that lost the race with a server closing an idle connection.
+	ErrorClassIdleConnClosed ErrorClass = "idle conn closed"
+	// ErrorClassTimeout is the class of attempts that timed out.
+	ErrorClassTimeout ErrorClass = "timeout"
+	// ErrorClassCanceled is the class of attempts whose context was canceled.
+	ErrorClassCanceled ErrorClass = "canceled"
+	// ErrorClassOther is the class of any other error.
+	ErrorClassOther ErrorClass = "other"
+)
+
+// AttemptOutcome is the lightweight record of an attempt of a request. It keeps neither the response nor the
+// error, so that recording it holds on to no bodies or connections.
+type AttemptOutcome struct {
+	// StatusCode is the status code of the response, or zero if there is none.
+	StatusCode int
+	ErrClass   ErrorClass
+	// Delay is the wait before the next attempt, or zero if there is none.
+	Delay time.Duration
+	// Timings is the breakdown of the time the attempt took if WithAttemptTimings is used, or nil otherwise.
+	Timings *AttemptTimings
+}
+
+// AttemptOutcomesFromContext returns the outcomes of all attempts made for a request, in order, for forensic
+// logging of what happened across its retries. ctx is the context of the request carried by the response, i.e.
+// resp.Request.Context(); requests that fail without a response can be traced with WithDebugTrace instead.
+func AttemptOutcomesFromContext(ctx context.Context) ([]AttemptOutcome, bool) {
+	s, ok := ctx.Value(statsKey{}).(*stats)
+	if !ok {
+		return nil, false
+	}
+	return append([]AttemptOutcome(nil), s.outcomes...), true
+}
+
+// recordOutcome records the outcome of the latest attempt of state.
+func (s *retryState) recordOutcome() {
+	if s.outcomes == nil {
+		// Most requests make a single attempt, whose outcome fits in state without another allocation.
+		s.outcomes = s.firstOutcome[:0]
+	}
+	o := AttemptOutcome{ErrClass: classifyError(s.err), Timings: s.timings}
+	if s.resp != nil {
+		o.StatusCode = s.resp.StatusCode
+	}
+	s.outcomes = append(s.outcomes, o)
+}
+
+// recordOutcomeDelay records that the latest attempt of state is retried after delay.
+func (s *retryState) recordOutcomeDelay(delay time.Duration) {
+	if n := len(s.outcomes); n > 0 {
+		s.outcomes[n-1].Delay = delay
+	}
+}
+
+// classifyError returns the ErrorClass of err.
+func classifyError(err error) ErrorClass {
+	switch {
+	case err == nil:
+		return ErrorClassNone
+	case isIdleConnClosed(err):
+		return ErrorClassIdleConnClosed
+	case isConnectError(err):
+		return ErrorClassConnect
+	case errors.Is(err, context.Canceled):
+		return ErrorClassCanceled
+	case errors.Is(err, context.DeadlineExceeded):
+		return ErrorClassTimeout
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return ErrorClassTimeout
+	}
+	return ErrorClassOther
+}
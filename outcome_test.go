@@ -0,0 +1,86 @@
+package retryabletransport_test
+
+import (
+	"context"
+	"net/http"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/linzhengen/retryabletransport"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_AttemptOutcomesFromContext(t *testing.T) {
+	type test struct {
+		name  string
+		resps []*http.Response
+		errs  []error
+		want  []retryabletransport.AttemptOutcome
+	}
+	tests := []test{
+		{
+			name:  "single attempt",
+			resps: []*http.Response{{StatusCode: http.StatusOK}},
+			errs:  []error{nil},
+			want: []retryabletransport.AttemptOutcome{
+				{StatusCode: http.StatusOK},
+			},
+		},
+		{
+			name:  "retried until success",
+			resps: []*http.Response{{StatusCode: http.StatusServiceUnavailable}, nil, nil, {StatusCode: http.StatusOK}},
+			errs:  []error{nil, syscall.ECONNREFUSED, context.DeadlineExceeded, nil},
+			want: []retryabletransport.AttemptOutcome{
+				{StatusCode: http.StatusServiceUnavailable, Delay: time.Millisecond},
+				{ErrClass: retryabletransport.ErrorClassConnect, Delay: time.Millisecond},
+				{ErrClass: retryabletransport.ErrorClassTimeout, Delay: time.Millisecond},
+				{StatusCode: http.StatusOK},
+			},
+		},
+		{
+			name:  "retries ran out",
+			resps: []*http.Response{{StatusCode: http.StatusServiceUnavailable}, {StatusCode: http.StatusServiceUnavailable}, {StatusCode: http.StatusServiceUnavailable}, {StatusCode: http.StatusServiceUnavailable}},
+			errs:  []error{nil, nil, nil, nil},
+			want: []retryabletransport.AttemptOutcome{
+				{StatusCode: http.StatusServiceUnavailable, Delay: time.Millisecond},
+				{StatusCode: http.StatusServiceUnavailable, Delay: time.Millisecond},
+				{StatusCode: http.StatusServiceUnavailable, Delay: time.Millisecond},
+				{StatusCode: http.StatusServiceUnavailable},
+			},
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			calledCount := 0
+			rt := retryabletransport.New(
+				roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+					resp, err := tc.resps[calledCount], tc.errs[calledCount]
+					calledCount++
+					return resp, err
+				}),
+				nil,
+				nil,
+				&retryabletransport.BackOffPolicy{
+					MaxRetries:          3,
+					InitialInterval:     time.Millisecond,
+					Multiplier:          1,
+					RandomizationFactor: -1,
+				},
+			)
+			req, err := http.NewRequest(http.MethodGet, "http://example.com", nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			resp, err := rt.RoundTrip(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			outcomes, ok := retryabletransport.AttemptOutcomesFromContext(resp.Request.Context())
+			assert.True(t, ok)
+			assert.Equal(t, tc.want, outcomes)
+		})
+	}
+	_, ok := retryabletransport.AttemptOutcomesFromContext(context.Background())
+	assert.False(t, ok)
+}
@@ -0,0 +1,99 @@
+package retryabletransport
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// RateLimitHeaders configures WithRateLimitHeaders.
+type RateLimitHeaders struct {
+	// Remaining is the header reporting the number of requests left in the current quota window.
+	// It defaults to X-RateLimit-Remaining.
+	Remaining string
+	// Reset is the header reporting when the window resets, in seconds either since the Unix epoch, as e.g. GitHub
+	// reports it, or from now, as the IETF RateLimit headers do; values below 1e9 are taken to be from now.
+	// It defaults to X-RateLimit-Reset.
+	Reset string
+	// MinRemaining is the number of remaining requests at or below which requests wait for the reset.
+	MinRemaining int64
+	// MaxWait, if set, caps the time a request waits for a reset, so that a bogus reset time cannot stall it.
+	MaxWait time.Duration
+}
+
+// WithRateLimitHeaders throttles requests proactively by the quota servers report in response headers: once a
+// response from a host, successful or not, reports no more than headers.MinRemaining requests left, every attempt
+// to that host waits until the reported reset before it is sent, instead of running into 429 Too Many Requests.
+// Hosts are told apart by the URL of the request, and the wait is cut short if the request context is done, in
+// which case its error is returned. Responses without parseable headers leave the throttling as it is.
+func WithRateLimitHeaders(headers RateLimitHeaders) Option {
+	if headers.Remaining == "" {
+		headers.Remaining = "X-RateLimit-Remaining"
+	}
+	if headers.Reset == "" {
+		headers.Reset = "X-RateLimit-Reset"
+	}
+	return func(p *RoundTripper) {
+		p.rateLimiter = &rateLimiter{headers: headers, resets: map[string]time.Time{}}
+	}
+}
+
+// rateLimiter holds the reset times of the hosts whose quota is exhausted.
+type rateLimiter struct {
+	headers RateLimitHeaders
+
+	mu     sync.Mutex
+	resets map[string]time.Time
+}
+
+// observe records the quota reported by resp for host.
+func (l *rateLimiter) observe(host string, resp *http.Response) {
+	remaining, err := strconv.ParseInt(resp.Header.Get(l.headers.Remaining), 10, 64)
+	if err != nil {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if remaining > l.headers.MinRemaining {
+		delete(l.resets, host)
+		return
+	}
+	reset, err := strconv.ParseInt(resp.Header.Get(l.headers.Reset), 10, 64)
+	if err != nil || reset < 0 {
+		return
+	}
+	now := time.Now()
+	resetAt := now.Add(time.Duration(reset) * time.Second)
+	if reset >= 1e9 {
+		resetAt = time.Unix(reset, 0)
+	}
+	if l.headers.MaxWait > 0 && resetAt.Sub(now) > l.headers.MaxWait {
+		resetAt = now.Add(l.headers.MaxWait)
+	}
+	l.resets[host] = resetAt
+}
+
+// delay returns how long requests to host wait for the reset of its quota.
+func (l *rateLimiter) delay(host string) time.Duration {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	resetAt, ok := l.resets[host]
+	if !ok {
+		return 0
+	}
+	d := time.Until(resetAt)
+	if d <= 0 {
+		delete(l.resets, host)
+	}
+	return d
+}
+
+// waitRateLimit waits under ctx until the quota of the host of req is reset, if it is exhausted.
+func (p *RoundTripper) waitRateLimit(ctx context.Context, req *http.Request) error {
+	if d := p.rateLimiter.delay(req.URL.Host); d > 0 {
+		return p.wait(ctx, d)
+	}
+	return nil
+}
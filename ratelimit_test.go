@@ -0,0 +1,100 @@
+package retryabletransport_test
+
+import (
+	"net/http"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/linzhengen/retryabletransport"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_WithRateLimitHeaders(t *testing.T) {
+	type test struct {
+		name     string
+		headers  retryabletransport.RateLimitHeaders
+		header   http.Header
+		wantWait time.Duration
+	}
+	tests := []test{
+		{
+			name:     "exhausted quota waits for a reset in seconds from now",
+			header:   http.Header{"X-Ratelimit-Remaining": {"0"}, "X-Ratelimit-Reset": {"30"}},
+			wantWait: 30 * time.Second,
+		},
+		{
+			name:     "exhausted quota waits for a reset in Unix time",
+			header:   http.Header{"X-Ratelimit-Remaining": {"0"}, "X-Ratelimit-Reset": {strconv.FormatInt(time.Now().Add(time.Minute).Unix(), 10)}},
+			wantWait: time.Minute,
+		},
+		{
+			name:    "remaining quota does not wait",
+			header:  http.Header{"X-Ratelimit-Remaining": {"5"}, "X-Ratelimit-Reset": {"30"}},
+			headers: retryabletransport.RateLimitHeaders{MinRemaining: 4},
+		},
+		{
+			name:     "low quota waits at the threshold",
+			header:   http.Header{"X-Ratelimit-Remaining": {"4"}, "X-Ratelimit-Reset": {"30"}},
+			headers:  retryabletransport.RateLimitHeaders{MinRemaining: 4},
+			wantWait: 30 * time.Second,
+		},
+		{
+			name:     "custom header names",
+			header:   http.Header{"Ratelimit-Remaining": {"0"}, "Ratelimit-Reset": {"10"}},
+			headers:  retryabletransport.RateLimitHeaders{Remaining: "RateLimit-Remaining", Reset: "RateLimit-Reset"},
+			wantWait: 10 * time.Second,
+		},
+		{
+			name:     "wait is capped",
+			header:   http.Header{"X-Ratelimit-Remaining": {"0"}, "X-Ratelimit-Reset": {"3600"}},
+			headers:  retryabletransport.RateLimitHeaders{MaxWait: 5 * time.Second},
+			wantWait: 5 * time.Second,
+		},
+		{
+			name:   "unparseable reset does not wait",
+			header: http.Header{"X-Ratelimit-Remaining": {"0"}, "X-Ratelimit-Reset": {"soon"}},
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			var waits []time.Duration
+			rt := retryabletransport.New(
+				roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+					return &http.Response{StatusCode: http.StatusOK, Header: tc.header, Body: http.NoBody}, nil
+				}),
+				nil,
+				nil,
+				nil,
+				retryabletransport.WithRateLimitHeaders(tc.headers),
+				retryabletransport.WithAfter(func(d time.Duration) <-chan time.Time {
+					waits = append(waits, d)
+					c := make(chan time.Time, 1)
+					c <- time.Now()
+					return c
+				}),
+			)
+			for _, url := range []string{"http://example.com/a", "http://example.com/b", "http://example.org"} {
+				req, err := http.NewRequest(http.MethodGet, url, nil)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if _, err := rt.RoundTrip(req); err != nil {
+					t.Fatal(err)
+				}
+				if url == "http://example.com/a" {
+					assert.Empty(t, waits, "the first request must not wait")
+				}
+			}
+			if tc.wantWait == 0 {
+				assert.Empty(t, waits)
+				return
+			}
+			// Only the second request waits; example.org has a quota of its own.
+			if assert.Len(t, waits, 1) {
+				assert.LessOrEqual(t, waits[0], tc.wantWait)
+				assert.Greater(t, waits[0], tc.wantWait-2*time.Second)
+			}
+		})
+	}
+}
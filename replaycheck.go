@@ -0,0 +1,80 @@
+package retryabletransport
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+)
+
+// BodyReplayMismatchError is the error of a request whose body, replayed through GetBody for a retry, has another
+// length than the body of its first attempt, see WithBodyReplayCheck.
+var BodyReplayMismatchError = errors.New("request body replayed through GetBody differs in length")
+
+// WithBodyReplayCheck counts the bytes of request bodies replayed through GetBody, and fails a request with an
+// error matching BodyReplayMismatchError, without retrying it further, once a retry read its body to the end with
+// another length than its first attempt did. A GetBody yielding different bodies is a bug, e.g. a body built from
+// mutable state, which would otherwise send different requests on retries. Bodies buffered by the RoundTripper are
+// identical on every attempt by construction, so the check only applies to requests sent with their own GetBody,
+// e.g. with WithoutBodyBuffering. An inner *http.Transport catches bodies shorter than a known ContentLength by
+// itself, so the check helps most with bodies of unknown length.
+func WithBodyReplayCheck() Option {
+	return func(p *RoundTripper) {
+		p.bodyReplayCheck = true
+	}
+}
+
+// replayCheck compares the lengths of the bodies of the attempts of a request.
+type replayCheck struct {
+	mu sync.Mutex
+	// first is the length of the body of the first attempt, or -1 until it was read to the end.
+	first int64
+	err   error
+}
+
+// newReplayCheck creates a new replayCheck.
+func newReplayCheck() *replayCheck {
+	return &replayCheck{first: -1}
+}
+
+// wrap returns body counting its bytes for the check of the given attempt.
+func (c *replayCheck) wrap(body io.ReadCloser, attempt uint64) io.ReadCloser {
+	return &replayCheckBody{ReadCloser: body, check: c, attempt: attempt}
+}
+
+// done records that the body of the given attempt was read to the end with length n.
+func (c *replayCheck) done(attempt uint64, n int64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if attempt == 0 {
+		c.first = n
+	} else if c.first >= 0 && n != c.first && c.err == nil {
+		c.err = fmt.Errorf("%w: attempt %d read %d bytes, the first attempt %d", BodyReplayMismatchError, attempt, n, c.first)
+	}
+}
+
+// mismatch returns the error of the first replay whose length differed from the first attempt, if any.
+func (c *replayCheck) mismatch() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.err
+}
+
+// replayCheckBody counts the bytes read from the body of an attempt for a replayCheck.
+type replayCheckBody struct {
+	io.ReadCloser
+	check   *replayCheck
+	attempt uint64
+	n       int64
+	eof     bool
+}
+
+func (b *replayCheckBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	b.n += int64(n)
+	if err == io.EOF && !b.eof {
+		b.eof = true
+		b.check.done(b.attempt, b.n)
+	}
+	return n, err
+}
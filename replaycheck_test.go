@@ -0,0 +1,86 @@
+package retryabletransport_test
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/linzhengen/retryabletransport"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_WithBodyReplayCheck(t *testing.T) {
+	type test struct {
+		name         string
+		replays      []string
+		opts         []retryabletransport.Option
+		wantAttempts int32
+		wantErr      error
+	}
+	tests := []test{
+		{
+			name:         "consistent GetBody",
+			replays:      []string{"payload", "payload"},
+			opts:         []retryabletransport.Option{retryabletransport.WithBodyReplayCheck()},
+			wantAttempts: 3,
+		},
+		{
+			name:         "inconsistent GetBody",
+			replays:      []string{"payload", "payload with more"},
+			opts:         []retryabletransport.Option{retryabletransport.WithBodyReplayCheck()},
+			wantAttempts: 3,
+			wantErr:      retryabletransport.BodyReplayMismatchError,
+		},
+		{
+			name:         "inconsistent GetBody without check",
+			replays:      []string{"payload", "payload with more"},
+			wantAttempts: 3,
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			var attempts atomic.Int32
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				_, _ = io.Copy(io.Discard, r.Body)
+				if attempts.Add(1) < 3 {
+					w.WriteHeader(http.StatusServiceUnavailable)
+				}
+			}))
+			defer server.Close()
+			rt := retryabletransport.New(
+				nil,
+				nil,
+				nil,
+				&retryabletransport.BackOffPolicy{MaxRetries: 3, InitialInterval: time.Millisecond},
+				append([]retryabletransport.Option{retryabletransport.WithoutBodyBuffering()}, tc.opts...)...,
+			)
+			// The body is of unknown length, so the transport reads every replay to its end.
+			req, err := http.NewRequest(http.MethodPost, server.URL, io.NopCloser(strings.NewReader("payload")))
+			if err != nil {
+				t.Fatal(err)
+			}
+			replay := 0
+			req.GetBody = func() (io.ReadCloser, error) {
+				body := tc.replays[replay]
+				replay++
+				return io.NopCloser(strings.NewReader(body)), nil
+			}
+			resp, err := rt.RoundTrip(req)
+			assert.Equal(t, tc.wantAttempts, attempts.Load())
+			if tc.wantErr != nil {
+				assert.ErrorIs(t, err, tc.wantErr)
+				assert.ErrorContains(t, err, "attempt 2 read 17 bytes, the first attempt 7")
+				assert.Nil(t, resp)
+				return
+			}
+			if assert.NoError(t, err) {
+				resp.Body.Close()
+				assert.Equal(t, http.StatusOK, resp.StatusCode)
+			}
+		})
+	}
+}
@@ -0,0 +1,36 @@
+package retryabletransport
+
+import (
+	"context"
+	"time"
+
+	"github.com/cenkalti/backoff/v4"
+)
+
+// Retry calls fn until it succeeds, shouldRetry returns false for its error, or policy allows no more retries,
+// and returns the result of the last call. It waits between calls with the same backoff a RoundTripper created
+// with policy does, so operations other than HTTP requests, such as database calls, can share a retry policy.
+// A nil policy defaults to MaxRetries: 3 like New, a nil shouldRetry retries every error, and notify, if set, is
+// called with ctx before each wait. Waiting stops once ctx is done, returning the error of ctx.
+func Retry[T any](ctx context.Context, fn func() (T, error), policy *BackOffPolicy, shouldRetry func(error) bool, notify NotifyFunc) (T, error) {
+	if policy == nil {
+		policy = &BackOffPolicy{MaxRetries: 3}
+	}
+	resolved := policy.resolve()
+	var b backoff.BackOff = backoff.WithMaxRetries(resolved.newBackOff(), resolved.MaxRetries)
+	b = resolved.clamp(b)
+	operation := func() (T, error) {
+		v, err := fn()
+		if err != nil && shouldRetry != nil && !shouldRetry(err) {
+			return v, backoff.Permanent(err)
+		}
+		return v, err
+	}
+	var notifyFunc backoff.Notify
+	if notify != nil {
+		notifyFunc = func(err error, d time.Duration) {
+			notify(ctx, err, d)
+		}
+	}
+	return backoff.RetryNotifyWithData(operation, backoff.WithContext(b, ctx), notifyFunc)
+}
@@ -0,0 +1,93 @@
+package retryabletransport_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/linzhengen/retryabletransport"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_Retry(t *testing.T) {
+	errTransient := errors.New("transient")
+	errFatal := errors.New("fatal")
+	type test struct {
+		name        string
+		errs        []error
+		shouldRetry func(error) bool
+		want        int
+		wantErr     error
+		wantCalls   int
+		wantNotify  int
+	}
+	tests := []test{
+		{
+			name:      "success on the first call",
+			want:      1,
+			wantCalls: 1,
+		},
+		{
+			name:       "success after retries",
+			errs:       []error{errTransient, errTransient},
+			want:       3,
+			wantCalls:  3,
+			wantNotify: 2,
+		},
+		{
+			name:       "gives up once retries run out",
+			errs:       []error{errTransient, errTransient, errTransient},
+			want:       3,
+			wantErr:    errTransient,
+			wantCalls:  3,
+			wantNotify: 2,
+		},
+		{
+			name: "does not retry errors rejected by shouldRetry",
+			errs: []error{errFatal},
+			shouldRetry: func(err error) bool {
+				return !errors.Is(err, errFatal)
+			},
+			want:      1,
+			wantErr:   errFatal,
+			wantCalls: 1,
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			calls, notified := 0, 0
+			got, err := retryabletransport.Retry(
+				context.Background(),
+				func() (int, error) {
+					calls++
+					if calls <= len(tc.errs) {
+						return calls, tc.errs[calls-1]
+					}
+					return calls, nil
+				},
+				&retryabletransport.BackOffPolicy{MaxRetries: 2, InitialInterval: time.Millisecond},
+				tc.shouldRetry,
+				func(ctx context.Context, err error, duration time.Duration) {
+					notified++
+				},
+			)
+			assert.ErrorIs(t, err, tc.wantErr)
+			assert.Equal(t, tc.want, got)
+			assert.Equal(t, tc.wantCalls, calls)
+			assert.Equal(t, tc.wantNotify, notified)
+		})
+	}
+}
+
+func Test_Retry_Context(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	calls := 0
+	_, err := retryabletransport.Retry(ctx, func() (string, error) {
+		calls++
+		cancel()
+		return "", errors.New("transient")
+	}, &retryabletransport.BackOffPolicy{MaxRetries: 5, InitialInterval: time.Hour}, nil, nil)
+	assert.ErrorIs(t, err, context.Canceled)
+	assert.Equal(t, 1, calls)
+}
@@ -0,0 +1,158 @@
+package retryabletransport
+
+import (
+	"errors"
+	"math"
+	"math/rand/v2"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/cenkalti/backoff/v4"
+)
+
+// RetryAfterExceededBudgetError is returned, wrapping the error of the last attempt, when the delay requested by
+// a Retry-After header would outlast the deadline of the request context.
+var RetryAfterExceededBudgetError = errors.New("retry-after exceeds the remaining context budget")
+
+// RetryAfterFunc extracts the delay a server asks clients to wait before retrying from a response.
+// ok is false if the response does not ask for a specific delay.
+type RetryAfterFunc func(resp *http.Response) (delay time.Duration, ok bool)
+
+// WithRetryAfter waits for the delay requested by the Retry-After header of a retried response,
+// given in seconds or as an HTTP date, instead of the computed backoff delay. If the delay would outlast the
+// deadline of the request context, the request is not retried: the last response is closed and an error wrapping
+// RetryAfterExceededBudgetError is returned right away, without a response. Retries honoring Retry-After count
+// against BackOffPolicy.MaxRetries like any other, and once they are exhausted the last response is returned.
+func WithRetryAfter() Option {
+	return WithRetryAfterFunc(ParseRetryAfter)
+}
+
+// WithRetryAfterFunc is like WithRetryAfter, but extracts the delay with retryAfterFunc, e.g. from nonstandard
+// headers such as X-RateLimit-Reset or Retry-In-Ms. Responses for which it returns false use the computed
+// backoff delay.
+func WithRetryAfterFunc(retryAfterFunc RetryAfterFunc) Option {
+	return func(p *RoundTripper) {
+		p.retryAfterFunc = retryAfterFunc
+	}
+}
+
+// DefaultMaxRetryAfter is the default cap of the delays honored by WithRetryAfter or WithRetryAfterFunc.
+const DefaultMaxRetryAfter = 5 * time.Minute
+
+// WithMaxRetryAfter caps every delay honored by WithRetryAfter or WithRetryAfterFunc at d, so that a buggy or
+// malicious server cannot stall requests for an arbitrary time. It defaults to DefaultMaxRetryAfter; a negative d
+// lifts the cap, leaving delays bounded by the deadline of the request context only.
+func WithMaxRetryAfter(d time.Duration) Option {
+	return func(p *RoundTripper) {
+		p.maxRetryAfter = d
+	}
+}
+
+// retryAfterCap returns the cap of the delays honored by Retry-After, or a negative duration if there is none.
+func (p *RoundTripper) retryAfterCap() time.Duration {
+	if p.maxRetryAfter == 0 {
+		return DefaultMaxRetryAfter
+	}
+	return p.maxRetryAfter
+}
+
+// WithRetryAfterJitter adds a random jitter of up to fraction of the delay to every delay honored by
+// WithRetryAfter or WithRetryAfterFunc, e.g. 0.2 for up to 20% more, so that rate-limited clients do not all retry
+// in a synchronized burst right when the window opens. The jitter never makes a request outlast the deadline of
+// its context; the plain delay is used instead.
+func WithRetryAfterJitter(fraction float64) Option {
+	return func(p *RoundTripper) {
+		p.retryAfterJitter = max(fraction, 0)
+	}
+}
+
+// ParseRetryAfter is the RetryAfterFunc used by WithRetryAfter. It returns the delay requested by the Retry-After
+// header of resp, given in seconds or as an HTTP date. Negative delays and dates in the past yield zero, and delays
+// too long to represent the longest time.Duration; malformed values are ignored.
+func ParseRetryAfter(resp *http.Response) (time.Duration, bool) {
+	if resp == nil {
+		return 0, false
+	}
+	v := resp.Header.Get("Retry-After")
+	if v == "" {
+		return 0, false
+	}
+	if seconds, err := strconv.ParseInt(v, 10, 64); err == nil || errors.Is(err, strconv.ErrRange) {
+		// Negative delays are clamped to zero, and delays too long to represent to the longest one.
+		if seconds < 0 {
+			return 0, true
+		}
+		if seconds > int64(math.MaxInt64/time.Second) {
+			return math.MaxInt64, true
+		}
+		return time.Duration(seconds) * time.Second, true
+	}
+	if t, err := http.ParseTime(v); err == nil {
+		return max(time.Until(t), 0), true
+	}
+	return 0, false
+}
+
+// Retry503WithRetryAfter returns a ShouldRetryFunc that retries 503 Service Unavailable responses only if they
+// carry a Retry-After header that ParseRetryAfter accepts, the sign of a temporary condition, so that a 503
+// without guidance, which may be a hard outage, fails fast. It retries nothing else. DefaultShouldRetry retries
+// every 503, so combine it with other predicates instead, e.g. AnyOf(Retry503WithRetryAfter(),
+// RetryOnConnectError()), and with WithRetryAfter so that the retry waits for the requested delay.
+func Retry503WithRetryAfter() ShouldRetryFunc {
+	return retry503WithRetryAfter
+}
+
+// retry503WithRetryAfter implements Retry503WithRetryAfter.
+func retry503WithRetryAfter(req *http.Request, resp *http.Response, err error) bool {
+	if err != nil || resp == nil || resp.StatusCode != http.StatusServiceUnavailable {
+		return false
+	}
+	_, ok := ParseRetryAfter(resp)
+	return ok
+}
+
+// retryAfterBackOff replaces the wrapped backoff delay by the delay requested by the latest response.
+type retryAfterBackOff struct {
+	backoff.BackOff
+	retryAfterFunc RetryAfterFunc
+	jitter         float64
+	maxRetryAfter  time.Duration
+	state          *retryState
+}
+
+// NextBackOff returns the delay requested by the latest response if there is one, or the wrapped backoff delay
+// otherwise. It stops if the requested delay would outlast the deadline of the request context.
+func (b *retryAfterBackOff) NextBackOff() time.Duration {
+	next := b.BackOff.NextBackOff()
+	if next == backoff.Stop {
+		return next
+	}
+	if b.state.resp == nil {
+		return next
+	}
+	retryAfter, ok := b.retryAfterFunc(b.state.resp)
+	if !ok {
+		return next
+	}
+	retryAfter = max(retryAfter, 0)
+	if b.maxRetryAfter >= 0 {
+		retryAfter = min(retryAfter, b.maxRetryAfter)
+	}
+	jittered := retryAfter + time.Duration(rand.Float64()*b.jitter*float64(retryAfter))
+	if jittered < retryAfter {
+		// The jitter overflowed.
+		jittered = retryAfter
+	}
+	if deadline, ok := b.state.req.Context().Deadline(); ok {
+		remaining := time.Until(deadline)
+		if remaining < retryAfter {
+			b.state.stopErr = RetryAfterExceededBudgetError
+			return backoff.Stop
+		}
+		if remaining < jittered {
+			return retryAfter
+		}
+	}
+	return jittered
+}
@@ -0,0 +1,333 @@
+package retryabletransport_test
+
+import (
+	"context"
+	"io"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/linzhengen/retryabletransport"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_WithRetryAfter(t *testing.T) {
+	type test struct {
+		name       string
+		retryAfter string
+		opts       []retryabletransport.Option
+		wantDelay  time.Duration
+	}
+	tests := []test{
+		{
+			name:       "delay in seconds is honored",
+			retryAfter: "7",
+			wantDelay:  7 * time.Second,
+		},
+		{
+			name:       "HTTP date in the past retries immediately",
+			retryAfter: "Mon, 02 Jan 2006 15:04:05 GMT",
+			wantDelay:  0,
+		},
+		{
+			name:       "negative delay retries immediately",
+			retryAfter: "-5",
+			wantDelay:  0,
+		},
+		{
+			name:       "overflowing delay is clamped to the longest duration without a cap",
+			retryAfter: "99999999999",
+			opts:       []retryabletransport.Option{retryabletransport.WithMaxRetryAfter(-1)},
+			wantDelay:  math.MaxInt64,
+		},
+		{
+			name:       "delay out of the integer range is clamped to the longest duration without a cap",
+			retryAfter: "99999999999999999999999",
+			opts:       []retryabletransport.Option{retryabletransport.WithMaxRetryAfter(-1)},
+			wantDelay:  math.MaxInt64,
+		},
+		{
+			name:       "overflowing delay is capped by DefaultMaxRetryAfter",
+			retryAfter: "99999999999",
+			wantDelay:  retryabletransport.DefaultMaxRetryAfter,
+		},
+		{
+			name:       "overflowing delay is capped by WithMaxRetryAfter",
+			retryAfter: "99999999999",
+			opts:       []retryabletransport.Option{retryabletransport.WithMaxRetryAfter(time.Minute)},
+			wantDelay:  time.Minute,
+		},
+		{
+			name:       "delay within WithMaxRetryAfter is honored",
+			retryAfter: "7",
+			opts:       []retryabletransport.Option{retryabletransport.WithMaxRetryAfter(time.Minute)},
+			wantDelay:  7 * time.Second,
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			resp := &http.Response{StatusCode: http.StatusTooManyRequests, Header: http.Header{}}
+			resp.Header.Set("Retry-After", tc.retryAfter)
+			opts := append([]retryabletransport.Option{retryabletransport.WithRetryAfter()}, tc.opts...)
+			assert.Equal(t, tc.wantDelay, firstRetryDelay(t, resp, opts...))
+		})
+	}
+	t.Run("malformed delay uses the backoff delay", func(t *testing.T) {
+		resp := &http.Response{StatusCode: http.StatusTooManyRequests, Header: http.Header{}}
+		resp.Header.Set("Retry-After", "garbage")
+		delay := firstRetryDelay(t, resp, retryabletransport.WithRetryAfter())
+		// The default initial interval of 500ms with a randomization factor of 0.5.
+		assert.GreaterOrEqual(t, delay, 250*time.Millisecond)
+		assert.LessOrEqual(t, delay, 750*time.Millisecond)
+	})
+	t.Run("negative custom delay retries immediately", func(t *testing.T) {
+		resp := &http.Response{StatusCode: http.StatusTooManyRequests}
+		delay := firstRetryDelay(t, resp, retryabletransport.WithRetryAfterFunc(func(resp *http.Response) (time.Duration, bool) {
+			return -time.Second, true
+		}))
+		assert.Equal(t, time.Duration(0), delay)
+	})
+}
+
+func Test_WithRetryAfter_ExceedsContextBudget(t *testing.T) {
+	calledCount := 0
+	body := &trackingBody{r: strings.NewReader("too many requests")}
+	rt := retryabletransport.New(
+		roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+			calledCount++
+			resp := &http.Response{StatusCode: http.StatusTooManyRequests, Header: http.Header{}, Body: body}
+			resp.Header.Set("Retry-After", "10")
+			return resp, nil
+		}),
+		nil,
+		nil,
+		&retryabletransport.BackOffPolicy{MaxRetries: 3},
+		retryabletransport.WithRetryAfter(),
+	)
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, "http://example.com", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	start := time.Now()
+	resp, err := rt.RoundTrip(req)
+	assert.Less(t, time.Since(start), 500*time.Millisecond)
+	assert.ErrorIs(t, err, retryabletransport.RetryAfterExceededBudgetError)
+	assert.ErrorIs(t, err, retryabletransport.ShouldRetryRespError)
+	assert.Nil(t, resp, "a response returned along with an error would never be closed by an *http.Client")
+	assert.True(t, body.closed, "the last response must be closed")
+	assert.Equal(t, 1, calledCount)
+}
+
+func Test_WithRetryAfter_MaxRetries(t *testing.T) {
+	calledCount := 0
+	var waits []time.Duration
+	rt := retryabletransport.New(
+		roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+			calledCount++
+			return &http.Response{
+				StatusCode: http.StatusTooManyRequests,
+				Header:     http.Header{"Retry-After": {strconv.Itoa(calledCount)}},
+				Body:       io.NopCloser(strings.NewReader("attempt " + strconv.Itoa(calledCount))),
+			}, nil
+		}),
+		nil,
+		nil,
+		&retryabletransport.BackOffPolicy{MaxRetries: 2},
+		retryabletransport.WithRetryAfter(),
+		retryabletransport.WithAfter(func(d time.Duration) <-chan time.Time {
+			waits = append(waits, d)
+			c := make(chan time.Time, 1)
+			c <- time.Now()
+			return c
+		}),
+	)
+	req, err := http.NewRequest(http.MethodGet, "http://example.com", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := rt.RoundTrip(req)
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer resp.Body.Close()
+	assert.Equal(t, 3, calledCount)
+	assert.Equal(t, []time.Duration{time.Second, 2 * time.Second}, waits)
+	assert.Equal(t, http.StatusTooManyRequests, resp.StatusCode)
+	assert.Equal(t, "3", resp.Header.Get("Retry-After"))
+	body, err := io.ReadAll(resp.Body)
+	assert.NoError(t, err)
+	assert.Equal(t, "attempt 3", string(body))
+}
+
+func Test_WithRetryAfterFunc(t *testing.T) {
+	retryInMs := func(resp *http.Response) (time.Duration, bool) {
+		ms, err := strconv.Atoi(resp.Header.Get("Retry-In-Ms"))
+		if err != nil {
+			return 0, false
+		}
+		return time.Duration(ms) * time.Millisecond, true
+	}
+	rateLimitReset := func(resp *http.Response) (time.Duration, bool) {
+		reset, err := strconv.ParseInt(resp.Header.Get("X-RateLimit-Reset"), 10, 64)
+		if err != nil {
+			return 0, false
+		}
+		return time.Until(time.Unix(reset, 0)), true
+	}
+	type test struct {
+		name           string
+		retryAfterFunc retryabletransport.RetryAfterFunc
+		header         string
+		value          string
+		minDelay       time.Duration
+		maxDelay       time.Duration
+	}
+	tests := []test{
+		{
+			name:           "milliseconds header",
+			retryAfterFunc: retryInMs,
+			header:         "Retry-In-Ms",
+			value:          "1500",
+			minDelay:       1500 * time.Millisecond,
+			maxDelay:       1500 * time.Millisecond,
+		},
+		{
+			name:           "unix timestamp header",
+			retryAfterFunc: rateLimitReset,
+			header:         "X-RateLimit-Reset",
+			value:          strconv.FormatInt(time.Now().Add(30*time.Second).Unix(), 10),
+			minDelay:       28 * time.Second,
+			maxDelay:       30 * time.Second,
+		},
+		{
+			name:           "falls back to backoff without the header",
+			retryAfterFunc: retryInMs,
+			minDelay:       250 * time.Millisecond,
+			maxDelay:       750 * time.Millisecond,
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			resp := &http.Response{StatusCode: http.StatusTooManyRequests, Header: http.Header{}}
+			if tc.header != "" {
+				resp.Header.Set(tc.header, tc.value)
+			}
+			delay := firstRetryDelay(t, resp, retryabletransport.WithRetryAfterFunc(tc.retryAfterFunc))
+			assert.GreaterOrEqual(t, delay, tc.minDelay)
+			assert.LessOrEqual(t, delay, tc.maxDelay)
+		})
+	}
+}
+
+func Test_WithRetryAfterJitter(t *testing.T) {
+	resp := &http.Response{StatusCode: http.StatusTooManyRequests, Header: http.Header{}}
+	resp.Header.Set("Retry-After", "10")
+	seen := map[time.Duration]bool{}
+	for i := 0; i < 20; i++ {
+		delay := firstRetryDelay(t, resp, retryabletransport.WithRetryAfter(), retryabletransport.WithRetryAfterJitter(0.2))
+		assert.GreaterOrEqual(t, delay, 10*time.Second)
+		assert.LessOrEqual(t, delay, 12*time.Second)
+		seen[delay] = true
+	}
+	assert.Greater(t, len(seen), 1, "delays must be jittered")
+
+	t.Run("jitter does not outlast the context deadline", func(t *testing.T) {
+		var delay time.Duration
+		rt := retryabletransport.New(
+			roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+				return resp, nil
+			}),
+			nil,
+			func(ctx context.Context, err error, duration time.Duration) {
+				delay = duration
+			},
+			&retryabletransport.BackOffPolicy{MaxRetries: 1},
+			retryabletransport.WithRetryAfterFunc(func(resp *http.Response) (time.Duration, bool) {
+				return 10 * time.Millisecond, true
+			}),
+			retryabletransport.WithRetryAfterJitter(1000),
+		)
+		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+		defer cancel()
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, "http://example.com", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, _ = rt.RoundTrip(req)
+		assert.Equal(t, 10*time.Millisecond, delay)
+	})
+}
+
+func Test_Retry503WithRetryAfter(t *testing.T) {
+	type test struct {
+		name       string
+		statusCode int
+		retryAfter string
+		want       bool
+	}
+	tests := []test{
+		{name: "503 with delay in seconds", statusCode: http.StatusServiceUnavailable, retryAfter: "3", want: true},
+		{name: "503 with HTTP date", statusCode: http.StatusServiceUnavailable, retryAfter: "Mon, 02 Jan 2006 15:04:05 GMT", want: true},
+		{name: "503 without Retry-After", statusCode: http.StatusServiceUnavailable},
+		{name: "503 with malformed Retry-After", statusCode: http.StatusServiceUnavailable, retryAfter: "soon"},
+		{name: "429 with Retry-After", statusCode: http.StatusTooManyRequests, retryAfter: "3"},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			req, err := http.NewRequest(http.MethodGet, "http://example.com", nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			resp := &http.Response{StatusCode: tc.statusCode, Header: http.Header{}}
+			if tc.retryAfter != "" {
+				resp.Header.Set("Retry-After", tc.retryAfter)
+			}
+			assert.Equal(t, tc.want, retryabletransport.Retry503WithRetryAfter()(req, resp, nil))
+		})
+	}
+
+	t.Run("waits for the requested delay", func(t *testing.T) {
+		for retryAfter, wantWaits := range map[string][]time.Duration{"3": {3 * time.Second}, "": nil} {
+			attempts := 0
+			var waits []time.Duration
+			rt := retryabletransport.New(
+				roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+					attempts++
+					if attempts == 1 {
+						return &http.Response{StatusCode: http.StatusServiceUnavailable, Header: http.Header{"Retry-After": {retryAfter}}, Body: http.NoBody}, nil
+					}
+					return &http.Response{StatusCode: http.StatusOK, Body: http.NoBody}, nil
+				}),
+				retryabletransport.Retry503WithRetryAfter(),
+				nil,
+				&retryabletransport.BackOffPolicy{MaxRetries: 3},
+				retryabletransport.WithRetryAfter(),
+				retryabletransport.WithAfter(func(d time.Duration) <-chan time.Time {
+					waits = append(waits, d)
+					c := make(chan time.Time, 1)
+					c <- time.Now()
+					return c
+				}),
+			)
+			req, err := http.NewRequest(http.MethodGet, "http://example.com", nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			resp, err := rt.RoundTrip(req)
+			assert.NoError(t, err)
+			assert.Equal(t, wantWaits, waits, retryAfter)
+			if retryAfter == "" {
+				assert.Equal(t, http.StatusServiceUnavailable, resp.StatusCode)
+				assert.Equal(t, 1, attempts)
+			} else {
+				assert.Equal(t, http.StatusOK, resp.StatusCode)
+				assert.Equal(t, 2, attempts)
+			}
+		}
+	})
+}
@@ -0,0 +1,102 @@
+package retrytest
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// FakeClock is a virtual clock for testing retry flows without real sleeps. Pass its After method to
+// retryabletransport.WithAfter so that the waits between attempts wait on the clock instead of the system clock.
+// Waits end when Advance moves the clock past them or, if auto-advance is on, immediately, with the clock
+// advanced by the wait, so that multi-retry flows run instantly and the clock still accounts for their delays.
+// It is safe for concurrent use.
+type FakeClock struct {
+	mu          sync.Mutex
+	now         time.Time
+	autoAdvance bool
+	waiters     []waiter
+	waits       []time.Duration
+}
+
+// waiter is a pending wait on a FakeClock.
+type waiter struct {
+	until time.Time
+	c     chan time.Time
+}
+
+// NewFakeClock creates a new FakeClock set to now.
+func NewFakeClock(now time.Time) *FakeClock {
+	return &FakeClock{now: now}
+}
+
+// SetAutoAdvance sets whether every wait on the clock advances it by the waited duration and ends immediately,
+// instead of waiting for Advance.
+func (c *FakeClock) SetAutoAdvance(autoAdvance bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.autoAdvance = autoAdvance
+}
+
+// Now returns the current time of the clock.
+func (c *FakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+// After waits for d to elapse on the clock and then sends the current time of the clock on the returned
+// channel. It is a retryabletransport.AfterFunc.
+func (c *FakeClock) After(d time.Duration) <-chan time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.waits = append(c.waits, d)
+	ch := make(chan time.Time, 1)
+	if c.autoAdvance && d > 0 {
+		c.advance(d)
+	}
+	if d <= 0 || c.autoAdvance {
+		ch <- c.now
+		return ch
+	}
+	c.waiters = append(c.waiters, waiter{until: c.now.Add(d), c: ch})
+	return ch
+}
+
+// Advance moves the clock forward by d, ending the waits that elapse on the way.
+func (c *FakeClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.advance(d)
+}
+
+// advance moves the clock forward by d and ends the elapsed waits, in the order they elapse.
+func (c *FakeClock) advance(d time.Duration) {
+	c.now = c.now.Add(d)
+	sort.SliceStable(c.waiters, func(i, j int) bool {
+		return c.waiters[i].until.Before(c.waiters[j].until)
+	})
+	n := 0
+	for _, w := range c.waiters {
+		if w.until.After(c.now) {
+			break
+		}
+		w.c <- c.now
+		n++
+	}
+	c.waiters = c.waiters[n:]
+}
+
+// Waiters returns the number of pending waits, e.g. to make sure that a retry is waiting before calling Advance.
+func (c *FakeClock) Waiters() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.waiters)
+}
+
+// Waits returns the durations of all waits on the clock so far, in the order they started.
+func (c *FakeClock) Waits() []time.Duration {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([]time.Duration(nil), c.waits...)
+}
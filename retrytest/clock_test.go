@@ -0,0 +1,109 @@
+package retrytest_test
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/linzhengen/retryabletransport"
+	"github.com/linzhengen/retryabletransport/retrytest"
+	"github.com/stretchr/testify/assert"
+)
+
+func ExampleFakeClock() {
+	clock := retrytest.NewFakeClock(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC))
+	clock.SetAutoAdvance(true)
+	attempts := 0
+	rt := retryabletransport.New(
+		roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+			attempts++
+			if attempts <= 5 {
+				return &http.Response{StatusCode: http.StatusServiceUnavailable, Body: http.NoBody}, nil
+			}
+			return &http.Response{StatusCode: http.StatusOK, Body: http.NoBody}, nil
+		}),
+		nil,
+		nil,
+		&retryabletransport.BackOffPolicy{MaxRetries: 5, InitialInterval: time.Second, Multiplier: 2, RandomizationFactor: -1},
+		retryabletransport.WithAfter(clock.After),
+	)
+	req, _ := http.NewRequest(http.MethodGet, "http://example.com", nil)
+	start := time.Now()
+	resp, err := rt.RoundTrip(req)
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	defer resp.Body.Close()
+
+	fmt.Println("status:", resp.StatusCode, "attempts:", attempts)
+	fmt.Println("waits:", clock.Waits())
+	fmt.Println("virtual time:", clock.Now().Format(time.TimeOnly))
+	fmt.Println("under a second:", time.Since(start) < time.Second)
+	// Output:
+	// status: 200 attempts: 6
+	// waits: [1s 2s 4s 8s 16s]
+	// virtual time: 00:00:31
+	// under a second: true
+}
+
+func Test_FakeClock_Advance(t *testing.T) {
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	clock := retrytest.NewFakeClock(start)
+	later := clock.After(2 * time.Second)
+	sooner := clock.After(time.Second)
+	assert.Equal(t, 2, clock.Waiters())
+
+	clock.Advance(500 * time.Millisecond)
+	assert.Len(t, sooner, 0)
+	assert.Len(t, later, 0)
+
+	clock.Advance(500 * time.Millisecond)
+	assert.Equal(t, start.Add(time.Second), <-sooner)
+	assert.Len(t, later, 0)
+	assert.Equal(t, 1, clock.Waiters())
+
+	clock.Advance(5 * time.Second)
+	assert.Equal(t, start.Add(6*time.Second), <-later)
+	assert.Equal(t, 0, clock.Waiters())
+
+	assert.Equal(t, start.Add(6*time.Second), <-clock.After(0))
+	assert.Equal(t, []time.Duration{2 * time.Second, time.Second, 0}, clock.Waits())
+}
+
+func Test_FakeClock_RoundTrip(t *testing.T) {
+	clock := retrytest.NewFakeClock(time.Unix(0, 0))
+	attempts := make(chan struct{}, 3)
+	rt := retryabletransport.New(
+		roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+			attempts <- struct{}{}
+			return &http.Response{StatusCode: http.StatusServiceUnavailable, Body: http.NoBody}, nil
+		}),
+		nil,
+		nil,
+		&retryabletransport.BackOffPolicy{MaxRetries: 2, InitialInterval: time.Minute, RandomizationFactor: -1},
+		retryabletransport.WithAfter(clock.After),
+	)
+	done := make(chan *http.Response)
+	go func() {
+		req, _ := http.NewRequest(http.MethodGet, "http://example.com", nil)
+		resp, _ := rt.RoundTrip(req)
+		done <- resp
+	}()
+	for i := 0; i < 2; i++ {
+		<-attempts
+		assert.Eventually(t, func() bool { return clock.Waiters() == 1 }, time.Second, time.Millisecond)
+		assert.Len(t, attempts, 0)
+		clock.Advance(time.Hour)
+	}
+	resp := <-done
+	assert.Equal(t, http.StatusServiceUnavailable, resp.StatusCode)
+	assert.Len(t, attempts, 1)
+}
+
+type roundTripperFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripperFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
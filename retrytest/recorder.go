@@ -0,0 +1,73 @@
+// Package retrytest provides utilities for testing code that uses retryabletransport.
+package retrytest
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"sync"
+)
+
+// RecordingRoundTripper is an http.RoundTripper that records every request passing through it before
+// forwarding it to the wrapped transport. Placed between a retryabletransport.RoundTripper and the network,
+// it sees every attempt, so tests can assert retry counts and per-attempt headers and bodies.
+// It is safe for concurrent use.
+type RecordingRoundTripper struct {
+	roundTripper http.RoundTripper
+
+	mu       sync.Mutex
+	requests []*http.Request
+}
+
+// NewRecordingRoundTripper creates a new RecordingRoundTripper forwarding to roundTripper.
+// If roundTripper is nil, http.DefaultTransport is used.
+func NewRecordingRoundTripper(roundTripper http.RoundTripper) *RecordingRoundTripper {
+	if roundTripper == nil {
+		roundTripper = http.DefaultTransport
+	}
+	return &RecordingRoundTripper{roundTripper: roundTripper}
+}
+
+// RoundTrip records a copy of req, including its body, and forwards req to the wrapped transport.
+func (r *RecordingRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	recorded := req.Clone(req.Context())
+	if req.Body != nil && req.Body != http.NoBody {
+		b, err := io.ReadAll(req.Body)
+		if err != nil {
+			return nil, err
+		}
+		if err := req.Body.Close(); err != nil {
+			return nil, err
+		}
+		req.Body = io.NopCloser(bytes.NewReader(b))
+		recorded.Body = io.NopCloser(bytes.NewReader(b))
+		recorded.GetBody = func() (io.ReadCloser, error) {
+			return io.NopCloser(bytes.NewReader(b)), nil
+		}
+	}
+	r.mu.Lock()
+	r.requests = append(r.requests, recorded)
+	r.mu.Unlock()
+	return r.roundTripper.RoundTrip(req)
+}
+
+// AttemptCount returns the number of requests recorded so far.
+func (r *RecordingRoundTripper) AttemptCount() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return len(r.requests)
+}
+
+// Requests returns the requests recorded so far, in the order they were sent.
+func (r *RecordingRoundTripper) Requests() []*http.Request {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]*http.Request(nil), r.requests...)
+}
+
+// Reset discards the recorded requests.
+func (r *RecordingRoundTripper) Reset() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.requests = nil
+}
@@ -0,0 +1,44 @@
+package retrytest_test
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+
+	"github.com/linzhengen/retryabletransport"
+	"github.com/linzhengen/retryabletransport/retrytest"
+)
+
+func ExampleRecordingRoundTripper() {
+	var calledCount atomic.Int64
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if calledCount.Add(1) == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer server.Close()
+
+	recorder := retrytest.NewRecordingRoundTripper(nil)
+	client := &http.Client{
+		Transport: retryabletransport.New(recorder, nil, nil, nil, retryabletransport.WithAttemptHeader("", true)),
+	}
+	resp, err := client.Post(server.URL, "text/plain", strings.NewReader("payload"))
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	defer resp.Body.Close()
+
+	fmt.Println("attempts:", recorder.AttemptCount())
+	for _, req := range recorder.Requests() {
+		body, _ := io.ReadAll(req.Body)
+		fmt.Println(req.Header.Get(retryabletransport.DefaultAttemptHeader), string(body))
+	}
+	// Output:
+	// attempts: 2
+	// 0 payload
+	// 1 payload
+}
@@ -0,0 +1,92 @@
+package retryabletransport
+
+import (
+	"net/http"
+	"regexp"
+	"strings"
+)
+
+// RoutePolicy is a backoff policy that applies to the requests matching a host and a path.
+// An empty Host matches any host, and a route without PathPrefix and PathRegexp matches any path.
+type RoutePolicy struct {
+	// Host matches the host of the request URL case-insensitively, with or without its port.
+	Host string
+	// PathPrefix matches request URL paths starting with it.
+	PathPrefix string
+	// PathRegexp matches request URL paths it matches. If both PathPrefix and PathRegexp are set, a path
+	// has to match both.
+	PathRegexp *regexp.Regexp
+	// Policy is the backoff policy of the matching requests. A nil Policy applies the default policy.
+	Policy *BackOffPolicy
+}
+
+// WithRoutePolicies applies the backoff policy of the most specific matching route to each request, so that
+// endpoints of mixed reliability on the same service get their own retry caps and delays. A route matching
+// the path takes precedence over a route matching the host only, which takes precedence over the policy of
+// the RoundTripper. Among the routes matching the path, those that also match the host take precedence,
+// then those with the longest PathPrefix, then those given first.
+func WithRoutePolicies(routes ...RoutePolicy) Option {
+	return func(p *RoundTripper) {
+		p.routePolicies = routes
+	}
+}
+
+// policyFor returns the backoff policy that applies to req.
+func (p *RoundTripper) policyFor(req *http.Request) *BackOffPolicy {
+	var best *RoutePolicy
+	for i := range p.routePolicies {
+		r := &p.routePolicies[i]
+		if r.matches(req) && (best == nil || r.moreSpecific(best)) {
+			best = r
+		}
+	}
+	if best == nil || best.Policy == nil {
+		return p.backOffPolicy
+	}
+	return best.Policy
+}
+
+// matches reports whether the route applies to req.
+func (r *RoutePolicy) matches(req *http.Request) bool {
+	if r.Host != "" && !strings.EqualFold(r.Host, req.URL.Host) && !strings.EqualFold(r.Host, req.URL.Hostname()) {
+		return false
+	}
+	path := req.URL.Path
+	if !strings.HasPrefix(path, r.PathPrefix) {
+		return false
+	}
+	return r.PathRegexp == nil || r.PathRegexp.MatchString(path)
+}
+
+// moreSpecific reports whether the route takes precedence over other, given that both match.
+func (r *RoutePolicy) moreSpecific(other *RoutePolicy) bool {
+	if r.matchesPath() != other.matchesPath() {
+		return r.matchesPath()
+	}
+	if (r.Host != "") != (other.Host != "") {
+		return r.Host != ""
+	}
+	return len(r.PathPrefix) > len(other.PathPrefix)
+}
+
+// matchesPath reports whether the route restricts the path.
+func (r *RoutePolicy) matchesPath() bool {
+	return r.PathPrefix != "" || r.PathRegexp != nil
+}
+
+// routePoliciesConfig returns a copy of the route policies with their defaults applied.
+func (p *RoundTripper) routePoliciesConfig() []RoutePolicy {
+	if len(p.routePolicies) == 0 {
+		return nil
+	}
+	routes := make([]RoutePolicy, len(p.routePolicies))
+	for i, r := range p.routePolicies {
+		policy := p.backOffPolicy.resolve()
+		if r.Policy != nil {
+			policy = r.Policy.resolve()
+		}
+		r.Policy = &policy
+		routes[i] = r
+	}
+	return routes
+}
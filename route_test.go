@@ -0,0 +1,77 @@
+package retryabletransport_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"regexp"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/linzhengen/retryabletransport"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_WithRoutePolicies(t *testing.T) {
+	policy := func(maxRetries uint64) *retryabletransport.BackOffPolicy {
+		return &retryabletransport.BackOffPolicy{MaxRetries: maxRetries, InitialInterval: time.Millisecond}
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+	serverURL, err := url.Parse(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	routes := []retryabletransport.RoutePolicy{
+		{Host: serverURL.Hostname(), Policy: policy(1)},
+		{PathPrefix: "/search", Policy: policy(2)},
+		{PathPrefix: "/search/slow", Policy: policy(3)},
+		{Host: serverURL.Host, PathPrefix: "/search", Policy: policy(4)},
+		{PathRegexp: regexp.MustCompile(`^/health$`), Policy: policy(0)},
+		{Host: "other.example.com", PathPrefix: "/", Policy: policy(5)},
+		{PathPrefix: "/default"},
+	}
+	type test struct {
+		name         string
+		routes       []retryabletransport.RoutePolicy
+		path         string
+		wantAttempts int32
+	}
+	tests := []test{
+		{name: "no routes apply the default policy", path: "/search", wantAttempts: 3},
+		{name: "host route", routes: routes, path: "/users", wantAttempts: 2},
+		{name: "path route over host route", routes: routes[:3], path: "/search/fast", wantAttempts: 3},
+		{name: "longest path prefix", routes: routes[:3], path: "/search/slow", wantAttempts: 4},
+		{name: "path and host route over path route", routes: routes, path: "/search/slow", wantAttempts: 5},
+		{name: "path regexp", routes: routes, path: "/health", wantAttempts: 1},
+		{name: "path regexp mismatch", routes: routes, path: "/healthz", wantAttempts: 2},
+		{name: "route with nil policy applies the default policy", routes: routes, path: "/default", wantAttempts: 3},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			var attempts atomic.Int32
+			rt := retryabletransport.New(
+				roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+					attempts.Add(1)
+					return http.DefaultTransport.RoundTrip(req)
+				}),
+				nil,
+				nil,
+				policy(2),
+				retryabletransport.WithRoutePolicies(tc.routes...),
+			)
+			req, err := http.NewRequest(http.MethodGet, server.URL+tc.path, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			resp, err := rt.RoundTrip(req)
+			if assert.NoError(t, err) {
+				resp.Body.Close()
+			}
+			assert.Equal(t, tc.wantAttempts, attempts.Load())
+		})
+	}
+}
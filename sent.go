@@ -0,0 +1,39 @@
+package retryabletransport
+
+import (
+	"net/http"
+	"net/http/httptrace"
+	"sync/atomic"
+)
+
+// AllowRetryAfterSent lets shouldRetryFunc retry non-idempotent requests that failed after their headers were
+// written to the connection. By default such requests are never retried, since the server may already have
+// processed them; RFC 9110 forbids retrying them automatically.
+func AllowRetryAfterSent() Option {
+	return func(p *RoundTripper) {
+		p.allowRetryAfterSent = true
+	}
+}
+
+// attemptTrace records how far an attempt got, as reported by the net/http/httptrace hooks.
+type attemptTrace struct {
+	// sent is set once the headers of the request have been written to the connection.
+	sent atomic.Bool
+	// reusedIdle is set if the attempt was sent on a kept-alive connection taken from the idle pool.
+	reusedIdle atomic.Bool
+}
+
+// traceAttempt returns a copy of req that records its progress in trace.
+// Detection relies on the net/http/httptrace hooks, so it only works for transports that call them,
+// such as *http.Transport. Requests sent through other transports are never reported as sent.
+func traceAttempt(req *http.Request, trace *attemptTrace) *http.Request {
+	clientTrace := &httptrace.ClientTrace{
+		GotConn: func(info httptrace.GotConnInfo) {
+			trace.reusedIdle.Store(info.Reused && info.WasIdle)
+		},
+		WroteHeaders: func() {
+			trace.sent.Store(true)
+		},
+	}
+	return req.WithContext(httptrace.WithClientTrace(req.Context(), clientTrace))
+}
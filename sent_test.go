@@ -0,0 +1,86 @@
+package retryabletransport_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/linzhengen/retryabletransport"
+	"github.com/linzhengen/retryabletransport/retrytest"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_RoundTripper_RoundTrip_SentRequestIsNotRetried(t *testing.T) {
+	var calledCount atomic.Int64
+	// The server reads the request and drops the connection without responding, as if it crashed mid-request.
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calledCount.Add(1)
+		conn, _, err := w.(http.Hijacker).Hijack()
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		_ = conn.Close()
+	}))
+	defer server.Close()
+	closedServer := httptest.NewServer(http.NotFoundHandler())
+	closedServer.Close()
+
+	type test struct {
+		name         string
+		method       string
+		url          string
+		opts         []retryabletransport.Option
+		wantAttempts int
+	}
+	tests := []test{
+		{
+			name:         "POST failing after it was sent is not retried",
+			method:       http.MethodPost,
+			url:          server.URL,
+			wantAttempts: 1,
+		},
+		{
+			name:         "GET failing after it was sent is retried",
+			method:       http.MethodGet,
+			url:          server.URL,
+			wantAttempts: 2,
+		},
+		{
+			name:         "POST failing after it was sent is retried with AllowRetryAfterSent",
+			method:       http.MethodPost,
+			url:          server.URL,
+			opts:         []retryabletransport.Option{retryabletransport.AllowRetryAfterSent()},
+			wantAttempts: 2,
+		},
+		{
+			name:         "POST failing before it was sent is retried",
+			method:       http.MethodPost,
+			url:          closedServer.URL,
+			wantAttempts: 2,
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			recorder := retrytest.NewRecordingRoundTripper(&http.Transport{})
+			rt := retryabletransport.New(
+				recorder,
+				func(req *http.Request, resp *http.Response, err error) bool {
+					return err != nil
+				},
+				nil,
+				&retryabletransport.BackOffPolicy{MaxRetries: 1},
+				tc.opts...,
+			)
+			req, err := http.NewRequest(tc.method, tc.url, strings.NewReader("payload"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			_, err = rt.RoundTrip(req)
+			assert.Error(t, err)
+			assert.Equal(t, tc.wantAttempts, recorder.AttemptCount())
+		})
+	}
+}
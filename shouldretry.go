@@ -0,0 +1,504 @@
+package retryabletransport
+
+import (
+	"compress/flate"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"mime"
+	"net"
+	"net/http"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+// DefaultShouldRetry is the ShouldRetryFunc used when none is provided.
+// It retries any request that failed to connect as matched by RetryOnConnectError, that lost a race with the
+// server closing an idle connection as matched by RetryOnIdleConnClosed, or that was answered with
+// 408 Request Timeout, 429 Too Many Requests, or 503 Service Unavailable, and idempotent requests, such as GET and
+// HEAD alike, that failed mid-flight as matched by RetryOnMidFlightError, that timed out as matched by
+// RetryOnTimeout, or that were answered with 502 Bad Gateway or 504 Gateway Timeout. It also retries the
+// nonstandard 52x statuses of CDNs as matched by RetryOnCDNError.
+func DefaultShouldRetry(req *http.Request, resp *http.Response, err error) bool {
+	if err != nil {
+		return retryOnConnectError(req, resp, err) || retryOnIdleConnClosed(req, resp, err) ||
+			retryOnMidFlightError(req, resp, err) ||
+			isIdempotent(req) && retryOnTimeout(req, resp, err)
+	}
+	if resp == nil {
+		return false
+	}
+	switch resp.StatusCode {
+	case http.StatusRequestTimeout, http.StatusTooManyRequests, http.StatusServiceUnavailable:
+		return true
+	case http.StatusBadGateway, http.StatusGatewayTimeout:
+		return isIdempotent(req)
+	}
+	return retryOnCDNError(req, resp, err)
+}
+
+// RetryOnConnectError returns a ShouldRetryFunc that retries attempts whose connection could not be established,
+// such as refused connections, dial timeouts, and temporary DNS failures. The request never reached the server,
+// so this is safe for all methods.
+//
+// Connect errors are told apart by the "dial" operation of the *net.OpError reported by *http.Transport.
+// Failures while tunneling through a proxy or during the TLS handshake are not reported that way and are
+// therefore not matched, even though the request was not sent yet either.
+func RetryOnConnectError() ShouldRetryFunc {
+	return retryOnConnectError
+}
+
+// retryOnConnectError implements RetryOnConnectError.
+func retryOnConnectError(req *http.Request, resp *http.Response, err error) bool {
+	return err != nil && req.Context().Err() == nil && isConnectError(err)
+}
+
+// errServerClosedIdleMessage is the message of the unexported error *http.Transport reports when the server closed
+// a kept-alive connection while it was idle.
+const errServerClosedIdleMessage = "http: server closed idle connection"
+
+// IdleConnClosedError is returned when a non-idempotent request was about to be sent on a kept-alive connection
+// reused from the idle pool and the connection was closed before the request was written, as happens when the
+// server closes the connection for being idle just as it is reused. Err is the error reported by the transport.
+type IdleConnClosedError struct {
+	Err error
+}
+
+func (e *IdleConnClosedError) Error() string {
+	return "server closed idle connection: " + e.Err.Error()
+}
+
+func (e *IdleConnClosedError) Unwrap() error {
+	return e.Err
+}
+
+// RetryOnIdleConnClosed returns a ShouldRetryFunc that retries attempts that lost the race between reusing an idle
+// keep-alive connection and the server closing it, which is reported either as "http: server closed idle
+// connection" by *http.Transport or as an IdleConnClosedError. The request of such an attempt never reached the
+// server, so this is safe for all methods. A non-idempotent request whose connection was closed after it was
+// written is not matched, since the server may have processed it before closing.
+//
+// *http.Transport retries this race itself for idempotent requests, so mostly non-idempotent requests are matched.
+// Detecting the race relies on the net/http/httptrace hooks, like AllowRetryAfterSent.
+func RetryOnIdleConnClosed() ShouldRetryFunc {
+	return retryOnIdleConnClosed
+}
+
+// retryOnIdleConnClosed implements RetryOnIdleConnClosed.
+func retryOnIdleConnClosed(req *http.Request, resp *http.Response, err error) bool {
+	return err != nil && req.Context().Err() == nil && isIdleConnClosed(err)
+}
+
+// isIdleConnClosed reports whether err indicates that the server closed the reused idle connection of an attempt.
+func isIdleConnClosed(err error) bool {
+	var idleErr *IdleConnClosedError
+	if errors.As(err, &idleErr) {
+		return true
+	}
+	for ; err != nil; err = errors.Unwrap(err) {
+		if err.Error() == errServerClosedIdleMessage {
+			return true
+		}
+	}
+	return false
+}
+
+// RetryOnMidFlightError returns a ShouldRetryFunc that retries idempotent requests whose established connection
+// broke, e.g. because it was reset or closed before the full response was received. The server may have processed
+// such a request, so non-idempotent requests are never matched.
+//
+// Whether a connection was established is inferred from the error, which cannot tell a connection that died right
+// after being established from one that died while the response was streamed. Connect errors as matched by
+// RetryOnConnectError are never considered mid-flight.
+func RetryOnMidFlightError() ShouldRetryFunc {
+	return retryOnMidFlightError
+}
+
+// retryOnMidFlightError implements RetryOnMidFlightError.
+func retryOnMidFlightError(req *http.Request, resp *http.Response, err error) bool {
+	if err == nil || !isIdempotent(req) || req.Context().Err() != nil || isConnectError(err) {
+		return false
+	}
+	return errors.Is(err, syscall.ECONNRESET) || errors.Is(err, syscall.EPIPE) ||
+		errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF)
+}
+
+// isConnectError reports whether err indicates that no connection could be established.
+func isConnectError(err error) bool {
+	if errors.Is(err, syscall.ECONNREFUSED) {
+		return true
+	}
+	var opErr *net.OpError
+	if errors.As(err, &opErr) && opErr.Op == "dial" {
+		return true
+	}
+	var dnsErr *net.DNSError
+	return errors.As(err, &dnsErr) && (dnsErr.IsTemporary || dnsErr.IsTimeout)
+}
+
+// ResponseBodyError is the error a wrapped transport that validates responses eagerly, by reading their body
+// before RoundTrip returns, reports when the body could not be read or is malformed. Err is the underlying error.
+type ResponseBodyError struct {
+	Err error
+}
+
+func (e *ResponseBodyError) Error() string {
+	return "read response body: " + e.Err.Error()
+}
+
+func (e *ResponseBodyError) Unwrap() error {
+	return e.Err
+}
+
+// RetryOnResponseBodyError returns a ShouldRetryFunc that retries idempotent requests whose wrapped transport failed
+// reading the response body before RoundTrip returned, as reported by a *ResponseBodyError or by a corrupt gzip or
+// flate stream, e.g. from a transport decompressing responses eagerly. The server processed such a request, so
+// non-idempotent requests are never matched.
+//
+// Like any error returned by the wrapped transport, such errors are passed to shouldRetryFunc along with the
+// response returned with them, if any. Errors reading resp.Body after RoundTrip returned reach only the caller
+// and are never retried.
+func RetryOnResponseBodyError() ShouldRetryFunc {
+	return retryOnResponseBodyError
+}
+
+// retryOnResponseBodyError implements RetryOnResponseBodyError.
+func retryOnResponseBodyError(req *http.Request, resp *http.Response, err error) bool {
+	if err == nil || !isIdempotent(req) || req.Context().Err() != nil {
+		return false
+	}
+	var bodyErr *ResponseBodyError
+	var corruptErr flate.CorruptInputError
+	return errors.As(err, &bodyErr) || errors.As(err, &corruptErr) ||
+		errors.Is(err, gzip.ErrChecksum) || errors.Is(err, gzip.ErrHeader)
+}
+
+// RetryOnTimeout returns a ShouldRetryFunc that retries attempts that failed with context.DeadlineExceeded or a
+// net.Error timeout, e.g. because a slow instance exceeded a per-attempt deadline. Once the deadline of the request
+// context itself has passed, a retry is bound to fail as well, so timeouts are not retried if the request context
+// is done. Timeouts may hit requests the server already processed; combine it with an idempotency check for
+// non-idempotent requests.
+func RetryOnTimeout() ShouldRetryFunc {
+	return retryOnTimeout
+}
+
+// retryOnTimeout implements RetryOnTimeout.
+func retryOnTimeout(req *http.Request, resp *http.Response, err error) bool {
+	if err == nil || req.Context().Err() != nil {
+		return false
+	}
+	if errors.Is(err, context.DeadlineExceeded) {
+		return true
+	}
+	var netErr net.Error
+	return errors.As(err, &netErr) && netErr.Timeout()
+}
+
+// isIdempotent reports whether repeating the request is safe, either because its method is idempotent
+// or because it carries an idempotency key.
+func isIdempotent(req *http.Request) bool {
+	switch req.Method {
+	case "", http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace, http.MethodPut, http.MethodDelete:
+		return true
+	}
+	return req.Header.Get("Idempotency-Key") != "" || req.Header.Get("X-Idempotency-Key") != ""
+}
+
+// DefaultRetryStatusCodes returns the status codes DefaultShouldRetry retries for any method: 408 Request Timeout,
+// 429 Too Many Requests, and 503 Service Unavailable. The server did not process requests answered with them, so
+// retrying is safe regardless of idempotency. Use it with RetryOnStatus to build predicates extending the list.
+func DefaultRetryStatusCodes() []int {
+	return []int{http.StatusRequestTimeout, http.StatusTooManyRequests, http.StatusServiceUnavailable}
+}
+
+// RetryOnStatus returns a ShouldRetryFunc that retries responses whose status code is one of codes, for any method.
+func RetryOnStatus(codes ...int) ShouldRetryFunc {
+	return func(req *http.Request, resp *http.Response, err error) bool {
+		return err == nil && resp != nil && slices.Contains(codes, resp.StatusCode)
+	}
+}
+
+// RetryWhen returns a ShouldRetryFunc that retries responses for which when returns true given the method of the
+// request and the status code of the response, for rules combining both, such as retrying 409 Conflict only for
+// PUT or 425 Too Early for any method. Errors are not retried.
+func RetryWhen(when func(method string, status int) bool) ShouldRetryFunc {
+	return func(req *http.Request, resp *http.Response, err error) bool {
+		return err == nil && resp != nil && when(req.Method, resp.StatusCode)
+	}
+}
+
+// RetryOnMethod returns a ShouldRetryFunc that retries anything for requests whose method is one of methods. It is
+// meant to restrict other predicates through AllOf, e.g. AllOf(RetryOnMethod(http.MethodPut),
+// RetryOnStatus(http.StatusConflict)) to retry 409 Conflict only for PUT.
+func RetryOnMethod(methods ...string) ShouldRetryFunc {
+	return func(req *http.Request, resp *http.Response, err error) bool {
+		return slices.Contains(methods, req.Method)
+	}
+}
+
+// proxyServers are the lowercased prefixes of the Server header of common reverse proxies and load balancers.
+var proxyServers = []string{"nginx", "envoy", "istio-envoy", "haproxy", "traefik", "caddy", "awselb", "cloudflare", "google frontend"}
+
+// RetryOnProxyError returns a ShouldRetryFunc that retries 502 Bad Gateway responses generated by a reverse proxy,
+// such as an nginx or envoy ingress, for any method, and other 502 Bad Gateway or 504 Gateway Timeout responses
+// for idempotent requests. A proxy answers 502 itself when the upstream briefly hiccupped, e.g. while a pod
+// restarts, which a retry often gets past; the upstream may have seen the request, so use it only where that is
+// acceptable. Responses generated by a proxy are told apart as matched by IsProxyResponse.
+func RetryOnProxyError() ShouldRetryFunc {
+	return retryOnProxyError
+}
+
+// retryOnProxyError implements RetryOnProxyError.
+func retryOnProxyError(req *http.Request, resp *http.Response, err error) bool {
+	if err != nil || resp == nil {
+		return false
+	}
+	switch resp.StatusCode {
+	case http.StatusBadGateway:
+		return isIdempotent(req) || IsProxyResponse(resp)
+	case http.StatusGatewayTimeout:
+		return isIdempotent(req)
+	}
+	return false
+}
+
+// Nonstandard statuses CDNs such as Cloudflare answer with when the origin behind them failed.
+const (
+	statusUnknownError        = 520
+	statusWebServerIsDown     = 521
+	statusConnectionTimedOut  = 522
+	statusOriginIsUnreachable = 523
+	statusATimeoutOccurred    = 524
+)
+
+// RetryOnCDNError returns a ShouldRetryFunc that retries the nonstandard 5xx statuses CDNs such as Cloudflare answer
+// with when the origin behind them failed transiently. 521 Web Server Is Down, 522 Connection Timed Out, and
+// 523 Origin Is Unreachable mean the CDN could not connect to the origin, so they are retried for any method;
+// 520 Unknown Error and 524 A Timeout Occurred come after the origin received the request and are retried for
+// idempotent requests only.
+func RetryOnCDNError() ShouldRetryFunc {
+	return retryOnCDNError
+}
+
+// retryOnCDNError implements RetryOnCDNError.
+func retryOnCDNError(req *http.Request, resp *http.Response, err error) bool {
+	if err != nil || resp == nil {
+		return false
+	}
+	switch resp.StatusCode {
+	case statusWebServerIsDown, statusConnectionTimedOut, statusOriginIsUnreachable:
+		return true
+	case statusUnknownError, statusATimeoutOccurred:
+		return isIdempotent(req)
+	}
+	return false
+}
+
+// IsProxyResponse reports whether resp was likely generated by a reverse proxy rather than forwarded from the
+// upstream behind it, judging by a Server header naming a common proxy, or by a Via header for proxies that record
+// themselves there. It cannot tell apart forwarded responses of an upstream that sets such headers itself.
+func IsProxyResponse(resp *http.Response) bool {
+	if resp.Header.Get("Via") != "" {
+		return true
+	}
+	server := strings.ToLower(resp.Header.Get("Server"))
+	for _, s := range proxyServers {
+		if strings.HasPrefix(server, s) {
+			return true
+		}
+	}
+	return false
+}
+
+// AnyOf returns a ShouldRetryFunc that retries what any of shouldRetryFuncs retries. They are called in order until
+// one retries, so cheaper predicates should come first. With no shouldRetryFuncs nothing is retried.
+func AnyOf(shouldRetryFuncs ...ShouldRetryFunc) ShouldRetryFunc {
+	return func(req *http.Request, resp *http.Response, err error) bool {
+		for _, shouldRetryFunc := range shouldRetryFuncs {
+			if shouldRetryFunc(req, resp, err) {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// AllOf returns a ShouldRetryFunc that retries what all of shouldRetryFuncs retry, e.g. to restrict a predicate
+// to some status codes with RetryOnStatus. They are called in order until one does not retry, so cheaper
+// predicates should come first. With no shouldRetryFuncs nothing is retried.
+func AllOf(shouldRetryFuncs ...ShouldRetryFunc) ShouldRetryFunc {
+	return func(req *http.Request, resp *http.Response, err error) bool {
+		for _, shouldRetryFunc := range shouldRetryFuncs {
+			if !shouldRetryFunc(req, resp, err) {
+				return false
+			}
+		}
+		return len(shouldRetryFuncs) > 0
+	}
+}
+
+// RetryOnUnexpectedContentType returns a ShouldRetryFunc that retries responses whose Content-Type is none of
+// expected, such as the HTML error page of a load balancer answering for a JSON API. Media types are compared
+// without their parameters and case-insensitively, and an expected "type/*" matches any subtype. Responses without
+// a Content-Type, e.g. with an empty body, are not retried. Combine it with RetryOnStatus through AllOf to retry
+// only responses with some status codes, and note that retrying 2xx responses requires AllowRetryOnSuccess.
+func RetryOnUnexpectedContentType(expected ...string) ShouldRetryFunc {
+	expectedTypes := make([]string, 0, len(expected))
+	for _, e := range expected {
+		if mediaType, _, err := mime.ParseMediaType(e); err == nil {
+			expectedTypes = append(expectedTypes, mediaType)
+		}
+	}
+	return func(req *http.Request, resp *http.Response, err error) bool {
+		if err != nil || resp == nil {
+			return false
+		}
+		contentType := resp.Header.Get("Content-Type")
+		if contentType == "" {
+			return false
+		}
+		mediaType, _, err := mime.ParseMediaType(contentType)
+		if err != nil {
+			return true
+		}
+		for _, e := range expectedTypes {
+			if e == mediaType || strings.HasSuffix(e, "/*") && strings.HasPrefix(mediaType, e[:len(e)-1]) {
+				return false
+			}
+		}
+		return true
+	}
+}
+
+// StopOnRepeatedFailure returns a ShouldRetryFunc that retries what shouldRetryFunc retries until the same failure
+// occurred n times in a row, since repeating a deterministic failure is futile. Failures are the same if they have
+// the same error message or, for responses, the same status code. The count is kept per request, so failures of
+// other requests, even concurrent ones through the same RoundTripper, never add to it.
+func StopOnRepeatedFailure(shouldRetryFunc ShouldRetryFunc, n int) ShouldRetryFunc {
+	type repeated struct {
+		failure string
+		count   int
+	}
+	key := new(repeated)
+	return func(req *http.Request, resp *http.Response, err error) bool {
+		if !shouldRetryFunc(req, resp, err) {
+			return false
+		}
+		r := predicateState(req, key, func() *repeated { return &repeated{} })
+		if r == nil {
+			return true
+		}
+		failure := ""
+		if err != nil {
+			failure = err.Error()
+		} else if resp != nil {
+			failure = "status " + strconv.Itoa(resp.StatusCode)
+		}
+		if failure == r.failure {
+			r.count++
+		} else {
+			r.failure, r.count = failure, 1
+		}
+		return r.count < n
+	}
+}
+
+// RetryOnEmptyBody returns a ShouldRetryFunc that retries 200 OK responses with an empty body, which some
+// misbehaving intermediaries return instead of an error. At most one byte of the body is buffered to tell, and
+// restored on resp so callers can still read it. Responses to HEAD requests are never matched. Empty bodies are
+// legitimate for many endpoints, so combine it with a check of the request, e.g. its path, and since successful
+// responses are not retried by default, the RoundTripper has to be created with AllowRetryOnSuccess.
+func RetryOnEmptyBody() ShouldRetryFunc {
+	return func(req *http.Request, resp *http.Response, err error) bool {
+		if err != nil || resp == nil || resp.StatusCode != http.StatusOK || req.Method == http.MethodHead {
+			return false
+		}
+		if resp.ContentLength == 0 {
+			return true
+		}
+		_, empty, err := peekResponseBody(resp, 0)
+		return err == nil && empty
+	}
+}
+
+// RetryOnGRPCStatus returns a ShouldRetryFunc that retries responses whose grpc-status matches one of codes,
+// e.g. 14 (UNAVAILABLE), for gRPC tunneled over HTTP. The status is read from the response header of
+// trailers-only responses and from the trailer otherwise. Reading the trailer requires the whole response
+// body to be buffered in memory, so responses larger than the inspection limit (see WithMaxInspectBodyBytes)
+// are not retried; the buffered body is restored on resp so callers can still read it.
+// gRPC reports failures with a 200 OK status, so the RoundTripper has to be created with AllowRetryOnSuccess.
+func RetryOnGRPCStatus(codes ...int) ShouldRetryFunc {
+	return func(req *http.Request, resp *http.Response, err error) bool {
+		if err != nil || resp == nil {
+			return false
+		}
+		status := resp.Header.Get("Grpc-Status")
+		if status == "" {
+			if _, complete, err := InspectResponseBody(req, resp); err != nil || !complete {
+				return false
+			}
+			status = resp.Trailer.Get("Grpc-Status")
+		}
+		code, err := strconv.Atoi(status)
+		if err != nil {
+			return false
+		}
+		for _, c := range codes {
+			if c == code {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// RetryOnJSONField returns a ShouldRetryFunc that retries responses whose JSON body holds wantValue at path,
+// a dotted path of object keys such as "error.retryable". The body is buffered for inspection up to the inspection
+// limit (see WithMaxInspectBodyBytes) and restored on resp so callers can still read it. Bodies that are larger,
+// are not JSON, or lack the field are not retried. Since successful responses are not retried by default,
+// inspecting 2xx bodies requires AllowRetryOnSuccess.
+func RetryOnJSONField(path string, wantValue any) ShouldRetryFunc {
+	want := normalizeJSONValue(wantValue)
+	keys := strings.Split(path, ".")
+	return func(req *http.Request, resp *http.Response, err error) bool {
+		if err != nil || resp == nil {
+			return false
+		}
+		b, complete, err := InspectResponseBody(req, resp)
+		if err != nil || !complete {
+			return false
+		}
+		var v any
+		if err := json.Unmarshal(b, &v); err != nil {
+			return false
+		}
+		for _, key := range keys {
+			obj, ok := v.(map[string]any)
+			if !ok {
+				return false
+			}
+			if v, ok = obj[key]; !ok {
+				return false
+			}
+		}
+		return reflect.DeepEqual(v, want)
+	}
+}
+
+// normalizeJSONValue converts v to the representation encoding/json decodes it to, e.g. int to float64.
+func normalizeJSONValue(v any) any {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return v
+	}
+	var n any
+	if err := json.Unmarshal(b, &n); err != nil {
+		return v
+	}
+	return n
+}
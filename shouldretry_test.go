@@ -0,0 +1,1060 @@
+package retryabletransport_test
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/http/httptrace"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/linzhengen/retryabletransport"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_DefaultShouldRetry(t *testing.T) {
+	type test struct {
+		name   string
+		method string
+		resp   *http.Response
+		err    error
+		want   bool
+	}
+	tests := []test{
+		{
+			name:   "connection refused is retried for POST",
+			method: http.MethodPost,
+			err:    fmt.Errorf("dial: %w", syscall.ECONNREFUSED),
+			want:   true,
+		},
+		{
+			name:   "connection reset is retried for GET",
+			method: http.MethodGet,
+			err:    syscall.ECONNRESET,
+			want:   true,
+		},
+		{
+			name:   "connection reset is not retried for POST",
+			method: http.MethodPost,
+			err:    syscall.ECONNRESET,
+			want:   false,
+		},
+		{
+			name:   "server closing a reused idle connection is retried for POST",
+			method: http.MethodPost,
+			err:    &url.Error{Op: "Post", URL: "http://example.com", Err: errors.New("http: server closed idle connection")},
+			want:   true,
+		},
+		{
+			name:   "EOF on a reused idle connection is retried for POST",
+			method: http.MethodPost,
+			err:    &retryabletransport.IdleConnClosedError{Err: io.EOF},
+			want:   true,
+		},
+		{
+			name:   "timeout is retried for GET",
+			method: http.MethodGet,
+			err:    context.DeadlineExceeded,
+			want:   true,
+		},
+		{
+			name:   "timeout is not retried for POST",
+			method: http.MethodPost,
+			err:    context.DeadlineExceeded,
+			want:   false,
+		},
+		{
+			name:   "429 is retried for POST",
+			method: http.MethodPost,
+			resp:   &http.Response{StatusCode: http.StatusTooManyRequests},
+			want:   true,
+		},
+		{
+			name:   "503 is retried for GET",
+			method: http.MethodGet,
+			resp:   &http.Response{StatusCode: http.StatusServiceUnavailable},
+			want:   true,
+		},
+		{
+			name:   "504 is retried for PUT",
+			method: http.MethodPut,
+			resp:   &http.Response{StatusCode: http.StatusGatewayTimeout},
+			want:   true,
+		},
+		{
+			name:   "504 is not retried for POST",
+			method: http.MethodPost,
+			resp:   &http.Response{StatusCode: http.StatusGatewayTimeout},
+			want:   false,
+		},
+		{
+			name:   "connection reset is retried for HEAD",
+			method: http.MethodHead,
+			err:    syscall.ECONNRESET,
+			want:   true,
+		},
+		{
+			name:   "timeout is retried for HEAD",
+			method: http.MethodHead,
+			err:    context.DeadlineExceeded,
+			want:   true,
+		},
+		{
+			name:   "503 is retried for HEAD",
+			method: http.MethodHead,
+			resp:   &http.Response{StatusCode: http.StatusServiceUnavailable},
+			want:   true,
+		},
+		{
+			name:   "504 is retried for HEAD",
+			method: http.MethodHead,
+			resp:   &http.Response{StatusCode: http.StatusGatewayTimeout},
+			want:   true,
+		},
+		{
+			name:   "404 is not retried for HEAD",
+			method: http.MethodHead,
+			resp:   &http.Response{StatusCode: http.StatusNotFound},
+			want:   false,
+		},
+		{
+			name:   "502 is retried for GET",
+			method: http.MethodGet,
+			resp:   &http.Response{StatusCode: http.StatusBadGateway},
+			want:   true,
+		},
+		{
+			name:   "502 is not retried for POST",
+			method: http.MethodPost,
+			resp:   &http.Response{StatusCode: http.StatusBadGateway},
+			want:   false,
+		},
+		{
+			name:   "408 is retried for POST",
+			method: http.MethodPost,
+			resp:   &http.Response{StatusCode: http.StatusRequestTimeout},
+			want:   true,
+		},
+		{
+			name:   "400 is not retried",
+			method: http.MethodGet,
+			resp:   &http.Response{StatusCode: http.StatusBadRequest},
+			want:   false,
+		},
+		{
+			name:   "500 is not retried",
+			method: http.MethodGet,
+			resp:   &http.Response{StatusCode: http.StatusInternalServerError},
+			want:   false,
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			req, err := http.NewRequest(tc.method, "http://example.com", nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			assert.Equal(t, tc.want, retryabletransport.DefaultShouldRetry(req, tc.resp, tc.err))
+		})
+	}
+}
+
+func Test_RetryOnGRPCStatus(t *testing.T) {
+	type test struct {
+		name         string
+		inHeader     bool
+		statuses     []string
+		wantAttempts int
+	}
+	tests := []test{
+		{
+			name:         "UNAVAILABLE in trailer is retried",
+			statuses:     []string{"14", "0"},
+			wantAttempts: 2,
+		},
+		{
+			name:         "UNAVAILABLE in header of trailers-only response is retried",
+			inHeader:     true,
+			statuses:     []string{"14", "0"},
+			wantAttempts: 2,
+		},
+		{
+			name:         "other status is not retried",
+			statuses:     []string{"3"},
+			wantAttempts: 1,
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			calledCount := 0
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				status := tc.statuses[calledCount]
+				calledCount++
+				if tc.inHeader {
+					w.Header().Set("Grpc-Status", status)
+					return
+				}
+				w.Header().Set("Trailer", "Grpc-Status")
+				_, _ = w.Write([]byte("payload"))
+				w.Header().Set("Grpc-Status", status)
+			}))
+			defer server.Close()
+			client := &http.Client{
+				Transport: retryabletransport.New(
+					nil,
+					retryabletransport.RetryOnGRPCStatus(14),
+					nil,
+					&retryabletransport.BackOffPolicy{MaxRetries: 1},
+					retryabletransport.AllowRetryOnSuccess(),
+				),
+			}
+			resp, err := client.Get(server.URL)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer resp.Body.Close()
+			assert.Equal(t, tc.wantAttempts, calledCount)
+			if !tc.inHeader {
+				body, err := io.ReadAll(resp.Body)
+				if err != nil {
+					t.Fatal(err)
+				}
+				assert.Equal(t, "payload", string(body))
+			}
+		})
+	}
+}
+
+func Test_RetryOnJSONField(t *testing.T) {
+	type test struct {
+		name string
+		body string
+		want bool
+	}
+	tests := []test{
+		{
+			name: "matching nested field is retried",
+			body: `{"error":{"retryable":true}}`,
+			want: true,
+		},
+		{
+			name: "non-matching field is not retried",
+			body: `{"error":{"retryable":false}}`,
+			want: false,
+		},
+		{
+			name: "missing field is not retried",
+			body: `{"error":"boom"}`,
+			want: false,
+		},
+		{
+			name: "non-JSON body is not retried",
+			body: `<html>bad gateway</html>`,
+			want: false,
+		},
+		{
+			name: "body over the inspection cap is not retried",
+			body: `{"error":{"retryable":true},"pad":"` + strings.Repeat("x", 64<<10) + `"}`,
+			want: false,
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			resp := &http.Response{
+				StatusCode: http.StatusBadRequest,
+				Body:       io.NopCloser(strings.NewReader(tc.body)),
+			}
+			shouldRetry := retryabletransport.RetryOnJSONField("error.retryable", true)
+			assert.Equal(t, tc.want, shouldRetry(nil, resp, nil))
+			body, err := io.ReadAll(resp.Body)
+			if err != nil {
+				t.Fatal(err)
+			}
+			assert.Equal(t, tc.body, string(body))
+		})
+	}
+	t.Run("numbers are compared by value", func(t *testing.T) {
+		resp := &http.Response{Body: io.NopCloser(strings.NewReader(`{"code":14}`))}
+		assert.True(t, retryabletransport.RetryOnJSONField("code", 14)(nil, resp, nil))
+	})
+}
+
+func Test_RetryOnConnectError_RetryOnMidFlightError(t *testing.T) {
+	type test struct {
+		name          string
+		method        string
+		err           error
+		wantConnect   bool
+		wantMidFlight bool
+	}
+	tests := []test{
+		{
+			name:        "dial error is a connect error for POST",
+			method:      http.MethodPost,
+			err:         &net.OpError{Op: "dial", Net: "tcp", Err: syscall.EHOSTUNREACH},
+			wantConnect: true,
+		},
+		{
+			name:        "temporary DNS error is a connect error",
+			method:      http.MethodPost,
+			err:         &net.DNSError{Err: "server misbehaving", IsTemporary: true},
+			wantConnect: true,
+		},
+		{
+			name:   "DNS not found is not retried",
+			method: http.MethodGet,
+			err:    &net.DNSError{Err: "no such host", IsNotFound: true},
+		},
+		{
+			name:          "reset of an established connection is mid-flight for GET",
+			method:        http.MethodGet,
+			err:           &net.OpError{Op: "read", Net: "tcp", Err: syscall.ECONNRESET},
+			wantMidFlight: true,
+		},
+		{
+			name:   "reset of an established connection is not retried for POST",
+			method: http.MethodPost,
+			err:    &net.OpError{Op: "read", Net: "tcp", Err: syscall.ECONNRESET},
+		},
+		{
+			name:          "unexpected EOF is mid-flight for PUT",
+			method:        http.MethodPut,
+			err:           fmt.Errorf("read body: %w", io.ErrUnexpectedEOF),
+			wantMidFlight: true,
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			req, err := http.NewRequest(tc.method, "http://example.com", nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			assert.Equal(t, tc.wantConnect, retryabletransport.RetryOnConnectError()(req, nil, tc.err))
+			assert.Equal(t, tc.wantMidFlight, retryabletransport.RetryOnMidFlightError()(req, nil, tc.err))
+		})
+	}
+}
+
+func Test_RetryOnIdleConnClosed(t *testing.T) {
+	type test struct {
+		name      string
+		written   bool
+		wantErr   bool
+		wantCalls int
+	}
+	tests := []test{
+		{name: "closed before the request was written is retried", written: false, wantErr: false, wantCalls: 2},
+		{name: "closed after the request was written is not retried", written: true, wantErr: true, wantCalls: 1},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			var calledCount int
+			rt := retryabletransport.New(
+				roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+					calledCount++
+					if calledCount > 1 {
+						return &http.Response{StatusCode: http.StatusOK, Body: http.NoBody}, nil
+					}
+					// The first attempt is sent on a reused idle connection, which the server closes.
+					trace := httptrace.ContextClientTrace(req.Context())
+					trace.GotConn(httptrace.GotConnInfo{Reused: true, WasIdle: true})
+					if tc.written {
+						trace.WroteHeaders()
+					}
+					return nil, io.EOF
+				}),
+				nil,
+				nil,
+				&retryabletransport.BackOffPolicy{MaxRetries: 1, InitialInterval: time.Millisecond},
+			)
+			req, err := http.NewRequest(http.MethodPost, "http://example.com", strings.NewReader("body"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			resp, err := rt.RoundTrip(req)
+			if tc.wantErr {
+				assert.ErrorIs(t, err, io.EOF)
+				var idleErr *retryabletransport.IdleConnClosedError
+				assert.False(t, errors.As(err, &idleErr))
+			} else if assert.NoError(t, err) {
+				assert.Equal(t, http.StatusOK, resp.StatusCode)
+			}
+			assert.Equal(t, tc.wantCalls, calledCount)
+		})
+	}
+	t.Run("request processed before the connection was closed is not resent", func(t *testing.T) {
+		// The server closes every kept-alive connection instead of answering its second request,
+		// after having read and processed it.
+		var mu sync.Mutex
+		requests := map[string]int{}
+		var calledCount int
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			mu.Lock()
+			requests[r.RemoteAddr]++
+			n := requests[r.RemoteAddr]
+			calledCount++
+			mu.Unlock()
+			if n > 1 {
+				_, _ = io.Copy(io.Discard, r.Body)
+				conn, _, err := http.NewResponseController(w).Hijack()
+				if err != nil {
+					t.Error(err)
+					return
+				}
+				_ = conn.Close()
+			}
+		}))
+		defer server.Close()
+
+		transport := &http.Transport{}
+		defer transport.CloseIdleConnections()
+		client := &http.Client{
+			Transport: retryabletransport.New(
+				transport,
+				nil,
+				nil,
+				&retryabletransport.BackOffPolicy{MaxRetries: 1, InitialInterval: time.Millisecond},
+			),
+		}
+		resp, err := client.Post(server.URL, "text/plain", strings.NewReader("body"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, _ = io.Copy(io.Discard, resp.Body)
+		_ = resp.Body.Close()
+
+		_, err = client.Post(server.URL, "text/plain", strings.NewReader("body"))
+		assert.Error(t, err)
+		mu.Lock()
+		defer mu.Unlock()
+		assert.Equal(t, 2, calledCount, "the second POST reached the server and must not be sent again")
+	})
+}
+
+func Test_RetryOnTimeout(t *testing.T) {
+	canceledCtx, cancel := context.WithCancel(context.Background())
+	cancel()
+	type test struct {
+		name string
+		ctx  context.Context
+		err  error
+		want bool
+	}
+	tests := []test{
+		{
+			name: "per-attempt deadline is retried",
+			ctx:  context.Background(),
+			err:  fmt.Errorf("attempt: %w", context.DeadlineExceeded),
+			want: true,
+		},
+		{
+			name: "net timeout is retried",
+			ctx:  context.Background(),
+			err:  &net.OpError{Op: "dial", Err: &timeoutErr{}},
+			want: true,
+		},
+		{
+			name: "deadline of the request context is not retried",
+			ctx:  canceledCtx,
+			err:  context.DeadlineExceeded,
+			want: false,
+		},
+		{
+			name: "other errors are not retried",
+			ctx:  context.Background(),
+			err:  syscall.ECONNRESET,
+			want: false,
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			req, err := http.NewRequestWithContext(tc.ctx, http.MethodGet, "http://example.com", nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			assert.Equal(t, tc.want, retryabletransport.RetryOnTimeout()(req, nil, tc.err))
+		})
+	}
+}
+
+type timeoutErr struct{}
+
+func (e *timeoutErr) Error() string   { return "i/o timeout" }
+func (e *timeoutErr) Timeout() bool   { return true }
+func (e *timeoutErr) Temporary() bool { return true }
+
+func Test_StopOnRepeatedFailure(t *testing.T) {
+	type test struct {
+		name         string
+		statusCodes  []int
+		wantAttempts int
+	}
+	tests := []test{
+		{
+			name:         "identical failures stop early",
+			statusCodes:  []int{http.StatusServiceUnavailable},
+			wantAttempts: 3,
+		},
+		{
+			name:         "alternating failures exhaust retries",
+			statusCodes:  []int{http.StatusServiceUnavailable, http.StatusBadGateway},
+			wantAttempts: 6,
+		},
+		{
+			name:         "a differing failure resets the count",
+			statusCodes:  []int{http.StatusServiceUnavailable, http.StatusServiceUnavailable, http.StatusBadGateway},
+			wantAttempts: 6,
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			calledCount := 0
+			rt := retryabletransport.New(
+				roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+					statusCode := tc.statusCodes[calledCount%len(tc.statusCodes)]
+					calledCount++
+					return &http.Response{StatusCode: statusCode, Body: http.NoBody}, nil
+				}),
+				retryabletransport.StopOnRepeatedFailure(func(req *http.Request, resp *http.Response, err error) bool {
+					return true
+				}, 3),
+				nil,
+				&retryabletransport.BackOffPolicy{MaxRetries: 5, InitialInterval: time.Millisecond},
+			)
+			// The count is per request, so a second request starts over.
+			for i := 0; i < 2; i++ {
+				calledCount = 0
+				req, err := http.NewRequest(http.MethodGet, "http://example.com", nil)
+				if err != nil {
+					t.Fatal(err)
+				}
+				_, _ = rt.RoundTrip(req)
+				assert.Equal(t, tc.wantAttempts, calledCount)
+			}
+		})
+	}
+}
+
+func Test_RetryOnEmptyBody(t *testing.T) {
+	type test struct {
+		name   string
+		method string
+		resp   *http.Response
+		want   bool
+	}
+	tests := []test{
+		{
+			name:   "zero Content-Length is retried",
+			method: http.MethodGet,
+			resp:   &http.Response{StatusCode: http.StatusOK, Body: http.NoBody},
+			want:   true,
+		},
+		{
+			name:   "empty body of unknown length is retried",
+			method: http.MethodGet,
+			resp:   &http.Response{StatusCode: http.StatusOK, ContentLength: -1, Body: io.NopCloser(strings.NewReader(""))},
+			want:   true,
+		},
+		{
+			name:   "non-empty body is not retried",
+			method: http.MethodGet,
+			resp:   &http.Response{StatusCode: http.StatusOK, ContentLength: -1, Body: io.NopCloser(strings.NewReader("ok"))},
+			want:   false,
+		},
+		{
+			name:   "empty 204 is not retried",
+			method: http.MethodGet,
+			resp:   &http.Response{StatusCode: http.StatusNoContent, Body: http.NoBody},
+			want:   false,
+		},
+		{
+			name:   "empty response to HEAD is not retried",
+			method: http.MethodHead,
+			resp:   &http.Response{StatusCode: http.StatusOK, Body: http.NoBody},
+			want:   false,
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			req, err := http.NewRequest(tc.method, "http://example.com", nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			assert.Equal(t, tc.want, retryabletransport.RetryOnEmptyBody()(req, tc.resp, nil))
+		})
+	}
+
+	t.Run("body is restored", func(t *testing.T) {
+		calledCount := 0
+		rt := retryabletransport.New(
+			roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+				calledCount++
+				body := ""
+				if calledCount > 1 {
+					body = "payload"
+				}
+				return &http.Response{StatusCode: http.StatusOK, ContentLength: -1, Body: io.NopCloser(strings.NewReader(body))}, nil
+			}),
+			retryabletransport.RetryOnEmptyBody(),
+			nil,
+			&retryabletransport.BackOffPolicy{MaxRetries: 1, InitialInterval: time.Millisecond},
+			retryabletransport.AllowRetryOnSuccess(),
+		)
+		req, err := http.NewRequest(http.MethodGet, "http://example.com", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp, err := rt.RoundTrip(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := io.ReadAll(resp.Body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		assert.Equal(t, 2, calledCount)
+		assert.Equal(t, "payload", string(got))
+	})
+}
+
+func Test_RetryOnStatus(t *testing.T) {
+	req, err := http.NewRequest(http.MethodPost, "http://example.com", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	shouldRetry := retryabletransport.RetryOnStatus(append(retryabletransport.DefaultRetryStatusCodes(), http.StatusConflict)...)
+	for _, code := range []int{http.StatusRequestTimeout, http.StatusTooManyRequests, http.StatusServiceUnavailable, http.StatusConflict} {
+		assert.True(t, shouldRetry(req, &http.Response{StatusCode: code}, nil), code)
+	}
+	for _, code := range []int{http.StatusOK, http.StatusBadRequest, http.StatusGatewayTimeout} {
+		assert.False(t, shouldRetry(req, &http.Response{StatusCode: code}, nil), code)
+	}
+	assert.False(t, shouldRetry(req, nil, syscall.ECONNRESET))
+}
+
+func Test_RetryWhen(t *testing.T) {
+	type test struct {
+		name   string
+		method string
+		status int
+		want   bool
+	}
+	tests := []test{
+		{
+			name:   "409 is retried for PUT",
+			method: http.MethodPut,
+			status: http.StatusConflict,
+			want:   true,
+		},
+		{
+			name:   "409 is not retried for POST",
+			method: http.MethodPost,
+			status: http.StatusConflict,
+			want:   false,
+		},
+		{
+			name:   "425 is retried for POST",
+			method: http.MethodPost,
+			status: http.StatusTooEarly,
+			want:   true,
+		},
+		{
+			name:   "425 is retried for GET",
+			method: http.MethodGet,
+			status: http.StatusTooEarly,
+			want:   true,
+		},
+		{
+			name:   "other statuses are not retried",
+			method: http.MethodPut,
+			status: http.StatusBadRequest,
+			want:   false,
+		},
+	}
+	predicates := map[string]retryabletransport.ShouldRetryFunc{
+		"RetryWhen": retryabletransport.RetryWhen(func(method string, status int) bool {
+			return status == http.StatusConflict && method == http.MethodPut || status == http.StatusTooEarly
+		}),
+		"combinators": retryabletransport.AnyOf(
+			retryabletransport.AllOf(retryabletransport.RetryOnMethod(http.MethodPut), retryabletransport.RetryOnStatus(http.StatusConflict)),
+			retryabletransport.RetryOnStatus(http.StatusTooEarly),
+		),
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			req, err := http.NewRequest(tc.method, "http://example.com", nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for name, shouldRetry := range predicates {
+				assert.Equal(t, tc.want, shouldRetry(req, &http.Response{StatusCode: tc.status}, nil), name)
+				assert.False(t, shouldRetry(req, nil, syscall.ECONNRESET), name)
+			}
+		})
+	}
+}
+
+// eagerBodyTransport validates responses eagerly: it decompresses the gzip body of each response returned by
+// roundTripper before returning it, and fails with a *retryabletransport.ResponseBodyError if wrap is set.
+type eagerBodyTransport struct {
+	roundTripper http.RoundTripper
+	wrap         bool
+}
+
+func (t *eagerBodyTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp, err := t.roundTripper.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	zr, err := gzip.NewReader(resp.Body)
+	if err == nil {
+		var b []byte
+		if b, err = io.ReadAll(zr); err == nil {
+			resp.Body = io.NopCloser(bytes.NewReader(b))
+			return resp, nil
+		}
+	}
+	if t.wrap {
+		err = &retryabletransport.ResponseBodyError{Err: err}
+	}
+	return nil, err
+}
+
+func Test_RetryOnResponseBodyError(t *testing.T) {
+	var valid bytes.Buffer
+	zw := gzip.NewWriter(&valid)
+	_, _ = zw.Write([]byte("hello"))
+	_ = zw.Close()
+	// Flipping a byte of the trailer breaks the checksum, and a truncated stream ends unexpectedly.
+	badChecksum := bytes.Clone(valid.Bytes())
+	badChecksum[len(badChecksum)-5] ^= 0xff
+	truncated := valid.Bytes()[:valid.Len()-4]
+
+	type test struct {
+		name         string
+		method       string
+		first        []byte
+		wrap         bool
+		wantAttempts int
+		wantErr      bool
+	}
+	tests := []test{
+		{
+			name:         "checksum error is retried for GET",
+			method:       http.MethodGet,
+			first:        badChecksum,
+			wantAttempts: 2,
+		},
+		{
+			name:         "wrapped truncated body is retried for GET",
+			method:       http.MethodGet,
+			first:        truncated,
+			wrap:         true,
+			wantAttempts: 2,
+		},
+		{
+			name:         "truncated body is not retried unwrapped",
+			method:       http.MethodGet,
+			first:        truncated,
+			wantAttempts: 1,
+			wantErr:      true,
+		},
+		{
+			name:         "checksum error is not retried for POST",
+			method:       http.MethodPost,
+			first:        badChecksum,
+			wantAttempts: 1,
+			wantErr:      true,
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			calledCount := 0
+			rt := retryabletransport.New(
+				&eagerBodyTransport{
+					roundTripper: roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+						calledCount++
+						body := valid.Bytes()
+						if calledCount == 1 {
+							body = tc.first
+						}
+						return &http.Response{StatusCode: http.StatusOK, Body: io.NopCloser(bytes.NewReader(body))}, nil
+					}),
+					wrap: tc.wrap,
+				},
+				retryabletransport.RetryOnResponseBodyError(),
+				nil,
+				&retryabletransport.BackOffPolicy{MaxRetries: 1, InitialInterval: time.Millisecond},
+			)
+			req, err := http.NewRequest(tc.method, "http://example.com", nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			resp, err := rt.RoundTrip(req)
+			assert.Equal(t, tc.wantAttempts, calledCount)
+			if tc.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			if !assert.NoError(t, err) {
+				return
+			}
+			b, _ := io.ReadAll(resp.Body)
+			assert.Equal(t, "hello", string(b))
+		})
+	}
+}
+
+func Test_RetryOnProxyError(t *testing.T) {
+	type test struct {
+		name       string
+		method     string
+		statusCode int
+		header     http.Header
+		want       bool
+	}
+	tests := []test{
+		{
+			name:       "502 from nginx is retried for POST",
+			method:     http.MethodPost,
+			statusCode: http.StatusBadGateway,
+			header:     http.Header{"Server": {"nginx/1.25.3"}},
+			want:       true,
+		},
+		{
+			name:       "502 from envoy is retried for POST",
+			method:     http.MethodPost,
+			statusCode: http.StatusBadGateway,
+			header:     http.Header{"Server": {"envoy"}},
+			want:       true,
+		},
+		{
+			name:       "502 through a Via proxy is retried for POST",
+			method:     http.MethodPost,
+			statusCode: http.StatusBadGateway,
+			header:     http.Header{"Via": {"1.1 varnish"}},
+			want:       true,
+		},
+		{
+			name:       "502 without proxy headers is not retried for POST",
+			method:     http.MethodPost,
+			statusCode: http.StatusBadGateway,
+			header:     http.Header{"Server": {"gunicorn"}},
+			want:       false,
+		},
+		{
+			name:       "502 without proxy headers is retried for GET",
+			method:     http.MethodGet,
+			statusCode: http.StatusBadGateway,
+			header:     http.Header{},
+			want:       true,
+		},
+		{
+			name:       "504 from nginx is not retried for POST",
+			method:     http.MethodPost,
+			statusCode: http.StatusGatewayTimeout,
+			header:     http.Header{"Server": {"nginx"}},
+			want:       false,
+		},
+		{
+			name:       "500 from nginx is not retried",
+			method:     http.MethodGet,
+			statusCode: http.StatusInternalServerError,
+			header:     http.Header{"Server": {"nginx"}},
+			want:       false,
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			req, err := http.NewRequest(tc.method, "http://example.com", nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			resp := &http.Response{StatusCode: tc.statusCode, Header: tc.header}
+			assert.Equal(t, tc.want, retryabletransport.RetryOnProxyError()(req, resp, nil))
+		})
+	}
+}
+
+func Test_RetryOnCDNError(t *testing.T) {
+	type test struct {
+		statusCode int
+		wantGet    bool
+		wantPost   bool
+	}
+	tests := []test{
+		{statusCode: 519},
+		{statusCode: 520, wantGet: true},
+		{statusCode: 521, wantGet: true, wantPost: true},
+		{statusCode: 522, wantGet: true, wantPost: true},
+		{statusCode: 523, wantGet: true, wantPost: true},
+		{statusCode: 524, wantGet: true},
+		{statusCode: 525},
+	}
+	for _, tc := range tests {
+		t.Run(strconv.Itoa(tc.statusCode), func(t *testing.T) {
+			for method, want := range map[string]bool{http.MethodGet: tc.wantGet, http.MethodPost: tc.wantPost} {
+				req, err := http.NewRequest(method, "http://example.com", nil)
+				if err != nil {
+					t.Fatal(err)
+				}
+				resp := &http.Response{StatusCode: tc.statusCode}
+				assert.Equal(t, want, retryabletransport.RetryOnCDNError()(req, resp, nil), method)
+				assert.Equal(t, want, retryabletransport.DefaultShouldRetry(req, resp, nil), method)
+			}
+		})
+	}
+}
+
+func Test_RetryOnUnexpectedContentType(t *testing.T) {
+	type test struct {
+		name        string
+		contentType string
+		want        bool
+	}
+	tests := []test{
+		{
+			name:        "expected type is not retried",
+			contentType: "application/json",
+			want:        false,
+		},
+		{
+			name:        "parameters and case are ignored",
+			contentType: "Application/JSON; charset=utf-8",
+			want:        false,
+		},
+		{
+			name:        "wildcard subtype matches",
+			contentType: "image/png",
+			want:        false,
+		},
+		{
+			name:        "HTML error page is retried",
+			contentType: "text/html; charset=utf-8",
+			want:        true,
+		},
+		{
+			name:        "unexpected type is retried",
+			contentType: "application/xml",
+			want:        true,
+		},
+		{
+			name:        "malformed type is retried",
+			contentType: "/",
+			want:        true,
+		},
+		{
+			name: "missing type is not retried",
+			want: false,
+		},
+	}
+	shouldRetry := retryabletransport.RetryOnUnexpectedContentType("application/json", "image/*")
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			req, err := http.NewRequest(http.MethodGet, "http://example.com", nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			resp := &http.Response{StatusCode: http.StatusBadGateway, Header: http.Header{}}
+			if tc.contentType != "" {
+				resp.Header.Set("Content-Type", tc.contentType)
+			}
+			assert.Equal(t, tc.want, shouldRetry(req, resp, nil))
+		})
+	}
+	t.Run("restricted to status codes", func(t *testing.T) {
+		calledCount := 0
+		rt := retryabletransport.New(
+			roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+				calledCount++
+				resp := &http.Response{StatusCode: http.StatusBadGateway, Header: http.Header{}, Body: http.NoBody}
+				resp.Header.Set("Content-Type", "text/html")
+				if calledCount > 1 {
+					resp.StatusCode = http.StatusNotFound
+				}
+				return resp, nil
+			}),
+			retryabletransport.AllOf(
+				retryabletransport.RetryOnStatus(http.StatusBadGateway, http.StatusServiceUnavailable),
+				retryabletransport.RetryOnUnexpectedContentType("application/json"),
+			),
+			nil,
+			&retryabletransport.BackOffPolicy{MaxRetries: 3, InitialInterval: time.Millisecond},
+		)
+		req, err := http.NewRequest(http.MethodGet, "http://example.com", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp, err := rt.RoundTrip(req)
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+		assert.Equal(t, 2, calledCount)
+	})
+}
+
+func Test_RoundTripper_RoundTrip_Head(t *testing.T) {
+	var methods []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		methods = append(methods, r.Method)
+		w.Header().Set("Content-Type", "application/json")
+		if len(methods) == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			_, _ = w.Write([]byte(`{"retryable": true}`))
+			return
+		}
+		_, _ = w.Write([]byte(`{"retryable": false}`))
+	}))
+	defer server.Close()
+
+	type test struct {
+		name            string
+		shouldRetryFunc retryabletransport.ShouldRetryFunc
+		wantMethods     []string
+		wantStatus      int
+	}
+	tests := []test{
+		{
+			name:        "retried on status like GET",
+			wantMethods: []string{http.MethodHead, http.MethodHead},
+			wantStatus:  http.StatusOK,
+		},
+		{
+			name:            "body predicates see no body",
+			shouldRetryFunc: retryabletransport.RetryOnJSONField("retryable", true),
+			wantMethods:     []string{http.MethodHead},
+			wantStatus:      http.StatusServiceUnavailable,
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			methods = nil
+			client := &http.Client{
+				Transport: retryabletransport.New(
+					nil,
+					tc.shouldRetryFunc,
+					nil,
+					&retryabletransport.BackOffPolicy{MaxRetries: 1, InitialInterval: time.Millisecond},
+				),
+			}
+			resp, err := client.Head(server.URL)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer resp.Body.Close()
+			assert.Equal(t, tc.wantStatus, resp.StatusCode)
+			assert.Equal(t, tc.wantMethods, methods)
+		})
+	}
+}
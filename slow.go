@@ -0,0 +1,45 @@
+package retryabletransport
+
+import (
+	"net/http"
+	"time"
+)
+
+// RetryIfSlowerThan retries an idempotent request once if its attempt succeeded but took longer than d until its
+// response headers arrived, hoping for a faster replica, which hedges slow responses after the fact. The slow
+// response is held until the retry completes and is returned if the retry fails, so that the latency optimization
+// never turns a success into a failure. The retry counts against BackOffPolicy.MaxRetries like any other; if it is
+// not made, the slow response is returned. Requests whose body cannot be replayed are not retried.
+func RetryIfSlowerThan(d time.Duration) Option {
+	return func(p *RoundTripper) {
+		p.slowerThan = d
+	}
+}
+
+// holdSlowResponse holds the response of the latest attempt of state while it is retried for being slow.
+func (s *retryState) holdSlowResponse() {
+	s.slowRetried = true
+	s.slowResp, s.slowCancel = s.resp, s.cancelAttempt
+	s.cancelAttempt = nil
+}
+
+// resolveSlowRetry ends the request of state after the retry of a slow response, with the response of the retry if
+// it succeeded, or with the slow response otherwise.
+func (p *RoundTripper) resolveSlowRetry(state *retryState) error {
+	slowResp, slowCancel := state.slowResp, state.slowCancel
+	state.slowResp, state.slowCancel = nil, nil
+	discard := func(resp *http.Response, cancel func()) {
+		drainBody(resp, p.drainLimit())
+		if cancel != nil {
+			cancel()
+		}
+	}
+	if state.err == nil && isSuccess(state.resp) {
+		discard(slowResp, slowCancel)
+	} else {
+		discard(state.resp, state.cancelAttempt)
+		state.resp, state.err, state.cancelAttempt = slowResp, nil, slowCancel
+	}
+	state.recordDecision(DecisionSuccess)
+	return nil
+}
@@ -0,0 +1,189 @@
+package retryabletransport_test
+
+import (
+	"bytes"
+	"io"
+	"log/slog"
+	"net/http"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/linzhengen/retryabletransport"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_RetryIfSlowerThan(t *testing.T) {
+	type result struct {
+		latency time.Duration
+		status  int
+		err     error
+	}
+	type test struct {
+		name         string
+		method       string
+		maxRetries   uint64
+		results      []result
+		wantAttempts int
+		wantBody     string
+	}
+	tests := []test{
+		{
+			name:         "slow response is retried once",
+			method:       http.MethodGet,
+			maxRetries:   3,
+			results:      []result{{latency: 50 * time.Millisecond, status: http.StatusOK}, {status: http.StatusOK}},
+			wantAttempts: 2,
+			wantBody:     "1",
+		},
+		{
+			name:         "slow retry is not retried again",
+			method:       http.MethodGet,
+			maxRetries:   3,
+			results:      []result{{latency: 50 * time.Millisecond, status: http.StatusOK}, {latency: 50 * time.Millisecond, status: http.StatusOK}},
+			wantAttempts: 2,
+			wantBody:     "1",
+		},
+		{
+			name:         "failed retry returns the slow response",
+			method:       http.MethodGet,
+			maxRetries:   3,
+			results:      []result{{latency: 50 * time.Millisecond, status: http.StatusOK}, {status: http.StatusServiceUnavailable}},
+			wantAttempts: 2,
+			wantBody:     "0",
+		},
+		{
+			name:         "retry failing with an error returns the slow response",
+			method:       http.MethodGet,
+			maxRetries:   3,
+			results:      []result{{latency: 50 * time.Millisecond, status: http.StatusOK}, {err: syscall.ECONNRESET}},
+			wantAttempts: 2,
+			wantBody:     "0",
+		},
+		{
+			name:         "fast response is not retried",
+			method:       http.MethodGet,
+			maxRetries:   3,
+			results:      []result{{status: http.StatusOK}},
+			wantAttempts: 1,
+			wantBody:     "0",
+		},
+		{
+			name:         "non-idempotent request is not retried",
+			method:       http.MethodPost,
+			maxRetries:   3,
+			results:      []result{{latency: 50 * time.Millisecond, status: http.StatusOK}},
+			wantAttempts: 1,
+			wantBody:     "0",
+		},
+		{
+			name:         "retry is bounded by MaxRetries",
+			method:       http.MethodGet,
+			maxRetries:   0,
+			results:      []result{{latency: 50 * time.Millisecond, status: http.StatusOK}},
+			wantAttempts: 1,
+			wantBody:     "0",
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			calledCount := 0
+			rt := retryabletransport.New(
+				roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+					r := tc.results[calledCount]
+					body := strings.NewReader(string(rune('0' + calledCount)))
+					calledCount++
+					time.Sleep(r.latency)
+					if r.err != nil {
+						return nil, r.err
+					}
+					return &http.Response{StatusCode: r.status, Body: io.NopCloser(body)}, nil
+				}),
+				nil,
+				nil,
+				&retryabletransport.BackOffPolicy{MaxRetries: tc.maxRetries, InitialInterval: time.Millisecond},
+				retryabletransport.RetryIfSlowerThan(20*time.Millisecond),
+				retryabletransport.ReturnLastResponseOnExhaustion(false),
+			)
+			req, err := http.NewRequest(tc.method, "http://example.com", nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			resp, err := rt.RoundTrip(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer resp.Body.Close()
+			assert.Equal(t, http.StatusOK, resp.StatusCode)
+			assert.Equal(t, tc.wantAttempts, calledCount)
+			b, err := io.ReadAll(resp.Body)
+			assert.NoError(t, err)
+			assert.Equal(t, tc.wantBody, string(b))
+		})
+	}
+}
+
+func Test_RetryIfSlowerThan_GiveUpResponse(t *testing.T) {
+	var logs bytes.Buffer
+	giveUps := 0
+	rt := retryabletransport.New(
+		roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+			time.Sleep(5 * time.Millisecond)
+			return &http.Response{StatusCode: http.StatusOK, Body: io.NopCloser(strings.NewReader("slow"))}, nil
+		}),
+		nil,
+		nil,
+		&retryabletransport.BackOffPolicy{MaxRetries: 0},
+		retryabletransport.RetryIfSlowerThan(time.Millisecond),
+		retryabletransport.WithLogger(slog.New(slog.NewTextHandler(&logs, nil))),
+		retryabletransport.WithGiveUpResponse(func(req *http.Request, lastResp *http.Response, lastErr error) *http.Response {
+			giveUps++
+			return &http.Response{StatusCode: http.StatusServiceUnavailable, Body: http.NoBody}
+		}),
+	)
+	req, err := http.NewRequest(http.MethodGet, "http://example.com", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := rt.RoundTrip(req)
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	b, err := io.ReadAll(resp.Body)
+	assert.NoError(t, err)
+	assert.Equal(t, "slow", string(b))
+	assert.Equal(t, 0, giveUps)
+	assert.Empty(t, logs.String())
+}
+
+func Test_RetryIfSlowerThan_BodyNotReplayable(t *testing.T) {
+	var bodies []string
+	rt := retryabletransport.New(
+		roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+			b, err := io.ReadAll(req.Body)
+			if err != nil {
+				return nil, err
+			}
+			bodies = append(bodies, string(b))
+			time.Sleep(5 * time.Millisecond)
+			return &http.Response{StatusCode: http.StatusOK, Body: http.NoBody}, nil
+		}),
+		nil,
+		nil,
+		&retryabletransport.BackOffPolicy{MaxRetries: 3, InitialInterval: time.Millisecond},
+		retryabletransport.RetryIfSlowerThan(time.Millisecond),
+		retryabletransport.WithoutBodyBuffering(),
+	)
+	req, err := http.NewRequest(http.MethodPut, "http://example.com", io.NopCloser(strings.NewReader("important data")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := rt.RoundTrip(req)
+	if assert.NoError(t, err) {
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+	}
+	assert.Equal(t, []string{"important data"}, bodies, "a body that cannot be replayed must be sent once")
+}
@@ -0,0 +1,41 @@
+package retryabletransport
+
+import (
+	"context"
+	"math/rand/v2"
+	"time"
+)
+
+// WithStartupSpread delays the first attempt of every request by a random duration of up to maxDelay, which
+// spreads bursts of requests started at once, e.g. by batch jobs, instead of sending them all at the same instant.
+// It is distinct from the backoff between retries, which is not delayed further. The delay is not counted against
+// WithTotalTimeout or ElapsedFromContext, and is cut short if the request context is done, in which case its error
+// is returned.
+func WithStartupSpread(maxDelay time.Duration) Option {
+	return func(p *RoundTripper) {
+		p.startupSpread = maxDelay
+	}
+}
+
+// waitStartupSpread waits for the random delay of WithStartupSpread before a first attempt under ctx.
+func (p *RoundTripper) waitStartupSpread(ctx context.Context) error {
+	return p.wait(ctx, rand.N(p.startupSpread+1))
+}
+
+// wait waits for d under ctx, with the AfterFunc of WithAfter if set.
+func (p *RoundTripper) wait(ctx context.Context, d time.Duration) error {
+	var c <-chan time.Time
+	if p.after != nil {
+		c = p.after(d)
+	} else {
+		timer := time.NewTimer(d)
+		defer timer.Stop()
+		c = timer.C
+	}
+	select {
+	case <-c:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,76 @@
+package retryabletransport_test
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/linzhengen/retryabletransport"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_WithStartupSpread(t *testing.T) {
+	t.Run("first attempt is delayed within the range", func(t *testing.T) {
+		var delays []time.Duration
+		calledCount := 0
+		rt := retryabletransport.New(
+			roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+				calledCount++
+				if calledCount == 1 {
+					return &http.Response{StatusCode: http.StatusServiceUnavailable}, nil
+				}
+				return &http.Response{StatusCode: http.StatusOK}, nil
+			}),
+			nil,
+			nil,
+			&retryabletransport.BackOffPolicy{MaxRetries: 1, InitialInterval: time.Millisecond, RandomizationFactor: -1},
+			retryabletransport.WithStartupSpread(time.Hour),
+			retryabletransport.WithAfter(func(d time.Duration) <-chan time.Time {
+				delays = append(delays, d)
+				c := make(chan time.Time, 1)
+				c <- time.Now()
+				return c
+			}),
+		)
+		for i := 0; i < 5; i++ {
+			delays = nil
+			req, err := http.NewRequest(http.MethodGet, "http://example.com", nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			calledCount = 0
+			_, err = rt.RoundTrip(req)
+			assert.NoError(t, err)
+			if assert.Len(t, delays, 2) {
+				assert.GreaterOrEqual(t, delays[0], time.Duration(0))
+				assert.LessOrEqual(t, delays[0], time.Hour)
+				assert.Equal(t, time.Millisecond, delays[1], "retries are not spread")
+			}
+		}
+	})
+	t.Run("context cancellation cuts the delay short", func(t *testing.T) {
+		calledCount := 0
+		rt := retryabletransport.New(
+			roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+				calledCount++
+				return &http.Response{StatusCode: http.StatusOK}, nil
+			}),
+			nil,
+			nil,
+			nil,
+			retryabletransport.WithStartupSpread(time.Hour),
+		)
+		ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+		defer cancel()
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, "http://example.com", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		start := time.Now()
+		_, err = rt.RoundTrip(req)
+		assert.ErrorIs(t, err, context.DeadlineExceeded)
+		assert.Less(t, time.Since(start), time.Second)
+		assert.Equal(t, 0, calledCount)
+	})
+}
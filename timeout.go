@@ -0,0 +1,124 @@
+package retryabletransport
+
+import (
+	"context"
+	"io"
+	"math"
+	"net/http"
+	"time"
+)
+
+// WithTotalTimeout caps the time a request may take across all of its attempts and the waits between them at d.
+// When it expires, the last result is returned with an error matching context.DeadlineExceeded.
+// A deadline already set on the request context still applies, so the earlier of the two wins.
+// Note that http.Client.Timeout covers all attempts as well, since retries happen within a single RoundTrip.
+func WithTotalTimeout(d time.Duration) Option {
+	return func(p *RoundTripper) {
+		p.totalTimeout = d
+	}
+}
+
+// WithPerAttemptTimeout caps the time each attempt may take until its response headers arrive at d, so that a
+// hanging attempt fails and is retried while the request deadline leaves room for more. Such failures match
+// context.DeadlineExceeded, as retried by RetryOnTimeout. The body of the returned response stays readable until
+// it is closed; see WithPerAttemptTimeoutGrowth for giving later attempts more time. Combined with
+// WithTotalTimeout, every attempt gets a fresh timeout rather than sharing one, bounded by the remaining total,
+// so the per-attempt timeout of http.Client.Timeout can be left to the RoundTripper instead.
+func WithPerAttemptTimeout(d time.Duration) Option {
+	return func(p *RoundTripper) {
+		p.perAttemptTimeout = d
+	}
+}
+
+// WithPerAttemptTimeoutGrowth multiplies the timeout of WithPerAttemptTimeout by multiplier for every attempt,
+// capped at maxTimeout unless it is zero, so that the nth attempt, counting from zero, gets
+// min(timeout * multiplier^n, maxTimeout). Short first attempts probe the fast path of slow-starting backends,
+// while later attempts allow slow fallbacks more time.
+func WithPerAttemptTimeoutGrowth(multiplier float64, maxTimeout time.Duration) Option {
+	return func(p *RoundTripper) {
+		p.perAttemptTimeoutMultiplier = multiplier
+		p.maxPerAttemptTimeout = maxTimeout
+	}
+}
+
+// attemptTimeout returns the timeout of the attempt with the given zero-based number.
+func (p *RoundTripper) attemptTimeout(attempt uint64) time.Duration {
+	timeout := p.perAttemptTimeout
+	if p.perAttemptTimeoutMultiplier > 0 {
+		scaled := float64(timeout) * math.Pow(p.perAttemptTimeoutMultiplier, float64(attempt))
+		if scaled >= math.MaxInt64 {
+			timeout = math.MaxInt64
+		} else {
+			timeout = time.Duration(scaled)
+		}
+	}
+	if p.maxPerAttemptTimeout > 0 {
+		timeout = min(timeout, p.maxPerAttemptTimeout)
+	}
+	return timeout
+}
+
+// attemptContext is the context of an attempt with a per-attempt timeout. Unlike that of context.WithTimeout, its
+// deadline is lifted once the response headers arrive, so that the body of the response stays readable.
+type attemptContext struct {
+	context.Context
+	deadline time.Time
+}
+
+// withAttemptTimeout returns a copy of parent for an attempt that times out after timeout unless stop is called
+// first, and the function canceling it.
+func withAttemptTimeout(parent context.Context, timeout time.Duration) (ctx context.Context, stop func(), cancel context.CancelFunc) {
+	c, cancelCause := context.WithCancelCause(parent)
+	timer := time.AfterFunc(timeout, func() {
+		cancelCause(context.DeadlineExceeded)
+	})
+	stop = func() {
+		timer.Stop()
+	}
+	cancel = func() {
+		timer.Stop()
+		cancelCause(context.Canceled)
+	}
+	return &attemptContext{Context: c, deadline: time.Now().Add(timeout)}, stop, cancel
+}
+
+// Deadline returns the earlier of the per-attempt deadline and that of the parent context.
+func (c *attemptContext) Deadline() (time.Time, bool) {
+	if deadline, ok := c.Context.Deadline(); ok && deadline.Before(c.deadline) {
+		return deadline, true
+	}
+	return c.deadline, true
+}
+
+// Err returns context.DeadlineExceeded once the per-attempt timeout expired.
+func (c *attemptContext) Err() error {
+	err := c.Context.Err()
+	if err == context.Canceled && context.Cause(c.Context) == context.DeadlineExceeded {
+		return context.DeadlineExceeded
+	}
+	return err
+}
+
+// cancelOnClose arranges for cancel to be called once the response body is closed,
+// or right away if there is no body to read.
+func cancelOnClose(resp *http.Response, cancel context.CancelFunc) *http.Response {
+	if resp == nil || resp.Body == nil || resp.Body == http.NoBody {
+		cancel()
+		return resp
+	}
+	resp.Body = &cancelOnCloseBody{ReadCloser: resp.Body, cancel: cancel}
+	return resp
+}
+
+// cancelOnCloseBody cancels a context when the wrapped body is closed.
+type cancelOnCloseBody struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+// Close closes the wrapped body and cancels the context.
+func (b *cancelOnCloseBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.cancel()
+	return err
+}
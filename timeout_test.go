@@ -0,0 +1,229 @@
+package retryabletransport_test
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/linzhengen/retryabletransport"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_WithTotalTimeout(t *testing.T) {
+	type test struct {
+		name         string
+		totalTimeout time.Duration
+		ctxTimeout   time.Duration
+	}
+	tests := []test{
+		{
+			name:         "total timeout cuts retries short",
+			totalTimeout: 100 * time.Millisecond,
+			ctxTimeout:   10 * time.Second,
+		},
+		{
+			name:         "earlier context deadline wins",
+			totalTimeout: 10 * time.Second,
+			ctxTimeout:   100 * time.Millisecond,
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			rt := retryabletransport.New(
+				roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+					return &http.Response{StatusCode: http.StatusServiceUnavailable, Body: http.NoBody}, nil
+				}),
+				nil,
+				nil,
+				&retryabletransport.BackOffPolicy{MaxRetries: 10},
+				retryabletransport.WithTotalTimeout(tc.totalTimeout),
+			)
+			ctx, cancel := context.WithTimeout(context.Background(), tc.ctxTimeout)
+			defer cancel()
+			req, err := http.NewRequestWithContext(ctx, http.MethodGet, "http://example.com", nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			start := time.Now()
+			resp, err := rt.RoundTrip(req)
+			assert.ErrorIs(t, err, context.DeadlineExceeded)
+			assert.Less(t, time.Since(start), time.Second)
+			if assert.NotNil(t, resp) {
+				assert.Equal(t, http.StatusServiceUnavailable, resp.StatusCode)
+			}
+		})
+	}
+	t.Run("body stays readable after RoundTrip returns", func(t *testing.T) {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			_, _ = w.Write([]byte("ok"))
+		}))
+		defer server.Close()
+		client := &http.Client{
+			Transport: retryabletransport.New(nil, nil, nil, nil, retryabletransport.WithTotalTimeout(time.Second)),
+		}
+		resp, err := client.Get(server.URL)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		body, err := io.ReadAll(resp.Body)
+		assert.NoError(t, err)
+		assert.Equal(t, "ok", string(body))
+	})
+}
+
+func Test_WithPerAttemptTimeout(t *testing.T) {
+	type test struct {
+		name         string
+		opts         []retryabletransport.Option
+		wantTimeouts []time.Duration
+	}
+	tests := []test{
+		{
+			name:         "constant timeout",
+			opts:         []retryabletransport.Option{retryabletransport.WithPerAttemptTimeout(100 * time.Millisecond)},
+			wantTimeouts: []time.Duration{100 * time.Millisecond, 100 * time.Millisecond, 100 * time.Millisecond, 100 * time.Millisecond},
+		},
+		{
+			name: "growing timeout is capped",
+			opts: []retryabletransport.Option{
+				retryabletransport.WithPerAttemptTimeout(100 * time.Millisecond),
+				retryabletransport.WithPerAttemptTimeoutGrowth(2, 500*time.Millisecond),
+			},
+			wantTimeouts: []time.Duration{100 * time.Millisecond, 200 * time.Millisecond, 400 * time.Millisecond, 500 * time.Millisecond},
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			var timeouts []time.Duration
+			rt := retryabletransport.New(
+				roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+					deadline, ok := req.Context().Deadline()
+					assert.True(t, ok)
+					timeouts = append(timeouts, time.Until(deadline))
+					return &http.Response{StatusCode: http.StatusServiceUnavailable, Body: http.NoBody}, nil
+				}),
+				nil,
+				nil,
+				&retryabletransport.BackOffPolicy{MaxRetries: 3, InitialInterval: time.Millisecond},
+				tc.opts...,
+			)
+			req, err := http.NewRequest(http.MethodGet, "http://example.com", nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			_, _ = rt.RoundTrip(req)
+			if assert.Len(t, timeouts, len(tc.wantTimeouts)) {
+				for i, want := range tc.wantTimeouts {
+					assert.LessOrEqual(t, timeouts[i], want)
+					assert.Greater(t, timeouts[i], want-50*time.Millisecond)
+				}
+			}
+		})
+	}
+	t.Run("hanging attempts are retried and bodies outlive the timeout", func(t *testing.T) {
+		var calledCount atomic.Int32
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if calledCount.Add(1) == 1 {
+				select {
+				case <-r.Context().Done():
+				case <-time.After(time.Second):
+				}
+				return
+			}
+			w.WriteHeader(http.StatusOK)
+			http.NewResponseController(w).Flush()
+			time.Sleep(60 * time.Millisecond)
+			_, _ = w.Write([]byte("ok"))
+		}))
+		defer server.Close()
+		rt := retryabletransport.New(
+			nil,
+			nil,
+			nil,
+			&retryabletransport.BackOffPolicy{MaxRetries: 1, InitialInterval: time.Millisecond},
+			retryabletransport.WithPerAttemptTimeout(30*time.Millisecond),
+		)
+		req, err := http.NewRequest(http.MethodGet, server.URL, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp, err := rt.RoundTrip(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		assert.Equal(t, int32(2), calledCount.Load())
+		b, err := io.ReadAll(resp.Body)
+		assert.NoError(t, err)
+		assert.Equal(t, "ok", string(b))
+	})
+}
+
+func Test_WithPerAttemptTimeout_TotalTimeout(t *testing.T) {
+	type test struct {
+		name           string
+		totalTimeout   time.Duration
+		wantAttempts   int
+		wantLastBudget time.Duration
+	}
+	tests := []test{
+		{
+			name:           "every attempt gets a fresh timeout",
+			totalTimeout:   time.Second,
+			wantAttempts:   3,
+			wantLastBudget: 50 * time.Millisecond,
+		},
+		{
+			name:           "the last attempt is bounded by the remaining total",
+			totalTimeout:   80 * time.Millisecond,
+			wantAttempts:   2,
+			wantLastBudget: 30 * time.Millisecond,
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			var starts, deadlines []time.Time
+			rt := retryabletransport.New(
+				roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+					deadline, ok := req.Context().Deadline()
+					assert.True(t, ok)
+					starts = append(starts, time.Now())
+					deadlines = append(deadlines, deadline)
+					<-req.Context().Done()
+					return nil, req.Context().Err()
+				}),
+				nil,
+				nil,
+				&retryabletransport.BackOffPolicy{MaxRetries: 2, InitialInterval: time.Millisecond, RandomizationFactor: -1},
+				retryabletransport.WithPerAttemptTimeout(50*time.Millisecond),
+				retryabletransport.WithTotalTimeout(tc.totalTimeout),
+			)
+			req, err := http.NewRequest(http.MethodGet, "http://example.com", nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			// The total timeout starts within RoundTrip, just after start.
+			start := time.Now()
+			_, err = rt.RoundTrip(req)
+			totalDeadline := start.Add(tc.totalTimeout + 10*time.Millisecond)
+			assert.ErrorIs(t, err, context.DeadlineExceeded)
+			if !assert.Len(t, deadlines, tc.wantAttempts) {
+				return
+			}
+			for i := range deadlines {
+				assert.False(t, deadlines[i].After(totalDeadline), "attempt %d exceeds the total timeout", i)
+				assert.LessOrEqual(t, deadlines[i].Sub(starts[i]), 50*time.Millisecond, "attempt %d", i)
+				if i > 0 {
+					assert.True(t, deadlines[i].After(deadlines[i-1]), "attempt %d shares the deadline of the previous one", i)
+				}
+			}
+			last := len(deadlines) - 1
+			assert.LessOrEqual(t, deadlines[last].Sub(starts[last]), tc.wantLastBudget)
+		})
+	}
+}
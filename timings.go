@@ -0,0 +1,109 @@
+package retryabletransport
+
+import (
+	"crypto/tls"
+	"net/http"
+	"net/http/httptrace"
+	"sync"
+	"time"
+)
+
+// AttemptTimings is the breakdown of the time an attempt took, as reported by the net/http/httptrace hooks, for
+// telling retries caused by connection setup from those caused by server latency. Phases the attempt did not go
+// through, e.g. DNS and connect on a reused connection, are zero.
+type AttemptTimings struct {
+	// GetConn is the time until a connection was obtained, including DNS, connect, TLS, and waiting for an idle
+	// connection.
+	GetConn      time.Duration
+	DNS          time.Duration
+	Connect      time.Duration
+	TLSHandshake time.Duration
+	// ReusedConn reports whether the attempt was sent on a kept-alive connection.
+	ReusedConn bool
+	// TimeToFirstByte is the time from writing the request until the first byte of the response arrived.
+	TimeToFirstByte time.Duration
+}
+
+// WithAttemptTimings records the AttemptTimings of every attempt in its AttemptOutcome. Timings rely on the
+// net/http/httptrace hooks, so they are only recorded by transports that call them, such as *http.Transport.
+func WithAttemptTimings() Option {
+	return func(p *RoundTripper) {
+		p.attemptTimings = true
+	}
+}
+
+// timingsTrace collects the AttemptTimings of an attempt. The hooks may be called from other goroutines, even after
+// the attempt returned, e.g. for a dial that was abandoned.
+type timingsTrace struct {
+	mu           sync.Mutex
+	start        time.Time
+	dnsStart     time.Time
+	connectStart time.Time
+	tlsStart     time.Time
+	wroteRequest time.Time
+	timings      AttemptTimings
+}
+
+// traceTimings returns a copy of req that records its timings in the returned timingsTrace.
+func traceTimings(req *http.Request) (*http.Request, *timingsTrace) {
+	t := &timingsTrace{start: time.Now()}
+	clientTrace := &httptrace.ClientTrace{
+		DNSStart: func(httptrace.DNSStartInfo) {
+			t.mark(&t.dnsStart)
+		},
+		DNSDone: func(httptrace.DNSDoneInfo) {
+			t.since(&t.dnsStart, &t.timings.DNS)
+		},
+		ConnectStart: func(network, addr string) {
+			t.mark(&t.connectStart)
+		},
+		ConnectDone: func(network, addr string, err error) {
+			if err == nil {
+				t.since(&t.connectStart, &t.timings.Connect)
+			}
+		},
+		TLSHandshakeStart: func() {
+			t.mark(&t.tlsStart)
+		},
+		TLSHandshakeDone: func(tls.ConnectionState, error) {
+			t.since(&t.tlsStart, &t.timings.TLSHandshake)
+		},
+		GotConn: func(info httptrace.GotConnInfo) {
+			t.since(&t.start, &t.timings.GetConn)
+			t.mu.Lock()
+			defer t.mu.Unlock()
+			t.timings.ReusedConn = info.Reused
+		},
+		WroteRequest: func(httptrace.WroteRequestInfo) {
+			t.mark(&t.wroteRequest)
+		},
+		GotFirstResponseByte: func() {
+			t.since(&t.wroteRequest, &t.timings.TimeToFirstByte)
+		},
+	}
+	return req.WithContext(httptrace.WithClientTrace(req.Context(), clientTrace)), t
+}
+
+// mark records the current time in start.
+func (t *timingsTrace) mark(start *time.Time) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	*start = time.Now()
+}
+
+// since records the time elapsed since start in d, unless start was not marked.
+func (t *timingsTrace) since(start *time.Time, d *time.Duration) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if !start.IsZero() {
+		*d = time.Since(*start)
+	}
+}
+
+// snapshot returns the timings recorded so far.
+func (t *timingsTrace) snapshot() *AttemptTimings {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	timings := t.timings
+	return &timings
+}
@@ -0,0 +1,89 @@
+package retryabletransport_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/linzhengen/retryabletransport"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_WithAttemptTimings(t *testing.T) {
+	var calledCount atomic.Int32
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if calledCount.Add(1) == 1 {
+			time.Sleep(20 * time.Millisecond)
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer server.Close()
+
+	newTransport := func(opts ...retryabletransport.Option) *retryabletransport.RoundTripper {
+		transport := server.Client().Transport.(*http.Transport).Clone()
+		t.Cleanup(transport.CloseIdleConnections)
+		return retryabletransport.New(
+			transport,
+			nil,
+			nil,
+			&retryabletransport.BackOffPolicy{MaxRetries: 1, InitialInterval: time.Millisecond},
+			opts...,
+		)
+	}
+	t.Run("timings are recorded per attempt", func(t *testing.T) {
+		calledCount.Store(0)
+		ctx := retryabletransport.WithDebugTrace(context.Background())
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, server.URL, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp, err := newTransport(retryabletransport.WithAttemptTimings()).RoundTrip(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		outcomes, _ := retryabletransport.AttemptOutcomesFromContext(resp.Request.Context())
+		if !assert.Len(t, outcomes, 2) {
+			return
+		}
+		// The first attempt set up the connection and waited for the server.
+		first := outcomes[0].Timings
+		if assert.NotNil(t, first) {
+			assert.False(t, first.ReusedConn)
+			assert.Greater(t, first.Connect, time.Duration(0))
+			assert.Greater(t, first.TLSHandshake, time.Duration(0))
+			assert.GreaterOrEqual(t, first.GetConn, first.Connect+first.TLSHandshake)
+			assert.GreaterOrEqual(t, first.TimeToFirstByte, 20*time.Millisecond)
+		}
+		// The retry reused the connection of the first attempt.
+		second := outcomes[1].Timings
+		if assert.NotNil(t, second) {
+			assert.True(t, second.ReusedConn)
+			assert.Zero(t, second.Connect)
+			assert.Zero(t, second.TLSHandshake)
+		}
+		entries, _ := retryabletransport.DebugTraceFromContext(ctx)
+		if assert.Len(t, entries, 2) {
+			assert.Equal(t, first, entries[0].Timings)
+		}
+	})
+	t.Run("timings are not recorded by default", func(t *testing.T) {
+		calledCount.Store(0)
+		req, err := http.NewRequest(http.MethodGet, server.URL, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp, err := newTransport().RoundTrip(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		outcomes, _ := retryabletransport.AttemptOutcomesFromContext(resp.Request.Context())
+		for _, o := range outcomes {
+			assert.Nil(t, o.Timings)
+		}
+	})
+}
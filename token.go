@@ -0,0 +1,49 @@
+package retryabletransport
+
+import (
+	"context"
+	"fmt"
+)
+
+// RefreshTokenFunc returns the value of the Authorization header to resend a request with after its token was
+// rejected, such as "Bearer " followed by a freshly obtained access token. It must not return a cached token.
+type RefreshTokenFunc func(ctx context.Context) (authorization string, err error)
+
+// WithTokenRefresh resends a request right away with the Authorization header returned by refreshToken when it is
+// answered with 401 Unauthorized, for OAuth 2 access tokens that expired or were revoked. The token is refreshed at
+// most once per request, so a request rejected again is decided on by shouldRetryFunc like any other response;
+// the resent attempt counts against BackOffPolicy.MaxRetries but is made even if no retries are allowed, unless
+// the request is marked by WithSingleAttempt or the kill switch of WithKillSwitch is pulled. Being made right away
+// rather than as a retry, it is not limited by a RetryBudget, WithHealthGate, or WithMaxConcurrentRetries.
+// Requests whose body cannot be replayed are not resent. If refreshToken fails, RoundTrip returns its error
+// instead of the 401 response. With golang.org/x/oauth2, a token can be refreshed by exchanging the refresh token
+// of an oauth2.Config cfg through a source without a cached access token:
+//
+//	func(ctx context.Context) (string, error) {
+//		tok, err := cfg.TokenSource(ctx, &oauth2.Token{RefreshToken: refreshToken}).Token()
+//		if err != nil {
+//			return "", err
+//		}
+//		return tok.Type() + " " + tok.AccessToken, nil
+//	}
+//
+// The header is set on a clone of the request for every attempt from then on, so the caller's request is never
+// modified and no separate request hook is needed.
+func WithTokenRefresh(refreshToken RefreshTokenFunc) Option {
+	return func(p *RoundTripper) {
+		p.refreshTokenFunc = refreshToken
+	}
+}
+
+// refreshToken refreshes the token of the request of state after its latest attempt was rejected.
+// If that fails, the rejected response is discarded and the error is returned.
+func (p *RoundTripper) refreshToken(state *retryState) error {
+	authorization, err := p.refreshTokenFunc(state.req.Context())
+	if err != nil {
+		drainBody(state.resp, p.drainLimit())
+		state.resp = nil
+		return fmt.Errorf("refreshing token after 401 Unauthorized: %w", err)
+	}
+	state.authorization = authorization
+	return nil
+}
@@ -0,0 +1,96 @@
+package retryabletransport_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/linzhengen/retryabletransport"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_WithTokenRefresh(t *testing.T) {
+	errRefresh := errors.New("refresh failed")
+	type test struct {
+		name          string
+		freshToken    string
+		refreshErr    error
+		maxRetries    uint64
+		wantStatus    int
+		wantErr       error
+		wantAuths     []string
+		wantRefreshes int
+	}
+	tests := []test{
+		{
+			name:          "rejected token is refreshed and the request resent",
+			freshToken:    "Bearer fresh",
+			maxRetries:    3,
+			wantStatus:    http.StatusOK,
+			wantAuths:     []string{"Bearer stale", "Bearer fresh"},
+			wantRefreshes: 1,
+		},
+		{
+			name:          "request is resent even without retries",
+			freshToken:    "Bearer fresh",
+			wantStatus:    http.StatusOK,
+			wantAuths:     []string{"Bearer stale", "Bearer fresh"},
+			wantRefreshes: 1,
+		},
+		{
+			name:          "token is refreshed at most once",
+			freshToken:    "Bearer revoked",
+			maxRetries:    3,
+			wantStatus:    http.StatusUnauthorized,
+			wantAuths:     []string{"Bearer stale", "Bearer revoked"},
+			wantRefreshes: 1,
+		},
+		{
+			name:          "refresh error is returned",
+			refreshErr:    errRefresh,
+			maxRetries:    3,
+			wantErr:       errRefresh,
+			wantAuths:     []string{"Bearer stale"},
+			wantRefreshes: 1,
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			var auths []string
+			refreshes := 0
+			rt := retryabletransport.New(
+				roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+					auths = append(auths, req.Header.Get("Authorization"))
+					if req.Header.Get("Authorization") != "Bearer fresh" {
+						return &http.Response{StatusCode: http.StatusUnauthorized, Body: http.NoBody}, nil
+					}
+					return &http.Response{StatusCode: http.StatusOK, Body: http.NoBody}, nil
+				}),
+				nil,
+				nil,
+				&retryabletransport.BackOffPolicy{MaxRetries: tc.maxRetries, InitialInterval: time.Millisecond},
+				retryabletransport.WithTokenRefresh(func(ctx context.Context) (string, error) {
+					refreshes++
+					return tc.freshToken, tc.refreshErr
+				}),
+			)
+			req, err := http.NewRequest(http.MethodGet, "http://example.com", nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			req.Header.Set("Authorization", "Bearer stale")
+			resp, err := rt.RoundTrip(req)
+			if tc.wantErr != nil {
+				assert.ErrorIs(t, err, tc.wantErr)
+				assert.Nil(t, resp)
+			} else if assert.NoError(t, err) {
+				assert.Equal(t, tc.wantStatus, resp.StatusCode)
+			}
+			assert.Equal(t, tc.wantAuths, auths)
+			assert.Equal(t, tc.wantRefreshes, refreshes)
+			assert.Equal(t, "Bearer stale", req.Header.Get("Authorization"), "the caller's request must not be modified")
+		})
+	}
+}
@@ -4,8 +4,12 @@ import (
 	"bytes"
 	"context"
 	"errors"
+	"fmt"
 	"io"
 	"net/http"
+	"strconv"
+	"strings"
+	"sync/atomic"
 	"time"
 
 	"github.com/cenkalti/backoff/v4"
@@ -17,79 +21,821 @@ type ShouldRetryFunc func(*http.Request, *http.Response, error) bool
 // NotifyFunc represents a function that notifies about errors and durations during retries.
 type NotifyFunc func(ctx context.Context, err error, duration time.Duration)
 
-// BackOffPolicy represents the maximum number of retries for a backoff policy.
+// MaxRetriesFunc returns the retry cap that applies to the given request, response, and error.
+// If ok is false, BackOffPolicy.MaxRetries applies.
+type MaxRetriesFunc func(*http.Request, *http.Response, error) (maxRetries uint64, ok bool)
+
+// NotifyContextFunc returns the context passed to NotifyFunc for retries of the given request.
+type NotifyContextFunc func(*http.Request) context.Context
+
+// DetachedNotifyContext is the default NotifyContextFunc. It returns a context carrying the values of the request
+// context without its deadline and cancellation, so logging and metrics in NotifyFunc survive the caller giving up.
+func DetachedNotifyContext(req *http.Request) context.Context {
+	return context.WithoutCancel(req.Context())
+}
+
+// BackOffPolicy represents the maximum number of retries and the exponential backoff between them.
+// Zero values of the interval settings fall back to the defaults of github.com/cenkalti/backoff/v4.
 type BackOffPolicy struct {
 	MaxRetries uint64
+	// InitialInterval is the delay before the first retry. It defaults to 500ms.
+	InitialInterval time.Duration
+	// MaxInterval caps the delay between two attempts. It defaults to 60s.
+	MaxInterval time.Duration
+	// Multiplier is the factor the delay grows by after every retry. It defaults to 1.5.
+	Multiplier float64
+	// RandomizationFactor is the jitter applied to every delay, which is picked from
+	// [delay * (1 - RandomizationFactor), delay * (1 + RandomizationFactor)]. It defaults to 0.5;
+	// a negative value disables jitter.
+	RandomizationFactor float64
+	// MaxElapsedTime stops retrying once this long has passed since the request started, its first attempt
+	// included. It defaults to 15m.
+	MaxElapsedTime time.Duration
+	// CeilingInterval, if set, switches to a constant backoff once the exponentially growing interval reaches it:
+	// from then on every delay is exactly CeilingInterval, without jitter. Unlike MaxInterval, which clamps the
+	// interval but keeps applying jitter around it, no delay ever exceeds CeilingInterval. A CeilingInterval above
+	// MaxInterval is capped at MaxInterval, which the interval never grows beyond.
+	CeilingInterval time.Duration
+	// FirstRetryImmediate retries the first failure without any delay, for failures that are likely transient
+	// glitches. Later retries back off as usual, starting at InitialInterval.
+	FirstRetryImmediate bool
+	// MinInterval, if set, is a floor on every delay between two attempts, applied after jitter, load scaling, and
+	// Retry-After, so that no retry follows its attempt sooner, including one made by FirstRetryImmediate. Unlike
+	// InitialInterval, which only sets out the growth of the delays, it holds for all of them.
+	MinInterval time.Duration
+	// AbsoluteMaxSleep, if set, is a hard cap on every delay between two attempts, applied after jitter, load
+	// scaling, and Retry-After, including its jitter, for strict latency bounds. It takes precedence over
+	// MinInterval and WithMaxRetryAfter.
+	AbsoluteMaxSleep time.Duration
 }
 
 // RoundTripper provides a retryable HTTP transport mechanism.
+// It is safe for concurrent use by multiple goroutines: state shared between requests, such as a RetryBudget or
+// the slots of WithMaxConcurrentRetries, is synchronized, and all other state is kept per request.
 type RoundTripper struct {
 	roundTripper    http.RoundTripper
 	shouldRetryFunc ShouldRetryFunc
 	notifyFunc      NotifyFunc
 	backOffPolicy   *BackOffPolicy
+	routePolicies   []RoutePolicy
+	retryBudget     *RetryBudget
+	maxRetriesFunc  MaxRetriesFunc
+
+	allowRetryOnSuccess bool
+	allowRetryAfterSent bool
+
+	attemptHeader        string
+	attemptHeaderOnFirst bool
+
+	notifyContextFunc NotifyContextFunc
+	notifyFilter      NotifyFilter
+
+	loadScale  *loadScale
+	retrySlots chan struct{}
+
+	totalTimeout time.Duration
+
+	backends         []string
+	backendSelection BackendSelection
+
+	streamBody     bool
+	retryAfterFunc RetryAfterFunc
+
+	maxInspectBodyBytes int64
+
+	metricsRecorder    MetricsRecorder
+	attemptRecorder    AttemptMetricsRecorder
+	giveUpResponseFunc GiveUpResponseFunc
+	maxDrainBodyBytes  int64
+	bodyBufferPool     bool
+	retryAfterJitter   float64
+	errorOnExhaustion  bool
+	maxRetryAfter      time.Duration
+	backendFunc        BackendFunc
+	after              AfterFunc
+	correlationHeader  string
+	correlationIDFunc  func() string
+	faultRate          float64
+	faultFunc          func() error
+	healthGate         HealthGateFunc
+	logger             *logger
+	noBodyBuffering    bool
+	attemptTimings     bool
+	strictBodyReplay   bool
+	stopCondition      StopConditionFunc
+	eventChannel       chan<- RetryEvent
+	startupSpread      time.Duration
+	killSwitch         func() bool
+	slowerThan         time.Duration
+	refreshTokenFunc   RefreshTokenFunc
+	bufferMemory       *bufferMemory
+	beforeRequestFunc  func(req *http.Request)
+	rateLimiter        *rateLimiter
+	integrityCheck     bool
+	http1Fallback      int
+	http1Transport     http.RoundTripper
+	responseValidator  ResponseValidatorFunc
+	bodyReplayCheck    bool
+
+	immediateRetryFunc  ShouldRetryFunc
+	maxImmediateRetries int
+
+	perAttemptTimeout           time.Duration
+	perAttemptTimeoutMultiplier float64
+	maxPerAttemptTimeout        time.Duration
 }
 
-// ShouldRetryRespError is returned when a response indicates the request should be retried.
+// Option configures optional behavior of a RoundTripper.
+type Option func(*RoundTripper)
+
+// ShouldRetryRespError is returned along with the last response, if ReturnLastResponseOnExhaustion is disabled,
+// when retries ran out on a response indicating that the request should be retried.
 var ShouldRetryRespError = errors.New("should retry response error")
 
+// BodyNotReplayableError is returned with StrictBodyReplay when an attempt should be retried but its request body
+// can be neither replayed from a buffer nor through GetBody.
+var BodyNotReplayableError = errors.New("request body cannot be replayed for a retry")
+
+// NilResponseError is the error of an attempt for which the wrapped transport returned neither a response nor an
+// error. It is passed to shouldRetryFunc like any other error, so predicates decide whether to retry it;
+// DefaultShouldRetry does not.
+var NilResponseError = errors.New("transport returned neither a response nor an error")
+
 // New creates a new RoundTripper with the provided parameters. If roundTripper is nil, http.DefaultTransport is used.
-// If backOffPolicy is nil, a default policy with MaxRetries set to 3 is used.
-func New(roundTripper http.RoundTripper, shouldRetryFunc ShouldRetryFunc, notifyFunc NotifyFunc, backOffPolicy *BackOffPolicy) *RoundTripper {
+// If shouldRetryFunc is nil, DefaultShouldRetry is used.
+// If backOffPolicy is nil, a default policy with MaxRetries set to 3 is used. Options are applied in order.
+func New(roundTripper http.RoundTripper, shouldRetryFunc ShouldRetryFunc, notifyFunc NotifyFunc, backOffPolicy *BackOffPolicy, opts ...Option) *RoundTripper {
 	if roundTripper == nil {
 		roundTripper = http.DefaultTransport
 	}
-	if backOffPolicy == nil {
-		backOffPolicy = &BackOffPolicy{MaxRetries: 3}
-	}
-	return &RoundTripper{
+	p := &RoundTripper{
 		backOffPolicy:   backOffPolicy,
 		roundTripper:    roundTripper,
 		shouldRetryFunc: shouldRetryFunc,
 		notifyFunc:      notifyFunc,
 	}
+	for _, opt := range opts {
+		opt(p)
+	}
+	if p.shouldRetryFunc == nil {
+		p.shouldRetryFunc = DefaultShouldRetry
+	}
+	if p.backOffPolicy == nil {
+		p.backOffPolicy = &BackOffPolicy{MaxRetries: 3}
+	}
+	if p.notifyContextFunc == nil {
+		p.notifyContextFunc = DetachedNotifyContext
+	}
+	return p
+}
+
+// WrapClient replaces the Transport of c with a RoundTripper wrapping it, or http.DefaultTransport if it is nil,
+// and returns c. All other fields of c, such as Timeout, are left untouched.
+// The retry behavior is configured through opts and defaults to the same as New with nil parameters.
+func WrapClient(c *http.Client, opts ...Option) *http.Client {
+	c.Transport = New(c.Transport, nil, nil, nil, opts...)
+	return c
+}
+
+// WithShouldRetry sets the function deciding whether a request should be retried.
+func WithShouldRetry(shouldRetryFunc ShouldRetryFunc) Option {
+	return func(p *RoundTripper) {
+		p.shouldRetryFunc = shouldRetryFunc
+	}
+}
+
+// WithBeforeRequest calls beforeRequest once per RoundTrip with the request passed to it, before its first attempt
+// and before its body is buffered, for setup tied to the logical request rather than to single attempts, such as
+// starting a timer. It runs after the delay of WithStartupSpread.
+func WithBeforeRequest(beforeRequest func(req *http.Request)) Option {
+	return func(p *RoundTripper) {
+		p.beforeRequestFunc = beforeRequest
+	}
+}
+
+// WithNotify sets the function notified about retries.
+func WithNotify(notifyFunc NotifyFunc) Option {
+	return func(p *RoundTripper) {
+		p.notifyFunc = notifyFunc
+	}
+}
+
+// WithBackOffPolicy sets the backoff policy.
+func WithBackOffPolicy(backOffPolicy *BackOffPolicy) Option {
+	return func(p *RoundTripper) {
+		p.backOffPolicy = backOffPolicy
+	}
+}
+
+// WithMaxRetriesForError sets a function that picks the retry cap from the first failed attempt of a request,
+// e.g. 5 retries for connection resets but only 1 for 503s. The cap is resolved once per request and takes
+// precedence over BackOffPolicy.MaxRetries, which remains the default when maxRetriesFunc returns false.
+func WithMaxRetriesForError(maxRetriesFunc MaxRetriesFunc) Option {
+	return func(p *RoundTripper) {
+		p.maxRetriesFunc = maxRetriesFunc
+	}
+}
+
+// AllowRetryOnSuccess lets shouldRetryFunc retry 2xx responses that came with a nil error.
+// By default such responses are returned as-is without consulting shouldRetryFunc,
+// which guards against predicates that mistakenly ask to retry successful responses.
+func AllowRetryOnSuccess() Option {
+	return func(p *RoundTripper) {
+		p.allowRetryOnSuccess = true
+	}
+}
+
+// ReturnLastResponseOnExhaustion sets whether a request whose retries ran out on a response that shouldRetryFunc
+// retries returns that response with a nil error, as callers of a transport expect. It is enabled by default;
+// if disabled, the response is returned along with ShouldRetryRespError. Requests stopped early for other
+// reasons, such as RetryAfterExceededBudgetError, always fail with an error and no response.
+func ReturnLastResponseOnExhaustion(enabled bool) Option {
+	return func(p *RoundTripper) {
+		p.errorOnExhaustion = !enabled
+	}
+}
+
+// WithNotifyContext sets the function providing the context passed to NotifyFunc, e.g. an application-wide
+// observability context. It defaults to DetachedNotifyContext; pass a function returning req.Context() to have
+// notifications observe request cancellation. Waiting between attempts always stops when the request context is done.
+func WithNotifyContext(notifyContextFunc NotifyContextFunc) Option {
+	return func(p *RoundTripper) {
+		p.notifyContextFunc = notifyContextFunc
+	}
+}
+
+// DefaultAttemptHeader is the header set by WithAttemptHeader when no name is given.
+const DefaultAttemptHeader = "X-Retry-Attempt"
+
+// WithAttemptHeader sets a header carrying the zero-based attempt number on every retry, so servers can tell
+// retries apart from original requests. If name is empty, DefaultAttemptHeader is used. If onFirstAttempt is true,
+// the header is also set, to 0, on the first attempt. The caller's request is never modified; each attempt is
+// sent as a clone carrying the header.
+func WithAttemptHeader(name string, onFirstAttempt bool) Option {
+	return func(p *RoundTripper) {
+		if name == "" {
+			name = DefaultAttemptHeader
+		}
+		p.attemptHeader = name
+		p.attemptHeaderOnFirst = onFirstAttempt
+	}
 }
 
 // RoundTrip executes a single HTTP transaction and returns a response.
-// It implements the http.RoundTripper interface.
+// It implements the http.RoundTripper interface. The context of resp.Request carries the retry statistics
+// of the request, see AttemptsFromContext and ElapsedFromContext.
+//
+// A request body is replayed on every attempt, through GetBody if the request provides one and by buffering it
+// otherwise, in which case the buffer is exposed through GetBody. Requests sending "Expect: 100-continue"
+// repeat the handshake on each attempt. A 417 Expectation Failed response to such a
+// request is retried without the Expect header, regardless of shouldRetryFunc.
 func (p *RoundTripper) RoundTrip(req *http.Request) (resp *http.Response, err error) {
-	bodyByte, err := readBody(req)
-	if err != nil {
-		return nil, err
+	if p.startupSpread > 0 {
+		if err := p.waitStartupSpread(req.Context()); err != nil {
+			if req.Body != nil {
+				_ = req.Body.Close()
+			}
+			return nil, err
+		}
+	}
+	start := time.Now()
+	if p.beforeRequestFunc != nil {
+		p.beforeRequestFunc(req)
+	}
+	var newBody func() io.ReadCloser
+	var getBody func() (io.ReadCloser, error)
+	// streamGetBody is the GetBody of a streamed body, which cannot replay it once RoundTrip returned.
+	var streamGetBody func() (io.ReadCloser, error)
+	if hasBody(req) {
+		if p.noBodyBuffering {
+			// The body is replayed through GetBody only; without one, the request is sent once.
+			getBody = req.GetBody
+		} else if req.GetBody != nil && !p.streamBody {
+			// The caller can replay the body already, so it is sent as-is instead of being buffered.
+			getBody = req.GetBody
+		} else if p.bufferMemory != nil && !p.bufferMemory.fits(req) {
+			// The body cannot be counted against the buffer memory limit, so it is not buffered.
+			getBody = req.GetBody
+		} else {
+			if p.bufferMemory != nil {
+				n := req.ContentLength
+				if err := p.bufferMemory.acquire(req.Context(), n); err != nil {
+					_ = req.Body.Close()
+					return nil, err
+				}
+				defer p.bufferMemory.release(n)
+			}
+			if p.streamBody {
+				body := newTeeBody(req.Body)
+				defer body.finish()
+				newBody = body.newReader
+				streamGetBody = body.getBody
+			} else if p.bodyBufferPool {
+				body, err := readPooledBody(req)
+				if err != nil {
+					return nil, err
+				}
+				defer body.release()
+				req.ContentLength = int64(body.len())
+				newBody = body.newReader
+			} else {
+				bodyByte, err := readBody(req)
+				if err != nil {
+					return nil, err
+				}
+				// The length is known once buffered, so every attempt is sent with a Content-Length
+				// instead of being chunked, which e.g. servers parsing multipart uploads may require.
+				req.ContentLength = int64(len(bodyByte))
+				if len(bodyByte) == 0 {
+					// Attempts of an empty body are sent without one, rather than with a reader yielding nothing.
+					newBody = noBody
+				} else {
+					newBody = func() io.ReadCloser {
+						return io.NopCloser(bytes.NewReader(bodyByte))
+					}
+				}
+			}
+		}
 	}
-	b := backoff.NewExponentialBackOff()
-	err = backoff.RetryNotify(func() error {
-		req.Body = io.NopCloser(bytes.NewReader(bodyByte))
-		resp, err = p.roundTripper.RoundTrip(req)
-		if p.shouldRetryFunc(req, resp, err) {
-			if err == nil {
-				return ShouldRetryRespError
+	if newBody != nil && !p.bodyBufferPool && p.bufferMemory == nil {
+		// GetBody is set on the request of the caller, so that an *http.Client following a 307 or 308 redirect
+		// replays the body to the new location. It is not with a buffer memory limit, since it would keep the
+		// buffer alive after its bytes are released.
+		if streamGetBody != nil {
+			req.GetBody = streamGetBody
+		} else {
+			req.GetBody = func() (io.ReadCloser, error) {
+				return newBody(), nil
 			}
+		}
+	}
+	if p.retryBudget != nil {
+		p.retryBudget.deposit()
+	}
+	if p.totalTimeout > 0 {
+		ctx, cancel := context.WithTimeout(req.Context(), p.totalTimeout)
+		req = req.WithContext(ctx)
+		defer func() {
+			resp = cancelOnClose(resp, cancel)
+		}()
+	}
+	req = p.withInspectLimit(req)
+	state := &retryState{
+		req:          req,
+		start:        start,
+		roundTripper: p.transportFor(req),
+		newBody:      newBody,
+		getBody:      getBody,
+		bodyNoReplay: newBody == nil && getBody == nil && hasBody(req),
+		debugTrace:   debugTraceFor(req),
+	}
+	if p.bodyReplayCheck && getBody != nil {
+		state.replayCheck = newReplayCheck()
+	}
+	defer func() {
+		if state.holdsRetrySlot {
+			<-p.retrySlots
+		}
+		if state.cancelAttempt != nil {
+			resp = cancelOnClose(resp, state.cancelAttempt)
+		}
+	}()
+	// Most requests succeed on the first attempt, so it is made before any of the backoff machinery is set up.
+	if err = p.attempt(state); err == nil {
+		return withStats(state.resp, state, start), nil
+	}
+	firstErr := err
+	err = backoff.RetryNotifyWithTimer(func() error {
+		if firstErr != nil {
+			err := firstErr
+			firstErr = nil
 			return err
 		}
-		return backoff.Permanent(err)
+		return p.attempt(state)
 	},
-		backoff.WithMaxRetries(b, p.backOffPolicy.MaxRetries),
+		p.newBackOff(state),
 		func(err error, duration time.Duration) {
-			if p.notifyFunc != nil {
-				p.notifyFunc(req.Context(), err, duration)
+			if p.metricsRecorder != nil {
+				p.metricsRecorder.ObserveRetryDelay(state.req, duration)
+			}
+			if p.attemptRecorder != nil {
+				p.attemptRecorder.ObserveRetry(state.req, state.resp, state.err, duration)
 			}
+			state.recordRetry(duration)
+			state.recordOutcomeDelay(duration)
+			if p.logger != nil {
+				p.logger.logRetry(state, err, duration)
+			}
+			if p.eventChannel != nil {
+				p.sendEvent(state, duration)
+			}
+			p.notify(state, err, duration)
 		},
+		p.timer(),
 	)
-	return resp, err
+	resp = state.resp
+	if state.slowResp != nil {
+		// The retry of a slow response was not made, so the slow response is returned after all, as the success
+		// it is.
+		resp, state.cancelAttempt = state.slowResp, state.slowCancel
+		err = nil
+	}
+	if err != nil && state.stopErr != nil {
+		err = fmt.Errorf("%w: %w", state.stopErr, err)
+	}
+	if err != nil && p.logger != nil {
+		p.logger.logGiveUp(state, err)
+	}
+	if err != nil && p.attemptRecorder != nil {
+		p.attemptRecorder.ObserveGiveUp(state.req, resp, err)
+	}
+	if err != nil && p.giveUpResponseFunc != nil {
+		if giveUpResp := p.giveUpResponseFunc(state.req, resp, err); giveUpResp != nil {
+			resp, err = giveUpResp, nil
+		}
+	}
+	if err != nil && state.stopErr != nil && resp != nil {
+		// An *http.Client ignores, without closing, a response returned along with an error, so it is released here.
+		drainBody(resp, p.drainLimit())
+		resp = nil
+	}
+	if err == ShouldRetryRespError && state.err == nil && !p.errorOnExhaustion {
+		// Retries ran out on a response, which is returned as is, like a plain transport would.
+		err = nil
+	}
+	return withStats(resp, state, start), err
+}
+
+// attempt makes a single attempt of the request of state and records its outcome in state.
+// It returns nil if the outcome is final and successful, a backoff.PermanentError if it is final otherwise,
+// and the error to retry on if not.
+func (p *RoundTripper) attempt(state *retryState) error {
+	req := state.req
+	if p.rateLimiter != nil {
+		if err := p.waitRateLimit(req.Context(), req); err != nil {
+			return backoff.Permanent(err)
+		}
+	}
+	if state.attempts > 0 && state.slowResp == nil {
+		// The response of the previous attempt is discarded, so release its connection for reuse.
+		drainBody(state.resp, p.drainLimit())
+		if state.cancelAttempt != nil {
+			state.cancelAttempt()
+		}
+	}
+	if state.attempts > 0 {
+		if state.getBody != nil {
+			body, err := state.getBody()
+			if err != nil {
+				return backoff.Permanent(err)
+			}
+			req.Body = body
+		}
+	}
+	if state.newBody != nil {
+		req.Body = state.newBody()
+	}
+	if state.replayCheck != nil && hasBody(req) {
+		req.Body = state.replayCheck.wrap(req.Body, state.attempts)
+	}
+	if state.attempts > 0 && hasBody(req) {
+		req.Body = &countingBody{ReadCloser: req.Body, n: &state.reuploaded}
+	}
+	attemptReq := p.newAttemptRequest(state)
+	var stopAttemptTimeout func()
+	if p.perAttemptTimeout > 0 {
+		var ctx context.Context
+		ctx, stopAttemptTimeout, state.cancelAttempt = withAttemptTimeout(attemptReq.Context(), p.attemptTimeout(state.attempts))
+		attemptReq = attemptReq.WithContext(ctx)
+	}
+	var timings *timingsTrace
+	if p.attemptTimings {
+		attemptReq, timings = traceTimings(attemptReq)
+	}
+	var trace *attemptTrace
+	if !isIdempotent(req) {
+		trace = new(attemptTrace)
+		attemptReq = traceAttempt(attemptReq, trace)
+	}
+	attemptStart := time.Now()
+	var resp *http.Response
+	var err error
+	if p.injectsFault() {
+		resp, err = p.fault(attemptReq)
+	} else {
+		resp, err = state.roundTripper.RoundTrip(attemptReq)
+	}
+	state.attemptDuration = time.Since(attemptStart)
+	if stopAttemptTimeout != nil {
+		stopAttemptTimeout()
+	}
+	if resp == nil && err == nil {
+		err = NilResponseError
+	}
+	if trace != nil && trace.reusedIdle.Load() && !trace.sent.Load() && errors.Is(err, io.EOF) {
+		// The reused connection was closed before the request was written, which is how a server closing it for
+		// being idle shows. Once the request was written, the server may have processed it before closing.
+		err = &IdleConnClosedError{Err: err}
+	}
+	state.attempts++
+	state.resp, state.err = resp, err
+	if p.attemptRecorder != nil {
+		p.attemptRecorder.ObserveAttempt(attemptReq, resp, err)
+	}
+	if p.http1Transport != nil {
+		p.observeHTTP2StreamError(state)
+	}
+	if p.rateLimiter != nil && resp != nil {
+		p.rateLimiter.observe(req.URL.Host, resp)
+	}
+	if timings != nil {
+		state.timings = timings.snapshot()
+	}
+	state.recordOutcome()
+	if state.replayCheck != nil {
+		if err := state.replayCheck.mismatch(); err != nil {
+			drainBody(resp, p.drainLimit())
+			state.resp, state.err = nil, err
+			state.recordDecision(DecisionNoRetry)
+			return backoff.Permanent(err)
+		}
+	}
+	if state.slowResp != nil {
+		return p.resolveSlowRetry(state)
+	}
+	if p.slowerThan > 0 && err == nil && isSuccess(resp) && !state.slowRetried && isIdempotent(req) &&
+		!state.bodyNoReplay && state.attemptDuration > p.slowerThan {
+		state.holdSlowResponse()
+		state.recordDecision(DecisionRetry)
+		return ShouldRetryRespError
+	}
+	if p.integrityCheck && err == nil && isSuccess(resp) {
+		if err := p.checkIntegrity(state); err != nil {
+			// The corrupt body is not returned, not even once retries ran out.
+			drainBody(resp, p.drainLimit())
+			state.resp, state.err = nil, err
+			state.recordDecision(DecisionRetry)
+			return err
+		}
+	}
+	if p.responseValidator != nil && err == nil && isSuccess(resp) {
+		if err := p.validateResponse(state); err != nil {
+			return err
+		}
+	}
+	if err == nil && isSuccess(resp) && !p.allowRetryOnSuccess {
+		state.recordDecision(DecisionSuccess)
+		return nil
+	}
+	if err != nil && trace != nil && !p.allowRetryAfterSent && trace.sent.Load() {
+		// The server may have processed the request already, so repeating it is unsafe.
+		state.recordDecision(DecisionSentAlready)
+		return backoff.Permanent(err)
+	}
+	if state.bodyNoReplay {
+		// The body was consumed by this attempt and cannot be sent again.
+		state.recordDecision(DecisionBodyNotReplayable)
+		if p.strictBodyReplay {
+			withRetryState(state)
+			if p.shouldRetryFunc(state.req, resp, err) {
+				return backoff.Permanent(p.bodyNotReplayable(state))
+			}
+		}
+		return backoff.Permanent(err)
+	}
+	if err == nil && resp != nil && resp.StatusCode == http.StatusExpectationFailed && expectsContinue(attemptReq) {
+		// The server refused the 100-continue handshake, so repeat the request without it.
+		state.dropExpect = true
+		state.recordDecision(DecisionDropExpect)
+		return ShouldRetryRespError
+	}
+	if p.refreshTokenFunc != nil && err == nil && resp.StatusCode == http.StatusUnauthorized && state.authorization == "" &&
+		!p.sendsOnce(req) {
+		// The token was rejected, so resend the request with a fresh one right away, outside of the backoff.
+		state.recordDecision(DecisionRefreshToken)
+		if err := p.refreshToken(state); err != nil {
+			return backoff.Permanent(err)
+		}
+		return p.attempt(state)
+	}
+	withRetryState(state)
+	if p.shouldRetryFunc(state.req, resp, err) {
+		state.recordDecision(DecisionRetry)
+		if err == nil {
+			return ShouldRetryRespError
+		}
+		return err
+	}
+	state.recordDecision(DecisionNoRetry)
+	return backoff.Permanent(err)
+}
+
+// RoundTripContext is like RoundTrip, but runs the attempts and the waits between them under ctx instead of
+// the context of req, e.g. for requests built without one. The request itself is not modified.
+func (p *RoundTripper) RoundTripContext(ctx context.Context, req *http.Request) (*http.Response, error) {
+	return p.RoundTrip(req.WithContext(ctx))
+}
+
+// retryState holds the outcome of the latest attempt of a single RoundTrip call.
+type retryState struct {
+	req          *http.Request
+	start        time.Time
+	roundTripper http.RoundTripper
+	resp         *http.Response
+	err          error
+	attempts     uint64
+	dropExpect   bool
+
+	attemptDuration time.Duration
+	// cancelAttempt cancels the context of the latest attempt, if it has a per-attempt timeout.
+	cancelAttempt context.CancelFunc
+
+	// newBody returns the body of an attempt, and getBody that of a retry if the body is replayed through GetBody.
+	newBody func() io.ReadCloser
+	getBody func() (io.ReadCloser, error)
+	// slowResp is the slow but successful response held while it is retried with RetryIfSlowerThan,
+	// and slowCancel cancels the context of its attempt.
+	slowResp    *http.Response
+	slowCancel  context.CancelFunc
+	slowRetried bool
+
+	// replayCheck compares the body lengths of the attempts replayed through getBody, with WithBodyReplayCheck.
+	replayCheck *replayCheck
+	// bodyNoReplay is set if the body is neither buffered nor replayable through GetBody.
+	bodyNoReplay bool
+	// reuploaded counts the bytes of the body read again by retries, which may still be sent after their
+	// attempt failed.
+	reuploaded atomic.Int64
+
+	lastNotified       error
+	suppressedNotifies int
+
+	holdsRetrySlot bool
+	backend        int
+	host           string
+	correlationID  string
+	authorization  string
+	stopErr        error
+
+	// http2StreamErrors counts the attempts failed with HTTP/2 stream errors, and http1 is set once the
+	// remaining attempts are sent over HTTP/1.1.
+	http2StreamErrors int
+	http1             bool
+
+	debugTrace *debugTrace
+
+	timings      *AttemptTimings
+	outcomes     []AttemptOutcome
+	firstOutcome [1]AttemptOutcome
+
+	// predicateStates holds the per-request state of stateful ShouldRetryFuncs by their key.
+	predicateStates map[any]any
 }
 
-// readBody reads the request body and closes it, returning the body as a byte slice.
+// newAttemptRequest returns the request to send for the next attempt.
+// The original request is cloned whenever the attempt needs its own headers or host.
+func (p *RoundTripper) newAttemptRequest(state *retryState) *http.Request {
+	setAttemptHeader := p.attemptHeader != "" && (state.attempts > 0 || p.attemptHeaderOnFirst)
+	pickHost := len(p.backends) > 0 || p.backendFunc != nil && state.attempts > 0
+	var correlationID string
+	if p.correlationHeader != "" {
+		correlationID = p.correlationID(state)
+	}
+	if !state.dropExpect && !setAttemptHeader && !pickHost && correlationID == "" && state.authorization == "" {
+		return state.req
+	}
+	req := state.req.Clone(state.req.Context())
+	if correlationID != "" {
+		req.Header.Set(p.correlationHeader, correlationID)
+	}
+	if pickHost {
+		if host := p.attemptHost(state); host != "" {
+			setHost(req, host)
+		}
+	}
+	if state.dropExpect {
+		req.Header.Del("Expect")
+	}
+	if state.authorization != "" {
+		req.Header.Set("Authorization", state.authorization)
+	}
+	if setAttemptHeader {
+		req.Header.Set(p.attemptHeader, strconv.FormatUint(state.attempts, 10))
+	}
+	return req
+}
+
+// newBackOff builds the backoff used for a single RoundTrip call.
+func (p *RoundTripper) newBackOff(state *retryState) backoff.BackOff {
+	policy := p.policyFor(state.req).resolve()
+	b := policy.newBackOff()
+	if p.immediateRetryFunc != nil {
+		b = &immediateRetryBackOff{BackOff: b, immediate: p.immediateRetryFunc, maxImmediate: p.maxImmediateRetries, state: state}
+	}
+	b = &maxRetriesBackOff{BackOff: b, p: p, state: state, maxRetries: policy.MaxRetries, maxElapsedTime: policy.MaxElapsedTime}
+	if p.loadScale != nil {
+		b = &loadBackOff{BackOff: b, scale: p.loadScale, state: state}
+	}
+	if p.retryAfterFunc != nil {
+		b = &retryAfterBackOff{BackOff: b, retryAfterFunc: p.retryAfterFunc, jitter: p.retryAfterJitter, maxRetryAfter: p.retryAfterCap(), state: state}
+	}
+	// The bounds of the policy wrap every other backoff that picks a delay, so that they hold for Retry-After too.
+	b = policy.clamp(b)
+	if p.healthGate != nil {
+		b = &healthGateBackOff{BackOff: b, healthGate: p.healthGate, state: state}
+	}
+	if p.stopCondition != nil {
+		b = &stopConditionBackOff{BackOff: b, stopCondition: p.stopCondition, state: state}
+	}
+	if p.retrySlots != nil {
+		b = &retrySlotBackOff{BackOff: b, slots: p.retrySlots, state: state}
+	}
+	bc := backoff.WithContext(b, state.req.Context())
+	if p.retryBudget != nil {
+		// The budget is withdrawn from last, once everything else agreed to retry, so that no token is spent on a
+		// retry that is not made.
+		bc = &budgetBackOff{BackOffContext: bc, budget: p.retryBudget, state: state}
+	}
+	return bc
+}
+
+// maxRetriesBackOff stops retrying once the retry cap or the elapsed time of the request is reached.
+type maxRetriesBackOff struct {
+	backoff.BackOff
+	p          *RoundTripper
+	state      *retryState
+	maxRetries uint64
+	// maxElapsedTime is measured from the start of the request, since the clock of the wrapped backoff only starts
+	// once the first attempt failed.
+	maxElapsedTime time.Duration
+	resolved       bool
+}
+
+// NextBackOff returns the wrapped backoff delay, or backoff.Stop if no retries are left.
+func (b *maxRetriesBackOff) NextBackOff() time.Duration {
+	if b.p.sendsOnce(b.state.req) {
+		return backoff.Stop
+	}
+	if !b.resolved {
+		b.resolved = true
+		if b.p.maxRetriesFunc != nil {
+			if maxRetries, ok := b.p.maxRetriesFunc(b.state.req, b.state.resp, b.state.err); ok {
+				b.maxRetries = maxRetries
+			}
+		}
+	}
+	if b.state.attempts > b.maxRetries || b.maxElapsedTime > 0 && time.Since(b.state.start) > b.maxElapsedTime {
+		return backoff.Stop
+	}
+	return b.BackOff.NextBackOff()
+}
+
+// isSuccess reports whether resp has a 2xx status code.
+func isSuccess(resp *http.Response) bool {
+	return resp != nil && resp.StatusCode >= 200 && resp.StatusCode < 300
+}
+
+// expectsContinue reports whether the request asks for a 100-continue handshake.
+func expectsContinue(r *http.Request) bool {
+	return strings.EqualFold(r.Header.Get("Expect"), "100-continue")
+}
+
+// hasBody reports whether the request carries a body that has to be buffered for replay.
+// Bodiless requests such as a plain GET or HEAD are sent as-is on every attempt.
+func hasBody(r *http.Request) bool {
+	return r.Body != nil && r.Body != http.NoBody
+}
+
+// readBody reads the request body and closes it, returning the body as a byte slice, which is nil if it is empty.
 func readBody(r *http.Request) ([]byte, error) {
-	if r.Body == nil || r.Body == http.NoBody {
-		return nil, nil
+	body := r.Body
+	if r.ContentLength == 0 {
+		// A zero ContentLength stands for an empty body or an unknown length, which a single byte tells apart
+		// without allocating a buffer for empty bodies.
+		var probe [1]byte
+		n, err := io.ReadFull(r.Body, probe[:])
+		if n == 0 {
+			if err != io.EOF {
+				return nil, err
+			}
+			return nil, r.Body.Close()
+		}
+		body = struct {
+			io.Reader
+			io.Closer
+		}{io.MultiReader(bytes.NewReader(probe[:n]), r.Body), r.Body}
 	}
-	b, err := io.ReadAll(r.Body)
+	b, err := io.ReadAll(body)
 	if err != nil {
 		return nil, err
 	}
-	if err = r.Body.Close(); err != nil {
+	if err = body.Close(); err != nil {
 		return nil, err
 	}
 	return b, nil
 }
+
+// noBody returns http.NoBody, as the body of every attempt of a request whose body is empty.
+func noBody() io.ReadCloser {
+	return http.NoBody
+}
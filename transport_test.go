@@ -1,6 +1,7 @@
 package retryabletransport_test
 
 import (
+	"bytes"
 	"context"
 	"errors"
 	"fmt"
@@ -30,6 +31,12 @@ func (m *mock) RoundTrip(req *http.Request) (*http.Response, error) {
 	return resp, m.mockErr
 }
 
+type roundTripperFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripperFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
 func Test_RoundTripper_RoundTrip(t *testing.T) {
 	type oneHeader struct {
 		key   string
@@ -101,6 +108,8 @@ func Test_RoundTripper_RoundTrip(t *testing.T) {
 					&retryabletransport.BackOffPolicy{
 						MaxRetries: tc.retriedCount,
 					},
+					// The mock fails requests that were already sent to the server.
+					retryabletransport.AllowRetryAfterSent(),
 				),
 				Timeout: 2 * time.Second,
 			}
@@ -143,6 +152,290 @@ func Test_RoundTripper_RoundTrip(t *testing.T) {
 	}
 }
 
+func Test_RoundTripper_RoundTrip_BodilessRequestIsNotBuffered(t *testing.T) {
+	calledCount := 0
+	rt := retryabletransport.New(
+		roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+			calledCount++
+			assert.Nil(t, req.Body)
+			return nil, syscall.ECONNRESET
+		}),
+		func(req *http.Request, resp *http.Response, err error) bool {
+			return errors.Is(err, syscall.ECONNRESET)
+		},
+		nil,
+		&retryabletransport.BackOffPolicy{MaxRetries: 2},
+	)
+	req, err := http.NewRequest(http.MethodGet, "http://example.com", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = rt.RoundTrip(req)
+	assert.ErrorIs(t, err, syscall.ECONNRESET)
+	assert.Equal(t, 3, calledCount)
+	assert.Nil(t, req.Body)
+}
+
+func Test_RoundTripper_RoundTrip_MaxRetriesForError(t *testing.T) {
+	type test struct {
+		name         string
+		resp         *http.Response
+		err          error
+		wantAttempts int
+	}
+	tests := []test{
+		{
+			name:         "connection resets use their own cap",
+			err:          syscall.ECONNRESET,
+			wantAttempts: 3,
+		},
+		{
+			name:         "503s use their own cap",
+			resp:         &http.Response{StatusCode: http.StatusServiceUnavailable},
+			wantAttempts: 1,
+		},
+		{
+			name:         "other failures fall back to BackOffPolicy.MaxRetries",
+			resp:         &http.Response{StatusCode: http.StatusTooManyRequests},
+			wantAttempts: 2,
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			calledCount := 0
+			rt := retryabletransport.New(
+				roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+					calledCount++
+					return tc.resp, tc.err
+				}),
+				func(req *http.Request, resp *http.Response, err error) bool {
+					return err != nil || resp.StatusCode >= http.StatusTooManyRequests
+				},
+				nil,
+				&retryabletransport.BackOffPolicy{MaxRetries: 1},
+				retryabletransport.WithMaxRetriesForError(func(req *http.Request, resp *http.Response, err error) (uint64, bool) {
+					switch {
+					case errors.Is(err, syscall.ECONNRESET):
+						return 2, true
+					case resp != nil && resp.StatusCode == http.StatusServiceUnavailable:
+						return 0, true
+					}
+					return 0, false
+				}),
+			)
+			req, err := http.NewRequest(http.MethodGet, "http://example.com", nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			_, _ = rt.RoundTrip(req)
+			assert.Equal(t, tc.wantAttempts, calledCount)
+		})
+	}
+}
+
+func Test_RoundTripper_RoundTrip_SuccessIsNotRetried(t *testing.T) {
+	type test struct {
+		name         string
+		opts         []retryabletransport.Option
+		wantAttempts int
+	}
+	tests := []test{
+		{
+			name:         "2xx is returned even if shouldRetryFunc returns true",
+			wantAttempts: 1,
+		},
+		{
+			name:         "AllowRetryOnSuccess lets shouldRetryFunc retry 2xx",
+			opts:         []retryabletransport.Option{retryabletransport.AllowRetryOnSuccess()},
+			wantAttempts: 2,
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			calledCount := 0
+			rt := retryabletransport.New(
+				roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+					calledCount++
+					return &http.Response{StatusCode: http.StatusOK}, nil
+				}),
+				func(req *http.Request, resp *http.Response, err error) bool {
+					return true
+				},
+				nil,
+				&retryabletransport.BackOffPolicy{MaxRetries: 1},
+				tc.opts...,
+			)
+			req, err := http.NewRequest(http.MethodGet, "http://example.com", nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			resp, _ := rt.RoundTrip(req)
+			assert.Equal(t, http.StatusOK, resp.StatusCode)
+			assert.Equal(t, tc.wantAttempts, calledCount)
+		})
+	}
+}
+
+func Test_RoundTripper_RoundTrip_ExpectContinue(t *testing.T) {
+	type test struct {
+		name         string
+		firstStatus  int
+		wantExpect   []string
+		wantAttempts int
+	}
+	tests := []test{
+		{
+			name:         "handshake is repeated on retry",
+			firstStatus:  http.StatusServiceUnavailable,
+			wantExpect:   []string{"100-continue", "100-continue"},
+			wantAttempts: 2,
+		},
+		{
+			name:         "417 is retried without the Expect header",
+			firstStatus:  http.StatusExpectationFailed,
+			wantExpect:   []string{"100-continue", ""},
+			wantAttempts: 2,
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			var gotExpect []string
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				gotExpect = append(gotExpect, r.Header.Get("Expect"))
+				if len(gotExpect) == 1 {
+					w.WriteHeader(tc.firstStatus)
+					return
+				}
+				requestBody, err := io.ReadAll(r.Body)
+				if err != nil {
+					t.Fatal(err)
+				}
+				assert.Equal(t, "upload", string(requestBody))
+			}))
+			defer server.Close()
+			client := &http.Client{
+				Transport: retryabletransport.New(
+					&http.Transport{ExpectContinueTimeout: time.Second},
+					func(req *http.Request, resp *http.Response, err error) bool {
+						return resp != nil && resp.StatusCode == http.StatusServiceUnavailable
+					},
+					nil,
+					&retryabletransport.BackOffPolicy{MaxRetries: 1},
+				),
+			}
+			req, err := http.NewRequest(http.MethodPut, server.URL, strings.NewReader("upload"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			req.Header.Set("Expect", "100-continue")
+			resp, err := client.Do(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer resp.Body.Close()
+			assert.Equal(t, http.StatusOK, resp.StatusCode)
+			assert.Equal(t, tc.wantExpect, gotExpect)
+			assert.Equal(t, tc.wantAttempts, len(gotExpect))
+		})
+	}
+}
+
+func Test_RoundTripper_RoundTrip_AttemptHeader(t *testing.T) {
+	type test struct {
+		name           string
+		onFirstAttempt bool
+		want           []string
+	}
+	tests := []test{
+		{
+			name: "header is skipped on the first attempt",
+			want: []string{"", "1", "2"},
+		},
+		{
+			name:           "header is set to 0 on the first attempt",
+			onFirstAttempt: true,
+			want:           []string{"0", "1", "2"},
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			var got []string
+			rt := retryabletransport.New(
+				roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+					got = append(got, req.Header.Get(retryabletransport.DefaultAttemptHeader))
+					return nil, syscall.ECONNRESET
+				}),
+				nil,
+				nil,
+				&retryabletransport.BackOffPolicy{MaxRetries: 2},
+				retryabletransport.WithAttemptHeader("", tc.onFirstAttempt),
+			)
+			req, err := http.NewRequest(http.MethodGet, "http://example.com", nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			_, err = rt.RoundTrip(req)
+			assert.ErrorIs(t, err, syscall.ECONNRESET)
+			assert.Equal(t, tc.want, got)
+			assert.Empty(t, req.Header.Get(retryabletransport.DefaultAttemptHeader))
+		})
+	}
+}
+
+func Test_RoundTripper_RoundTrip_NotifyContext(t *testing.T) {
+	type ctxKey struct{}
+	type test struct {
+		name       string
+		opts       []retryabletransport.Option
+		wantCtxErr error
+		wantCtxVal any
+	}
+	tests := []test{
+		{
+			name:       "notify context is detached from request cancellation by default",
+			wantCtxErr: nil,
+			wantCtxVal: "value",
+		},
+		{
+			name: "notify context can be overridden",
+			opts: []retryabletransport.Option{
+				retryabletransport.WithNotifyContext(func(req *http.Request) context.Context {
+					return req.Context()
+				}),
+			},
+			wantCtxErr: context.Canceled,
+			wantCtxVal: "value",
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			ctx, cancel := context.WithCancel(context.WithValue(context.Background(), ctxKey{}, "value"))
+			defer cancel()
+			var gotCtx context.Context
+			rt := retryabletransport.New(
+				roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+					return nil, syscall.ECONNRESET
+				}),
+				nil,
+				func(ctx context.Context, err error, duration time.Duration) {
+					gotCtx = ctx
+					cancel()
+				},
+				&retryabletransport.BackOffPolicy{MaxRetries: 1},
+				tc.opts...,
+			)
+			req, err := http.NewRequestWithContext(ctx, http.MethodGet, "http://example.com", nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			_, err = rt.RoundTrip(req)
+			assert.ErrorIs(t, err, context.Canceled)
+			assert.Equal(t, tc.wantCtxErr, gotCtx.Err())
+			assert.Equal(t, tc.wantCtxVal, gotCtx.Value(ctxKey{}))
+		})
+	}
+}
+
 func ExampleNew() {
 	client := &http.Client{
 		Transport: retryabletransport.New(
@@ -170,3 +463,213 @@ func ExampleNew() {
 		fmt.Println(err)
 	}
 }
+
+func Test_WrapClient(t *testing.T) {
+	calledCount := 0
+	client := retryabletransport.WrapClient(
+		&http.Client{
+			Transport: roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+				calledCount++
+				return &http.Response{StatusCode: http.StatusServiceUnavailable, Body: http.NoBody}, nil
+			}),
+			Timeout: 5 * time.Second,
+		},
+		retryabletransport.WithBackOffPolicy(&retryabletransport.BackOffPolicy{MaxRetries: 1}),
+	)
+	assert.Equal(t, 5*time.Second, client.Timeout)
+	resp, err := client.Get("http://example.com")
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusServiceUnavailable, resp.StatusCode)
+	assert.Equal(t, 2, calledCount)
+}
+
+func ExampleWrapClient() {
+	client := retryabletransport.WrapClient(
+		&http.Client{Timeout: 3 * time.Second},
+		retryabletransport.WithNotify(func(ctx context.Context, err error, duration time.Duration) {
+			fmt.Printf("retry http request, err: %v, duration: %v", err, duration)
+		}),
+	)
+	_, err := client.Get("http://example.com")
+	if err != nil {
+		fmt.Println(err)
+	}
+}
+
+func Test_RoundTripper_RoundTrip_NilResponseAndError(t *testing.T) {
+	type test struct {
+		name         string
+		shouldRetry  retryabletransport.ShouldRetryFunc
+		wantAttempts int
+	}
+	tests := []test{
+		{
+			name:         "nil response and error is reported as an error",
+			wantAttempts: 1,
+		},
+		{
+			name: "nil response and error can be retried",
+			shouldRetry: func(req *http.Request, resp *http.Response, err error) bool {
+				return errors.Is(err, retryabletransport.NilResponseError)
+			},
+			wantAttempts: 2,
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			calledCount := 0
+			rt := retryabletransport.New(
+				roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+					calledCount++
+					return nil, nil
+				}),
+				tc.shouldRetry,
+				nil,
+				&retryabletransport.BackOffPolicy{MaxRetries: 1, InitialInterval: time.Millisecond},
+			)
+			req, err := http.NewRequest(http.MethodGet, "http://example.com", nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			resp, err := rt.RoundTrip(req)
+			assert.Nil(t, resp)
+			assert.ErrorIs(t, err, retryabletransport.NilResponseError)
+			assert.Equal(t, tc.wantAttempts, calledCount)
+		})
+	}
+}
+
+func Test_RoundTripper_RoundTripContext(t *testing.T) {
+	type ctxKey struct{}
+	ctx, cancel := context.WithCancel(context.WithValue(context.Background(), ctxKey{}, "value"))
+	defer cancel()
+	calledCount := 0
+	rt := retryabletransport.New(
+		roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+			calledCount++
+			assert.Equal(t, "value", req.Context().Value(ctxKey{}))
+			return nil, syscall.ECONNREFUSED
+		}),
+		nil,
+		func(ctx context.Context, err error, duration time.Duration) {
+			cancel()
+		},
+		&retryabletransport.BackOffPolicy{MaxRetries: 3},
+	)
+	req, err := http.NewRequest(http.MethodGet, "http://example.com", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = rt.RoundTripContext(ctx, req)
+	assert.ErrorIs(t, err, context.Canceled)
+	assert.Equal(t, 1, calledCount)
+	assert.Equal(t, context.Background(), req.Context())
+}
+
+func BenchmarkRoundTripper_RoundTrip_Success(b *testing.B) {
+	inner := roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		if req.Body != nil {
+			_, _ = io.Copy(io.Discard, req.Body)
+			_ = req.Body.Close()
+		}
+		return &http.Response{StatusCode: http.StatusOK, Body: http.NoBody}, nil
+	})
+	rt := retryabletransport.New(inner, nil, nil, nil)
+	body := bytes.Repeat([]byte("x"), 4<<10)
+	for _, bc := range []struct {
+		name   string
+		method string
+		body   []byte
+	}{
+		{name: "GET", method: http.MethodGet},
+		{name: "PUT", method: http.MethodPut, body: body},
+	} {
+		b.Run(bc.name, func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				var reqBody io.Reader
+				if bc.body != nil {
+					reqBody = bytes.NewReader(bc.body)
+				}
+				req, err := http.NewRequest(bc.method, "http://example.com", reqBody)
+				if err != nil {
+					b.Fatal(err)
+				}
+				if _, err := rt.RoundTrip(req); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func Test_ReturnLastResponseOnExhaustion(t *testing.T) {
+	type test struct {
+		name    string
+		opts    []retryabletransport.Option
+		wantErr error
+	}
+	tests := []test{
+		{
+			name: "last response is returned without an error by default",
+		},
+		{
+			name: "last response is returned without an error if enabled",
+			opts: []retryabletransport.Option{retryabletransport.ReturnLastResponseOnExhaustion(true)},
+		},
+		{
+			name:    "last response is returned with ShouldRetryRespError if disabled",
+			opts:    []retryabletransport.Option{retryabletransport.ReturnLastResponseOnExhaustion(false)},
+			wantErr: retryabletransport.ShouldRetryRespError,
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			calledCount := 0
+			rt := retryabletransport.New(
+				roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+					calledCount++
+					return &http.Response{StatusCode: http.StatusServiceUnavailable, Body: http.NoBody}, nil
+				}),
+				nil,
+				nil,
+				&retryabletransport.BackOffPolicy{MaxRetries: 1, InitialInterval: time.Millisecond},
+				tc.opts...,
+			)
+			req, err := http.NewRequest(http.MethodGet, "http://example.com", nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			resp, err := rt.RoundTrip(req)
+			if tc.wantErr == nil {
+				assert.NoError(t, err)
+			} else {
+				assert.ErrorIs(t, err, tc.wantErr)
+			}
+			assert.Equal(t, http.StatusServiceUnavailable, resp.StatusCode)
+			assert.Equal(t, 2, calledCount)
+		})
+	}
+}
+
+func Test_WithBeforeRequest(t *testing.T) {
+	var events []string
+	rt := retryabletransport.New(
+		roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+			events = append(events, "attempt")
+			return &http.Response{StatusCode: http.StatusServiceUnavailable, Body: http.NoBody}, nil
+		}),
+		nil,
+		nil,
+		&retryabletransport.BackOffPolicy{MaxRetries: 2, InitialInterval: time.Millisecond},
+		retryabletransport.WithBeforeRequest(func(req *http.Request) {
+			events = append(events, "before "+req.URL.Path)
+		}),
+	)
+	req, err := http.NewRequest(http.MethodGet, "http://example.com/a", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, _ = rt.RoundTrip(req)
+	assert.Equal(t, []string{"before /a", "attempt", "attempt", "attempt"}, events)
+}
@@ -0,0 +1,40 @@
+package retryabletransport
+
+import (
+	"net/http"
+
+	"github.com/cenkalti/backoff/v4"
+)
+
+// ResponseValidatorFunc checks a successful response and returns an error if it looks wrong, e.g. because a
+// header is missing or the body is incomplete.
+type ResponseValidatorFunc func(resp *http.Response) error
+
+// WithResponseValidator runs validator on every response with a 2xx status code, as the most general way to retry
+// responses that look wrong. If validator returns an error, the attempt fails with it, which is passed to the
+// NotifyFunc, and it is retried for idempotent requests, regardless of the ShouldRetryFunc; non-idempotent
+// requests fail with the error right away. The response of a failed validation is never returned, not even
+// once retries ran out. validator must leave resp.Body unconsumed; to look at the body, read it through
+// InspectResponseBody with resp.Request, which restores it and honors WithMaxInspectBodyBytes.
+func WithResponseValidator(validator ResponseValidatorFunc) Option {
+	return func(p *RoundTripper) {
+		p.responseValidator = validator
+	}
+}
+
+// validateResponse runs the response validator on the successful response of state, and fails the attempt
+// with its error, if any.
+func (p *RoundTripper) validateResponse(state *retryState) error {
+	err := p.responseValidator(state.resp)
+	if err == nil {
+		return nil
+	}
+	drainBody(state.resp, p.drainLimit())
+	state.resp, state.err = nil, err
+	if !isIdempotent(state.req) {
+		state.recordDecision(DecisionNoRetry)
+		return backoff.Permanent(err)
+	}
+	state.recordDecision(DecisionRetry)
+	return err
+}
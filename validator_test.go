@@ -0,0 +1,121 @@
+package retryabletransport_test
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/linzhengen/retryabletransport"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_WithResponseValidator(t *testing.T) {
+	errMissingVersion := errors.New("missing X-Version header")
+	validator := func(resp *http.Response) error {
+		if resp.Header.Get("X-Version") == "" {
+			return errMissingVersion
+		}
+		return nil
+	}
+	type test struct {
+		name         string
+		method       string
+		missing      int32
+		wantAttempts int32
+		wantNotified int
+		wantErr      error
+	}
+	tests := []test{
+		{name: "valid response", method: http.MethodGet, wantAttempts: 1},
+		{name: "invalid response is retried", method: http.MethodGet, missing: 2, wantAttempts: 3, wantNotified: 2},
+		{name: "retries run out", method: http.MethodGet, missing: 5, wantAttempts: 3, wantNotified: 2, wantErr: errMissingVersion},
+		{name: "non-idempotent request is not retried", method: http.MethodPost, missing: 1, wantAttempts: 1, wantErr: errMissingVersion},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			var attempts atomic.Int32
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if attempts.Add(1) > tc.missing {
+					w.Header().Set("X-Version", "1")
+				}
+				_, _ = io.WriteString(w, "ok")
+			}))
+			defer server.Close()
+			var notified []error
+			rt := retryabletransport.New(
+				nil,
+				nil,
+				func(_ context.Context, err error, _ time.Duration) {
+					notified = append(notified, err)
+				},
+				&retryabletransport.BackOffPolicy{MaxRetries: 2, InitialInterval: time.Millisecond},
+				retryabletransport.WithResponseValidator(validator),
+			)
+			req, err := http.NewRequest(tc.method, server.URL, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			resp, err := rt.RoundTrip(req)
+			assert.Equal(t, tc.wantAttempts, attempts.Load())
+			assert.Len(t, notified, tc.wantNotified)
+			for _, err := range notified {
+				assert.ErrorIs(t, err, errMissingVersion)
+			}
+			if tc.wantErr != nil {
+				assert.ErrorIs(t, err, tc.wantErr)
+				assert.Nil(t, resp)
+				return
+			}
+			if assert.NoError(t, err) {
+				defer resp.Body.Close()
+				assert.Equal(t, "1", resp.Header.Get("X-Version"))
+			}
+		})
+	}
+
+	t.Run("validator inspecting the body", func(t *testing.T) {
+		var attempts atomic.Int32
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if attempts.Add(1) == 1 {
+				_, _ = io.WriteString(w, "partial")
+				return
+			}
+			_, _ = io.WriteString(w, "complete")
+		}))
+		defer server.Close()
+		rt := retryabletransport.New(
+			nil,
+			nil,
+			nil,
+			&retryabletransport.BackOffPolicy{MaxRetries: 2, InitialInterval: time.Millisecond},
+			retryabletransport.WithResponseValidator(func(resp *http.Response) error {
+				body, _, err := retryabletransport.InspectResponseBody(resp.Request, resp)
+				if err != nil {
+					return err
+				}
+				if string(body) != "complete" {
+					return errors.New("incomplete body")
+				}
+				return nil
+			}),
+		)
+		req, err := http.NewRequest(http.MethodGet, server.URL, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp, err := rt.RoundTrip(req)
+		if !assert.NoError(t, err) {
+			return
+		}
+		defer resp.Body.Close()
+		body, err := io.ReadAll(resp.Body)
+		assert.NoError(t, err)
+		assert.Equal(t, "complete", string(body))
+		assert.Equal(t, int32(2), attempts.Load())
+	})
+}
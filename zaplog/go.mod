@@ -0,0 +1,21 @@
+module github.com/linzhengen/retryabletransport/zaplog
+
+go 1.22
+
+require (
+	github.com/linzhengen/retryabletransport v0.0.0-20261014064632-c0ec2b48e14a
+	github.com/stretchr/testify v1.9.0
+	go.uber.org/zap v1.28.0
+)
+
+require (
+	github.com/cenkalti/backoff/v4 v4.2.1 // indirect
+	github.com/davecgh/go-spew v1.1.1 // indirect
+	github.com/pmezard/go-difflib v1.0.0 // indirect
+	go.uber.org/multierr v1.10.0 // indirect
+	gopkg.in/yaml.v3 v3.0.1 // indirect
+)
+
+// The replace only takes effect within this repository, to develop both modules together; consumers get the
+// required version of the root module, which has to be raised when this module needs newer root APIs.
+replace github.com/linzhengen/retryabletransport => ../
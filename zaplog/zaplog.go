@@ -0,0 +1,94 @@
+// Package zaplog logs the retries of a retryabletransport.RoundTripper to a zap logger. It is a separate module, so
+// that the retryabletransport package does not depend on zap:
+//
+//	go get github.com/linzhengen/retryabletransport/zaplog
+package zaplog
+
+import (
+	"context"
+	"log/slog"
+
+	"github.com/linzhengen/retryabletransport"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// WithZapLogger logs every retry and every request that failed for good to l, like retryabletransport.WithLogger
+// does to a *slog.Logger, with the same messages and fields, e.g. "method", "url", "attempts", "status", and
+// "error". opts set the levels, which are mapped to the zap levels of the same name.
+func WithZapLogger(l *zap.Logger, opts ...retryabletransport.LoggerOption) retryabletransport.Option {
+	return retryabletransport.WithLogger(slog.New(&handler{logger: l}), opts...)
+}
+
+// handler is a slog.Handler writing to a zap logger.
+type handler struct {
+	logger *zap.Logger
+}
+
+func (h *handler) Enabled(_ context.Context, level slog.Level) bool {
+	return h.logger.Core().Enabled(zapLevel(level))
+}
+
+func (h *handler) Handle(_ context.Context, r slog.Record) error {
+	fields := make([]zap.Field, 0, r.NumAttrs())
+	r.Attrs(func(a slog.Attr) bool {
+		fields = append(fields, field(a))
+		return true
+	})
+	if ce := h.logger.Check(zapLevel(r.Level), r.Message); ce != nil {
+		ce.Time = r.Time
+		ce.Write(fields...)
+	}
+	return nil
+}
+
+func (h *handler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	fields := make([]zap.Field, 0, len(attrs))
+	for _, a := range attrs {
+		fields = append(fields, field(a))
+	}
+	return &handler{logger: h.logger.With(fields...)}
+}
+
+func (h *handler) WithGroup(name string) slog.Handler {
+	return &handler{logger: h.logger.With(zap.Namespace(name))}
+}
+
+// zapLevel maps a slog level to the zap level of the same name.
+func zapLevel(level slog.Level) zapcore.Level {
+	switch {
+	case level >= slog.LevelError:
+		return zapcore.ErrorLevel
+	case level >= slog.LevelWarn:
+		return zapcore.WarnLevel
+	case level >= slog.LevelInfo:
+		return zapcore.InfoLevel
+	default:
+		return zapcore.DebugLevel
+	}
+}
+
+// field converts a slog attribute to a zap field.
+func field(a slog.Attr) zap.Field {
+	v := a.Value.Resolve()
+	switch v.Kind() {
+	case slog.KindString:
+		return zap.String(a.Key, v.String())
+	case slog.KindInt64:
+		return zap.Int64(a.Key, v.Int64())
+	case slog.KindUint64:
+		return zap.Uint64(a.Key, v.Uint64())
+	case slog.KindFloat64:
+		return zap.Float64(a.Key, v.Float64())
+	case slog.KindBool:
+		return zap.Bool(a.Key, v.Bool())
+	case slog.KindDuration:
+		return zap.Duration(a.Key, v.Duration())
+	case slog.KindTime:
+		return zap.Time(a.Key, v.Time())
+	}
+	if err, ok := v.Any().(error); ok {
+		return zap.NamedError(a.Key, err)
+	}
+	return zap.Any(a.Key, v.Any())
+}